@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"url-shorter/internal/backup"
+	"url-shorter/internal/service"
+)
+
+// runExport выполняет подкоманду export: url-shorter export [-password-hashes] backup.jsonl
+// Архив сначала пишется во временный файл рядом, чтобы при ошибке не остался обрезанный бэкап.
+func runExport(ctx context.Context, backups *service.BackupService, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	withPasswords := fs.Bool("password-hashes", false, "выгрузить хеши паролей и 2FA (архив тогда надо хранить как секрет)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("export needs the archive file")
+	}
+
+	path := fs.Arg(0)
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	stats, err := backups.Export(ctx, f, *withPasswords)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	fmt.Printf("exported to %s: %s\n", path, statsLine(stats))
+	return nil
+}
+
+// runRestore выполняет подкоманду restore: url-shorter restore [-check] backup.jsonl
+// С -check архив только проверяется. Восстановить можно только в пустую БД.
+func runRestore(ctx context.Context, backups *service.BackupService, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	check := fs.Bool("check", false, "только проверить архив, ничего не записывая")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("restore needs the archive file")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	header, stats, err := backups.Restore(ctx, f, *check)
+	if err != nil {
+		return err
+	}
+	mode := "restored"
+	if *check {
+		mode = "archive is valid (check only, nothing was saved)"
+	}
+	fmt.Printf("%s, created %s: %s\n", mode, header.CreatedAt.Format("2006-01-02 15:04:05 MST"), statsLine(stats))
+	if !header.PasswordHashes {
+		fmt.Println("the archive has no password hashes: users have to reset their passwords to log in and set up 2FA again")
+	}
+	return nil
+}
+
+func statsLine(s backup.Stats) string {
+	return fmt.Sprintf("users: %d, workspaces: %d, members: %d, folders: %d, links: %d (deleted: %d), tags: %d, retired aliases: %d, clicks: %d",
+		s.Users, s.Workspaces, s.Members, s.Folders, s.Links, s.DeletedLinks, s.Tags, s.RetiredAliases, s.Clicks)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"url-shorter/internal/importer"
+	"url-shorter/internal/service"
+	"url-shorter/internal/store"
+)
+
+// runImport выполняет подкоманду import: url-shorter import -format yourls -user admin@example.com [-workspace 3] [-dry-run] [-rename] export.csv
+// Ссылки создаются от имени пользователя -user, в его личных ссылках или в пространстве -workspace.
+func runImport(ctx context.Context, db *store.DbManager, links *service.ShortenerService, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "формат выгрузки: yourls или bitly")
+	mail := fs.String("user", "", "email пользователя, от имени которого создаются ссылки")
+	workspaceID := fs.Int64("workspace", 0, "id пространства (0 — личные ссылки пользователя)")
+	dryRun := fs.Bool("dry-run", false, "только проверить выгрузку, ничего не создавая")
+	rename := fs.Bool("rename", false, "занятый или недопустимый alias заменить сгенерированным, а не пропускать ссылку")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format == "" || *mail == "" || fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("import needs -format, -user and the export file")
+	}
+
+	userID, _, err := db.GetUserByEmail(ctx, *mail)
+	if err != nil {
+		return fmt.Errorf("user %s: %w", *mail, err)
+	}
+	if *workspaceID != 0 {
+		member, err := db.GetMembership(ctx, *workspaceID, userID)
+		if err != nil {
+			return fmt.Errorf("workspace %d: %w", *workspaceID, err)
+		}
+		if !member.CanEdit() {
+			return fmt.Errorf("user %s cannot create links in workspace %d", *mail, *workspaceID)
+		}
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	records, err := importer.Parse(*format, f)
+	if err != nil {
+		return err
+	}
+
+	results, err := links.ImportLinks(ctx, store.Owner{UserID: userID, WorkspaceID: *workspaceID}, records,
+		service.ImportOptions{DryRun: *dryRun, RenameConflicts: *rename})
+	counts := make(map[string]int)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LINE\tSOURCE ALIAS\tALIAS\tSTATUS\tREASON")
+	for _, res := range results {
+		reason := ""
+		if res.Err != nil {
+			reason = res.Err.Error()
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", res.Line, res.SourceAlias, res.Alias, res.Status, reason)
+		counts[res.Status]++
+	}
+	tw.Flush()
+	mode := ""
+	if *dryRun {
+		mode = " (dry run, nothing was saved)"
+	}
+	fmt.Printf("created: %d, renamed: %d, skipped: %d%s\n",
+		counts[service.ImportCreated], counts[service.ImportRenamed], counts[service.ImportSkipped], mode)
+	return err
+}
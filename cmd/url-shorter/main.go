@@ -1,10 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 	"url-shorter/internal/config"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/mail"
+	"url-shorter/internal/oidc"
+	"url-shorter/internal/ratelimit"
 	"url-shorter/internal/server"
 	"url-shorter/internal/service"
 	"url-shorter/internal/store"
@@ -16,12 +26,16 @@ const (
 	envProd  = "prod"
 )
 
+// clickFlushInterval — как часто счётчики переходов из памяти сбрасываются в БД.
+const clickFlushInterval = 30 * time.Second
+
 func main() {
 
 	cfg := config.MustLoad()
 	servConf := cfg.HTTPServer
 
-	logger := setupLogger(cfg.Env)
+	logger := setupLogger(cfg.Env, cfg.LogRedactKeys)
+	slog.SetDefault(logger) // логгер запроса в middleware строится от slog.Default()
 	logger.Info("logger is settuped")
 
 	// Подключаемся к БД
@@ -33,17 +47,258 @@ func main() {
 	defer db.Close()
 	logger.Info("Successfully connected to database", "storage", cfg.Storage)
 
-	shortService := service.NewShortenerService(db)
-	userService := service.NewUserService(db)
+	auditLog := service.NewAuditLog(db)
+	shortService := service.NewShortenerService(db, auditLog, time.Duration(cfg.Links.TrashRetentionDays)*24*time.Hour)
+	shortService.SetURLPolicy(service.URLPolicy(cfg.Links.URLPolicy))
+
+	// Подкоманды выполняются разово, сервер не запускается: import — импорт ссылок из других сокращателей,
+	// export и restore — переносимая резервная копия.
+	backupService := service.NewBackupService(db)
+	commands := map[string]func(ctx context.Context, args []string) error{
+		"import": func(ctx context.Context, args []string) error {
+			return runImport(ctx, db, shortService, args)
+		},
+		"export": func(ctx context.Context, args []string) error {
+			return runExport(ctx, backupService, args)
+		},
+		"restore": func(ctx context.Context, args []string) error {
+			return runRestore(ctx, backupService, args)
+		},
+	}
+	if len(os.Args) > 1 {
+		if run, ok := commands[os.Args[1]]; ok {
+			if err := run(context.Background(), os.Args[2:]); err != nil {
+				logger.Error("Command failed", "command", os.Args[1], "error", err)
+				db.Close()
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	mailer, err := setupMailer(cfg.Mail)
+	if err != nil {
+		logger.Error("Failed to setup mailer", "error", err)
+		return
+	}
+
+	userService := service.NewUserService(db, service.UserOptions{
+		Lockout:         lockoutPolicy(cfg.Auth.Lockout),
+		Password:        service.PasswordPolicy(cfg.Auth.PasswordPolicy),
+		Sessions:        sessionPolicy(cfg.Auth.Session),
+		Mailer:          mailer,
+		Secret:          []byte(cfg.Auth.Secret),
+		VerificationTTL: time.Duration(cfg.Auth.VerificationTTLHours) * time.Hour,
+		ResetTTL:        time.Duration(cfg.Auth.ResetTTLMinutes) * time.Minute,
+		Require2FA:      cfg.Auth.Require2FA,
+		OIDCSignup:      cfg.OIDC.AllowSignup,
+		Audit:           auditLog,
+	})
 	logger.Info("shortener-Service was successfuly created")
 
+	for _, mail := range cfg.Auth.Admins {
+		if err := userService.GrantAdmin(context.Background(), mail); err != nil {
+			if errors.Is(err, store.ErrUserNotFound) {
+				logger.Warn("Admin account is not registered yet", "mail", mail)
+				continue
+			}
+			logger.Error("Failed to grant admin role", "mail", mail, "error", err)
+			return
+		}
+	}
+	adminService := service.NewAdminService(db, shortService, auditLog)
+	workspaceService := service.NewWorkspaceService(db, mailer, auditLog)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Кэш греем в фоне: пока он не прогрет, /readyz отвечает 503
+	go retryWithBackoff(ctx, logger, "cache warm-up", shortService.WarmCache)
+
 	logger.Info("Trying to connect to server")
 
-	server := server.New(servConf.Address, shortService, userService)
-	if err := server.Start(); err != nil {
-		logger.Info("An error occurred while starting the server", "error", err)
+	server := server.New(servConf.Address, shortService, userService, adminService, workspaceService)
+	server.AddReadinessCheck("database", db.Ping)
+	server.AddReadinessCheck("migrations", db.CheckSchema)
+	server.AddReadinessCheck("cache", shortService.CacheReady)
+	server.SetRateLimiter(setupRateLimiter(ctx, cfg.RateLimit, db, logger))
+	server.SetSecureCookies(cfg.Env != envLocal) // локально сервер работает по http
+	server.SetSecurityHeaders(securityHeaders(cfg.SecurityHeaders))
+	server.SetDrainDelay(time.Duration(servConf.ShutdownDrainSeconds) * time.Second)
+	if cfg.OIDC.Enabled {
+		provider, err := oidc.NewProvider(ctx, oidc.Config{
+			Issuer:       cfg.OIDC.Issuer,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+			Scopes:       cfg.OIDC.Scopes,
+		})
+		if err != nil {
+			logger.Error("Failed to setup oidc provider", "error", err)
+			return
+		}
+		server.SetOIDCProvider(cfg.OIDC.Name, provider)
 	}
+
+	go runPeriodically(ctx, logger, "session cleanup", time.Hour, func(ctx context.Context) error {
+		n, err := userService.DeleteExpiredSessions(ctx)
+		if err == nil && n > 0 {
+			logger.Info("expired sessions deleted", "count", n)
+		}
+		return err
+	})
+	go runPeriodically(ctx, logger, "click flush", clickFlushInterval, shortService.FlushClicks)
+	go runPeriodically(ctx, logger, "trash purge", time.Hour, func(ctx context.Context) error {
+		n, err := shortService.PurgeTrash(ctx)
+		if err == nil && n > 0 {
+			logger.Info("deleted links purged", "count", n)
+		}
+		return err
+	})
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Start()
+	}()
 	logger.Info("server started successfully on", "address", servConf.Address)
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			logger.Info("An error occurred while starting the server", "error", err)
+		}
+		return
+	case <-ctx.Done():
+	}
+
+	// пауза на снятие с балансировки не отнимает время у завершения запросов
+	shutdownTimeout := time.Duration(servConf.ShutdownDrainSeconds+servConf.ShutdownTimeout) * time.Second
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Failed to shutdown server gracefully", "error", err)
+	}
+	// переходы, накопленные после последнего сброса
+	if err := shortService.FlushClicks(shutdownCtx); err != nil {
+		logger.Error("Failed to flush clicks", "error", err)
+	}
+	logger.Info("server stopped")
+}
+
+// setupMailer создаёт способ отправки писем по настройкам.
+func setupMailer(cfg config.Mail) (mail.Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return mail.NewSMTPMailer(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.From), nil
+	case "file":
+		return mail.NewFileMailer(cfg.Dir, cfg.From)
+	case "log", "":
+		return mail.LogMailer{}, nil
+	}
+	return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+}
+
+// lockoutPolicy переводит настройки блокировки из конфига. Пустая секция — политика по умолчанию.
+func lockoutPolicy(cfg config.Lockout) service.LockoutPolicy {
+	if cfg == (config.Lockout{}) {
+		return service.DefaultLockoutPolicy
+	}
+	return service.LockoutPolicy{
+		FreeAttempts:     cfg.FreeAttempts,
+		BaseDelay:        time.Duration(cfg.BaseDelay) * time.Second,
+		MaxDelay:         time.Duration(cfg.MaxDelay) * time.Second,
+		AccountThreshold: cfg.AccountThreshold,
+		IPThreshold:      cfg.IPThreshold,
+		LockoutDuration:  time.Duration(cfg.LockoutMinutes) * time.Minute,
+		Window:           time.Duration(cfg.WindowMinutes) * time.Minute,
+	}
+}
+
+// sessionPolicy переводит сроки жизни сессий из конфига. Пустая секция — политика по умолчанию.
+func sessionPolicy(cfg config.Session) service.SessionPolicy {
+	if cfg == (config.Session{}) {
+		return service.DefaultSessionPolicy
+	}
+	return service.SessionPolicy{
+		Lifetime:         time.Duration(cfg.LifetimeHours) * time.Hour,
+		RememberLifetime: time.Duration(cfg.RememberDays) * 24 * time.Hour,
+		MaxLifetime:      time.Duration(cfg.MaxLifetimeDays) * 24 * time.Hour,
+		RenewInterval:    time.Duration(cfg.RenewIntervalMinutes) * time.Minute,
+	}
+}
+
+// securityHeaders переводит настройки заголовков безопасности из конфига.
+func securityHeaders(cfg config.SecurityHeaders) server.SecurityHeaders {
+	return server.SecurityHeaders{
+		HSTSMaxAge:            cfg.HSTSMaxAgeSeconds,
+		HSTSIncludeSubdomains: cfg.HSTSIncludeSubdomains,
+		ReferrerPolicy:        cfg.ReferrerPolicy,
+		PermissionsPolicy:     cfg.PermissionsPolicy,
+		CSPReportURI:          cfg.CSPReportURI,
+	}
+}
+
+// setupRateLimiter выбирает бэкенд лимитов и переводит политики из конфига.
+// Для postgres запускает фоновую очистку давно не используемых вёдер.
+func setupRateLimiter(ctx context.Context, cfg config.RateLimit, db *store.DbManager, logger *slog.Logger) (ratelimit.Limiter, map[string]ratelimit.Policy) {
+	policies := make(map[string]ratelimit.Policy, len(cfg.Policies))
+	for group, p := range cfg.Policies {
+		policies[group] = ratelimit.Policy{
+			RequestsPerMinute: p.RequestsPerMinute,
+			Burst:             p.Burst,
+			Key:               p.Key,
+		}
+	}
+
+	if cfg.Backend == "postgres" {
+		limiter := ratelimit.NewPostgresLimiter(db)
+		go runPeriodically(ctx, logger, "rate limit cleanup", 10*time.Minute, func(ctx context.Context) error {
+			return limiter.Cleanup(ctx, time.Hour)
+		})
+		return limiter, policies
+	}
+	return ratelimit.NewMemoryLimiter(), policies
+}
+
+// Пределы паузы между попытками в retryWithBackoff.
+const (
+	retryMinDelay = time.Second
+	retryMaxDelay = time.Minute
+)
+
+// retryWithBackoff вызывает job, пока он не выполнится успешно или не отменится ctx.
+// После каждой ошибки пауза удваивается от retryMinDelay до retryMaxDelay.
+func retryWithBackoff(ctx context.Context, logger *slog.Logger, name string, job func(ctx context.Context) error) {
+	delay := retryMinDelay
+	for {
+		err := job(ctx)
+		if err == nil {
+			return
+		}
+		logger.Error("background job failed, will retry", "job", name, "error", err, "retry_in", delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, retryMaxDelay)
+	}
+}
+
+// runPeriodically вызывает job раз в interval, пока не отменён ctx. Ошибки только логируются.
+func runPeriodically(ctx context.Context, logger *slog.Logger, name string, interval time.Duration, job func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := job(ctx); err != nil {
+				logger.Error("background job failed", "job", name, "error", err)
+			}
+		}
+	}
 }
 
 type doubleNewlineWriter struct {
@@ -58,20 +313,23 @@ func (w *doubleNewlineWriter) Write(p []byte) (n int, err error) {
 	return w.w.Write(newP)
 }
 
-func setupLogger(env string) *slog.Logger {
-	var log *slog.Logger
+// setupLogger создаёт логгер под окружение. Любой хендлер оборачивается в RedactHandler,
+// чтобы пароли, хеши и токены не попадали в логи ни при каком уровне логирования.
+func setupLogger(env string, redactKeys []string) *slog.Logger {
+	var h slog.Handler
 	writer := &doubleNewlineWriter{w: os.Stdout}
 
 	switch env {
 	case envLocal:
-		txtH := slog.NewTextHandler(writer, &slog.HandlerOptions{Level: slog.LevelDebug})
-		log = slog.New(txtH)
+		h = slog.NewTextHandler(writer, &slog.HandlerOptions{Level: slog.LevelDebug})
 	case envDev:
-		jsonH := slog.NewJSONHandler(writer, &slog.HandlerOptions{Level: slog.LevelDebug})
-		log = slog.New(jsonH)
+		h = slog.NewJSONHandler(writer, &slog.HandlerOptions{Level: slog.LevelDebug})
 	case envProd:
-		log = slog.New(slog.NewJSONHandler(writer, &slog.HandlerOptions{Level: slog.LevelInfo}))
+		h = slog.NewJSONHandler(writer, &slog.HandlerOptions{Level: slog.LevelInfo})
+	default:
+		h = slog.NewJSONHandler(writer, &slog.HandlerOptions{Level: slog.LevelInfo})
 	}
 
-	return log
+	keys := append(append([]string{}, logging.DefaultSensitiveKeys...), redactKeys...)
+	return slog.New(logging.NewRedactHandler(h, keys))
 }
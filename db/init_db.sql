@@ -7,8 +7,25 @@ CREATE DATABASE "url-shrtner" OWNER urlshortner;
 -- подключиться к только что созданной базе
 \connect url-shrtner;
 
+-- порядок важен: сначала таблицы, которые ссылаются на другие
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS oidc_identities;
+DROP TABLE IF EXISTS api_tokens;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS password_resets;
+DROP TABLE IF EXISTS login_events;
+DROP TABLE IF EXISTS login_throttle;
+DROP TABLE IF EXISTS rate_limits;
 DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS link_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS url_history;
+DROP TABLE IF EXISTS retired_aliases;
 DROP TABLE IF EXISTS urls;
+DROP TABLE IF EXISTS folders;
+DROP TABLE IF EXISTS workspace_invites;
+DROP TABLE IF EXISTS workspace_members;
+DROP TABLE IF EXISTS workspaces;
 DROP TABLE IF EXISTS users;
 
 -- сам скрипт для создания таблиц
@@ -16,27 +33,290 @@ CREATE TABLE IF NOT EXISTS users (
     id SERIAL PRIMARY KEY,
     mail VARCHAR(100) UNIQUE NOT NULL,
     password TEXT NOT NULL,
-    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    verified_at TIMESTAMPTZ, -- NULL, пока пользователь не подтвердил email
+    totp_secret TEXT, -- зашифрованный секрет TOTP
+    totp_enabled_at TIMESTAMPTZ, -- NULL, пока 2FA не подтверждена первым кодом
+    totp_last_step BIGINT NOT NULL DEFAULT 0, -- последний принятый шаг, чтобы код нельзя было использовать дважды
+    role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin')),
+    disabled_at TIMESTAMPTZ -- NULL, пока аккаунт не заблокирован администратором
 );
 
 
+-- рабочие пространства: общие ссылки команды
+CREATE TABLE IF NOT EXISTS workspaces (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- участники пространств: owner управляет участниками, editor создаёт ссылки, viewer только смотрит
+CREATE TABLE IF NOT EXISTS workspace_members (
+    workspace_id INTEGER NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (workspace_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS workspace_members_user_id_idx ON workspace_members (user_id);
+
+-- приглашения в пространства; хранится только SHA-256 от токена из письма. Приглашение срабатывает
+-- один раз (used_at), отзыв — удаление строки
+CREATE TABLE IF NOT EXISTS workspace_invites (
+    id SERIAL PRIMARY KEY,
+    workspace_id INTEGER NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    mail VARCHAR(100) NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    token_hash TEXT UNIQUE NOT NULL,
+    invited_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS workspace_invites_workspace_id_idx ON workspace_invites (workspace_id);
+
+-- папки ссылок: личные (user_id) или пространства (workspace_id); ссылка лежит не больше чем в одной папке
+CREATE TABLE IF NOT EXISTS folders (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE, -- NULL у папок пространства
+    workspace_id INTEGER REFERENCES workspaces(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((user_id IS NULL) <> (workspace_id IS NULL))
+);
+CREATE UNIQUE INDEX IF NOT EXISTS folders_user_name_idx ON folders (user_id, lower(name)) WHERE workspace_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS folders_workspace_name_idx ON folders (workspace_id, lower(name)) WHERE workspace_id IS NOT NULL;
+
 CREATE TABLE IF NOT EXISTS urls (
     id SERIAL PRIMARY KEY,
     short_code TEXT UNIQUE NOT NULL,
     original_url TEXT NOT NULL,
-    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL, -- автор ссылки; NULL у старых ссылок
+    taken_down_at TIMESTAMPTZ, -- ссылка снята администратором, редирект отвечает 410
+    takedown_reason TEXT NOT NULL DEFAULT '',
+    workspace_id INTEGER REFERENCES workspaces(id) ON DELETE CASCADE, -- NULL — личная ссылка автора
+    title TEXT NOT NULL DEFAULT '',
+    notes TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ, -- NULL, пока ссылку не редактировали
+    deleted_at TIMESTAMPTZ, -- ссылка в корзине: редирект отвечает 410, после срока хранения строку стирает фоновая задача
+    folder_id INTEGER REFERENCES folders(id) ON DELETE SET NULL, -- NULL — ссылка вне папок
+    expires_at TIMESTAMPTZ, -- после этого момента редирект отвечает 410; NULL — бессрочная
+    clicks BIGINT NOT NULL DEFAULT 0 -- переходы по ссылке; счётчик в памяти сбрасывается сюда пачками
+);
+CREATE INDEX IF NOT EXISTS urls_user_id_idx ON urls (user_id);
+CREATE INDEX IF NOT EXISTS urls_workspace_id_idx ON urls (workspace_id);
+CREATE INDEX IF NOT EXISTS urls_deleted_at_idx ON urls (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS urls_folder_id_idx ON urls (folder_id);
+
+-- теги ссылок, владелец — как у папок. Тег создаётся при первом назначении и удаляется, когда на нём не остаётся ссылок
+CREATE TABLE IF NOT EXISTS tags (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE, -- NULL у тегов пространства
+    workspace_id INTEGER REFERENCES workspaces(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    CHECK ((user_id IS NULL) <> (workspace_id IS NULL))
+);
+CREATE UNIQUE INDEX IF NOT EXISTS tags_user_name_idx ON tags (user_id, lower(name)) WHERE workspace_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS tags_workspace_name_idx ON tags (workspace_id, lower(name)) WHERE workspace_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS link_tags (
+    url_id INTEGER NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (url_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS link_tags_tag_id_idx ON link_tags (tag_id);
+
+-- alias, которые больше никому не выдаются. С url_id — прежний alias переименованной ссылки, редирект по нему
+-- ведёт на неё; без url_id (ссылку стёрли из корзины навсегда) редирект отвечает 410
+CREATE TABLE IF NOT EXISTS retired_aliases (
+    short_code TEXT PRIMARY KEY,
+    url_id INTEGER REFERENCES urls(id) ON DELETE SET NULL,
+    retired_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS retired_aliases_url_id_idx ON retired_aliases (url_id);
+
+-- ошибка с кодом unique_violation, чтобы приложение видело занятый alias так же, как при конфликте по UNIQUE.
+-- Свой прежний alias ссылка может вернуть (например, откатом переименования): он снова становится основным
+CREATE OR REPLACE FUNCTION urls_reject_retired_alias() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' THEN
+        DELETE FROM retired_aliases WHERE short_code = NEW.short_code AND url_id = NEW.id;
+    END IF;
+    IF EXISTS (SELECT 1 FROM retired_aliases WHERE short_code = NEW.short_code) THEN
+        RAISE EXCEPTION 'alias % was used by a deleted link', NEW.short_code USING ERRCODE = 'unique_violation';
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS urls_reject_retired_alias ON urls;
+CREATE TRIGGER urls_reject_retired_alias
+    BEFORE INSERT OR UPDATE OF short_code ON urls
+    FOR EACH ROW EXECUTE FUNCTION urls_reject_retired_alias();
+
+-- история изменений ссылок: при каждой правке сюда копируется заменённая версия
+CREATE TABLE IF NOT EXISTS url_history (
+    id SERIAL PRIMARY KEY,
+    url_id INTEGER NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    short_code TEXT NOT NULL,
+    original_url TEXT NOT NULL,
+    title TEXT NOT NULL,
+    notes TEXT NOT NULL,
+    changed_by INTEGER REFERENCES users(id) ON DELETE SET NULL, -- кто заменил эту версию
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
+CREATE INDEX IF NOT EXISTS url_history_url_id_idx ON url_history (url_id, changed_at);
 
 CREATE TABLE sessions (
     token TEXT PRIMARY KEY,
+    id SERIAL UNIQUE NOT NULL, -- для страницы "Безопасность": сам токен в HTML не выводим
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expiry TIMESTAMPTZ NOT NULL, -- сдвигается вперёд при активности, но не дальше absolute_expiry
+    absolute_expiry TIMESTAMPTZ NOT NULL, -- жёсткий предел жизни сессии с момента входа
+    remember BOOLEAN NOT NULL DEFAULT FALSE, -- вход с галочкой "запомнить меня"
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    workspace_id INTEGER REFERENCES workspaces(id) ON DELETE SET NULL -- выбранное пространство; NULL — личные ссылки
+);
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+CREATE INDEX IF NOT EXISTS sessions_expiry_idx ON sessions (expiry);
+
+-- вёдра token bucket для ограничения частоты запросов (общие для всех инстансов)
+CREATE TABLE IF NOT EXISTS rate_limits (
+    key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- счётчики неудачных попыток входа по аккаунту (scope = 'account', key = email) и по IP
+CREATE TABLE IF NOT EXISTS login_throttle (
+    scope TEXT NOT NULL,
+    key TEXT NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMPTZ,
+    notified_at TIMESTAMPTZ, -- когда владельцу последний раз писали о блокировке
+    PRIMARY KEY (scope, key)
+);
+
+-- журнал попыток входа для разбора подозрительной активности
+CREATE TABLE IF NOT EXISTS login_events (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    mail VARCHAR(100) NOT NULL,
+    ip TEXT NOT NULL,
+    event TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS login_events_created_at_idx ON login_events (created_at);
+CREATE INDEX IF NOT EXISTS login_events_mail_idx ON login_events (mail);
+
+-- одноразовые токены сброса пароля; хранится только SHA-256 от токена
+CREATE TABLE IF NOT EXISTS password_resets (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT UNIQUE NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- одноразовые коды восстановления для входа без приложения-аутентификатора; хранится только SHA-256
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id SERIAL PRIMARY KEY,
     user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    expiry TIMESTAMPTZ NOT NULL
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMPTZ
 );
+CREATE INDEX IF NOT EXISTS recovery_codes_user_id_idx ON recovery_codes (user_id);
+
+-- персональные API-токены (Authorization: Bearer); хранится только SHA-256 от токена
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL,
+    scope TEXT NOT NULL CHECK (scope IN ('read', 'write')),
+    expires_at TIMESTAMPTZ, -- NULL — бессрочный
+    last_used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS api_tokens_user_id_idx ON api_tokens (user_id);
+
+-- учётные записи внешнего провайдера OIDC, привязанные к пользователям (вход через SSO)
+CREATE TABLE IF NOT EXISTS oidc_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL, -- claim sub: постоянный ID у провайдера, в отличие от email
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (issuer, subject)
+);
+
+-- журнал аудита: кто, когда и откуда что сделал. Только дополняется: менять и удалять записи запрещает триггер,
+-- а у роли приложения нет прав UPDATE/DELETE. У actor_id нет внешнего ключа, чтобы запись пережила удаление пользователя
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    actor_id INTEGER, -- NULL — не вошедший пользователь или система
+    ip TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL, -- например user.login, link.create, admin.user_disable
+    target_type TEXT NOT NULL DEFAULT '',
+    target_id TEXT NOT NULL DEFAULT '',
+    before JSONB, -- состояние до изменения
+    after JSONB -- состояние после изменения
+);
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at);
+CREATE INDEX IF NOT EXISTS audit_log_actor_id_idx ON audit_log (actor_id);
+CREATE INDEX IF NOT EXISTS audit_log_target_idx ON audit_log (target_type, target_id);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
 
 -- даем нашей роли права на использование
 GRANT ALL PRIVILEGES ON TABLE users TO urlshortner;
 GRANT ALL PRIVILEGES ON TABLE urls TO urlshortner;
+GRANT ALL PRIVILEGES ON TABLE url_history TO urlshortner;
+GRANT ALL PRIVILEGES ON TABLE retired_aliases TO urlshortner;
+GRANT ALL PRIVILEGES ON TABLE folders TO urlshortner;
+GRANT ALL PRIVILEGES ON TABLE tags TO urlshortner;
+GRANT ALL PRIVILEGES ON TABLE link_tags TO urlshortner;
 GRANT ALL PRIVILEGES ON TABLE sessions TO urlshortner;
+GRANT ALL PRIVILEGES ON TABLE rate_limits TO urlshortner;
+GRANT ALL PRIVILEGES ON TABLE login_throttle TO urlshortner;
+GRANT ALL PRIVILEGES ON TABLE login_events TO urlshortner;
+GRANT ALL PRIVILEGES ON TABLE password_resets TO urlshortner;
+GRANT ALL PRIVILEGES ON TABLE recovery_codes TO urlshortner;
+GRANT ALL PRIVILEGES ON TABLE api_tokens TO urlshortner;
+GRANT ALL PRIVILEGES ON TABLE oidc_identities TO urlshortner;
+GRANT ALL PRIVILEGES ON TABLE workspaces TO urlshortner;
+GRANT ALL PRIVILEGES ON TABLE workspace_members TO urlshortner;
+GRANT ALL PRIVILEGES ON TABLE workspace_invites TO urlshortner;
+GRANT SELECT, INSERT ON TABLE audit_log TO urlshortner;
 
 GRANT USAGE, SELECT ON SEQUENCE users_id_seq TO urlshortner;
 GRANT USAGE, SELECT ON SEQUENCE urls_id_seq TO urlshortner;
+GRANT USAGE, SELECT ON SEQUENCE url_history_id_seq TO urlshortner;
+GRANT USAGE, SELECT ON SEQUENCE folders_id_seq TO urlshortner;
+GRANT USAGE, SELECT ON SEQUENCE tags_id_seq TO urlshortner;
+GRANT USAGE, SELECT ON SEQUENCE sessions_id_seq TO urlshortner;
+GRANT USAGE, SELECT ON SEQUENCE login_events_id_seq TO urlshortner;
+GRANT USAGE, SELECT ON SEQUENCE password_resets_id_seq TO urlshortner;
+GRANT USAGE, SELECT ON SEQUENCE recovery_codes_id_seq TO urlshortner;
+GRANT USAGE, SELECT ON SEQUENCE api_tokens_id_seq TO urlshortner;
+GRANT USAGE, SELECT ON SEQUENCE oidc_identities_id_seq TO urlshortner;
+GRANT USAGE, SELECT ON SEQUENCE workspaces_id_seq TO urlshortner;
+GRANT USAGE, SELECT ON SEQUENCE workspace_invites_id_seq TO urlshortner;
+GRANT USAGE, SELECT ON SEQUENCE audit_log_id_seq TO urlshortner;
@@ -0,0 +1,25 @@
+// Package audit переносит через context сведения о том, кто и откуда выполняет запрос:
+// HTTP-слой их знает, а пишет журнал аудита сервисный слой, который про HTTP не знает.
+package audit
+
+import "context"
+
+// Actor — кто выполняет действие.
+type Actor struct {
+	UserID    int64 // 0 — пользователь ещё не вошёл (регистрация, вход) или фоновая задача
+	IP        string
+	RequestID string
+}
+
+type ctxKey struct{}
+
+// WithActor возвращает контекст, в котором лежит a.
+func WithActor(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, ctxKey{}, a)
+}
+
+// ActorFromContext достаёт Actor из контекста. Если его там нет — нулевой Actor.
+func ActorFromContext(ctx context.Context) Actor {
+	a, _ := ctx.Value(ctxKey{}).(Actor)
+	return a
+}
@@ -0,0 +1,328 @@
+// Package backup описывает переносимый формат резервной копии — архив JSON Lines, не зависящий от хранилища.
+// Первая строка архива — заголовок с версией схемы, последняя — сводная статистика, по которой
+// при чтении проверяется, что архив не обрезан. Между ними — записи пользователей, пространств,
+// участников, папок, ссылок и выведенных из оборота alias, каждая на своей строке:
+//
+//	{"type":"header","data":{"schema_version":1,"created_at":"...","password_hashes":false}}
+//	{"type":"user","data":{"id":1,"mail":"a@example.com","role":"user","created_at":"..."}}
+//	{"type":"link","data":{"id":7,"alias":"docs","url":"https://...","user_id":1,"tags":["work"],"clicks":12,...}}
+//	{"type":"stats","data":{"users":1,"links":1,"clicks":12,...}}
+//
+// Читать и писать хранилище пакет не умеет: это делает сервисный слой.
+package backup
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// SchemaVersion — версия формата, которую пишет Write. Read принимает только её.
+const SchemaVersion = 1
+
+var (
+	ErrMalformed          = errors.New("malformed backup archive")
+	ErrUnsupportedVersion = errors.New("unsupported backup schema version")
+	ErrIntegrity          = errors.New("backup archive is inconsistent")
+)
+
+// Типы записей архива.
+const (
+	typeHeader    = "header"
+	typeUser      = "user"
+	typeWorkspace = "workspace"
+	typeMember    = "member"
+	typeFolder    = "folder"
+	typeLink      = "link"
+	typeRetired   = "retired_alias"
+	typeStats     = "stats"
+)
+
+// maxLineSize — предел длины одной строки архива; ссылки с заметками укладываются с большим запасом.
+const maxLineSize = 1 << 20
+
+type Header struct {
+	SchemaVersion  int       `json:"schema_version"`
+	CreatedAt      time.Time `json:"created_at"`
+	PasswordHashes bool      `json:"password_hashes"` // в архиве есть хеши паролей: хранить его как секрет
+}
+
+// User — пользователь. 2FA (зашифрованный секрет TOTP и хеши кодов восстановления) выгружается
+// только вместе с хешами паролей; привязки OIDC — всегда.
+type User struct {
+	ID             int64          `json:"id"`
+	Mail           string         `json:"mail"`
+	PasswordHash   string         `json:"password_hash,omitempty"`
+	Role           string         `json:"role"`
+	CreatedAt      time.Time      `json:"created_at"`
+	VerifiedAt     time.Time      `json:"verified_at,omitzero"`
+	DisabledAt     time.Time      `json:"disabled_at,omitzero"`
+	TOTPSecret     string         `json:"totp_secret,omitempty"`
+	TOTPEnabledAt  time.Time      `json:"totp_enabled_at,omitzero"`
+	TOTPLastStep   int64          `json:"totp_last_step,omitempty"`
+	RecoveryCodes  []string       `json:"recovery_codes,omitempty"`
+	OIDCIdentities []OIDCIdentity `json:"oidc_identities,omitempty"`
+}
+
+// OIDCIdentity — учётная запись провайдера OIDC, через которую пользователь входит.
+type OIDCIdentity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Workspace struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Member struct {
+	WorkspaceID int64     `json:"workspace_id"`
+	UserID      int64     `json:"user_id"`
+	Role        string    `json:"role"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Folder — папка пользователя или пространства: задан ровно один из UserID и WorkspaceID.
+type Folder struct {
+	ID          int64     `json:"id"`
+	UserID      int64     `json:"user_id,omitempty"`
+	WorkspaceID int64     `json:"workspace_id,omitempty"`
+	Name        string    `json:"name"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Link — ссылка с тегами и счётчиком переходов. Нулевые ID и время означают, что значения нет.
+type Link struct {
+	ID             int64     `json:"id"`
+	Alias          string    `json:"alias"`
+	URL            string    `json:"url"`
+	Title          string    `json:"title,omitempty"`
+	Notes          string    `json:"notes,omitempty"`
+	UserID         int64     `json:"user_id,omitempty"`
+	WorkspaceID    int64     `json:"workspace_id,omitempty"`
+	FolderID       int64     `json:"folder_id,omitempty"`
+	Tags           []string  `json:"tags,omitempty"`
+	Clicks         int64     `json:"clicks"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at,omitzero"`
+	ExpiresAt      time.Time `json:"expires_at,omitzero"`
+	DeletedAt      time.Time `json:"deleted_at,omitzero"`
+	TakenDownAt    time.Time `json:"taken_down_at,omitzero"`
+	TakedownReason string    `json:"takedown_reason,omitempty"`
+}
+
+// RetiredAlias — alias, который нельзя выдавать снова: прежний alias переименованной ссылки
+// (LinkID указывает на неё) или alias ссылки, стёртой из корзины.
+type RetiredAlias struct {
+	Alias     string    `json:"alias"`
+	LinkID    int64     `json:"link_id,omitempty"`
+	RetiredAt time.Time `json:"retired_at"`
+}
+
+// Stats — сводка по архиву. Число записей каждого типа служит контрольной суммой при чтении.
+type Stats struct {
+	Users          int64 `json:"users"`
+	Workspaces     int64 `json:"workspaces"`
+	Members        int64 `json:"members"`
+	Folders        int64 `json:"folders"`
+	Links          int64 `json:"links"`
+	DeletedLinks   int64 `json:"deleted_links"`
+	Tags           int64 `json:"tags"` // различных тегов с учётом владельца
+	RetiredAliases int64 `json:"retired_aliases"`
+	Clicks         int64 `json:"clicks"`
+}
+
+// Archive — содержимое резервной копии.
+type Archive struct {
+	Header         Header
+	Users          []User
+	Workspaces     []Workspace
+	Members        []Member
+	Folders        []Folder
+	Links          []Link
+	RetiredAliases []RetiredAlias
+}
+
+// Stats считает сводку по записям архива.
+func (a *Archive) Stats() Stats {
+	s := Stats{
+		Users:          int64(len(a.Users)),
+		Workspaces:     int64(len(a.Workspaces)),
+		Members:        int64(len(a.Members)),
+		Folders:        int64(len(a.Folders)),
+		Links:          int64(len(a.Links)),
+		RetiredAliases: int64(len(a.RetiredAliases)),
+	}
+	tags := make(map[tagKey]bool)
+	for _, l := range a.Links {
+		if !l.DeletedAt.IsZero() {
+			s.DeletedLinks++
+		}
+		s.Clicks += l.Clicks
+		for _, t := range l.Tags {
+			tags[newTagKey(l, t)] = true
+		}
+	}
+	s.Tags = int64(len(tags))
+	return s
+}
+
+type record struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Write пишет архив в w: заголовок с текущей версией схемы, записи и сводку.
+// Пустой Header.CreatedAt заполняется текущим временем.
+func Write(w io.Writer, a *Archive) (Stats, error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	put := func(typ string, v any) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return enc.Encode(record{Type: typ, Data: data})
+	}
+
+	a.Header.SchemaVersion = SchemaVersion
+	if a.Header.CreatedAt.IsZero() {
+		a.Header.CreatedAt = time.Now().UTC()
+	}
+	if err := put(typeHeader, a.Header); err != nil {
+		return Stats{}, err
+	}
+	for _, u := range a.Users {
+		if err := put(typeUser, u); err != nil {
+			return Stats{}, err
+		}
+	}
+	for _, ws := range a.Workspaces {
+		if err := put(typeWorkspace, ws); err != nil {
+			return Stats{}, err
+		}
+	}
+	for _, m := range a.Members {
+		if err := put(typeMember, m); err != nil {
+			return Stats{}, err
+		}
+	}
+	for _, f := range a.Folders {
+		if err := put(typeFolder, f); err != nil {
+			return Stats{}, err
+		}
+	}
+	for _, l := range a.Links {
+		if err := put(typeLink, l); err != nil {
+			return Stats{}, err
+		}
+	}
+	for _, r := range a.RetiredAliases {
+		if err := put(typeRetired, r); err != nil {
+			return Stats{}, err
+		}
+	}
+	stats := a.Stats()
+	if err := put(typeStats, stats); err != nil {
+		return Stats{}, err
+	}
+	return stats, bw.Flush()
+}
+
+// Read читает архив и проверяет его: версию схемы, что архив не обрезан (сводка в конце совпадает
+// с записями) и ссылочную целостность (см. Validate). Ошибки оборачивают ErrMalformed,
+// ErrUnsupportedVersion или ErrIntegrity.
+func Read(r io.Reader) (*Archive, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	a := &Archive{}
+	var stats *Stats
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		if stats != nil {
+			return nil, fmt.Errorf("%w: line %d: records after stats", ErrMalformed, line)
+		}
+		var rec record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrMalformed, line, err)
+		}
+		if line == 1 {
+			if rec.Type != typeHeader {
+				return nil, fmt.Errorf("%w: first line must be the header", ErrMalformed)
+			}
+			if err := decode(rec, line, &a.Header); err != nil {
+				return nil, err
+			}
+			if a.Header.SchemaVersion != SchemaVersion {
+				return nil, fmt.Errorf("%w: %d (supported: %d)", ErrUnsupportedVersion, a.Header.SchemaVersion, SchemaVersion)
+			}
+			continue
+		}
+
+		var err error
+		switch rec.Type {
+		case typeUser:
+			a.Users, err = appendDecoded(a.Users, rec, line)
+		case typeWorkspace:
+			a.Workspaces, err = appendDecoded(a.Workspaces, rec, line)
+		case typeMember:
+			a.Members, err = appendDecoded(a.Members, rec, line)
+		case typeFolder:
+			a.Folders, err = appendDecoded(a.Folders, rec, line)
+		case typeLink:
+			a.Links, err = appendDecoded(a.Links, rec, line)
+		case typeRetired:
+			a.RetiredAliases, err = appendDecoded(a.RetiredAliases, rec, line)
+		case typeStats:
+			stats = &Stats{}
+			err = decode(rec, line, stats)
+		default:
+			err = fmt.Errorf("%w: line %d: unknown record type %q", ErrMalformed, line, rec.Type)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%w: line %d: %v", ErrMalformed, line+1, err)
+	}
+	if line == 0 {
+		return nil, fmt.Errorf("%w: archive is empty", ErrMalformed)
+	}
+	if stats == nil {
+		return nil, fmt.Errorf("%w: stats record is missing, the archive is probably truncated", ErrMalformed)
+	}
+	if got := a.Stats(); got != *stats {
+		return nil, fmt.Errorf("%w: records do not match stats (got %+v, want %+v)", ErrIntegrity, got, *stats)
+	}
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func decode(rec record, line int, v any) error {
+	if err := json.Unmarshal(rec.Data, v); err != nil {
+		return fmt.Errorf("%w: line %d: invalid %s: %v", ErrMalformed, line, rec.Type, err)
+	}
+	return nil
+}
+
+func appendDecoded[T any](list []T, rec record, line int) ([]T, error) {
+	var v T
+	if err := decode(rec, line, &v); err != nil {
+		return list, err
+	}
+	return append(list, v), nil
+}
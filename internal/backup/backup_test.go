@@ -0,0 +1,150 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// testArchive — непротиворечивый архив со всеми типами записей.
+func testArchive() *Archive {
+	return &Archive{
+		Header: Header{CreatedAt: testTime, PasswordHashes: true},
+		Users: []User{
+			{
+				ID: 1, Mail: "owner@example.com", PasswordHash: "$2a$10$hash", Role: "admin", CreatedAt: testTime,
+				VerifiedAt: testTime, TOTPSecret: "encrypted-secret", TOTPEnabledAt: testTime, TOTPLastStep: 42,
+				RecoveryCodes:  []string{"code-hash-1", "code-hash-2"},
+				OIDCIdentities: []OIDCIdentity{{Issuer: "https://idp.example.com", Subject: "sub-1", CreatedAt: testTime}},
+			},
+			{ID: 2, Mail: "member@example.com", Role: "user", CreatedAt: testTime},
+		},
+		Workspaces: []Workspace{{ID: 10, Name: "Команда", CreatedAt: testTime}},
+		Members: []Member{
+			{WorkspaceID: 10, UserID: 1, Role: "owner", CreatedAt: testTime},
+			{WorkspaceID: 10, UserID: 2, Role: "editor", CreatedAt: testTime},
+		},
+		Folders: []Folder{
+			{ID: 100, UserID: 1, Name: "Личное", CreatedAt: testTime},
+			{ID: 101, WorkspaceID: 10, Name: "Общее", CreatedAt: testTime},
+		},
+		Links: []Link{
+			{ID: 1000, Alias: "docs", URL: "https://example.com/docs", UserID: 1, FolderID: 100,
+				Tags: []string{"work"}, Clicks: 12, CreatedAt: testTime},
+			{ID: 1001, Alias: "team", URL: "https://example.com/team", UserID: 2, WorkspaceID: 10, FolderID: 101,
+				Tags: []string{"work", "team"}, Clicks: 3, CreatedAt: testTime, DeletedAt: testTime},
+		},
+		RetiredAliases: []RetiredAlias{
+			{Alias: "old-docs", LinkID: 1000, RetiredAt: testTime},
+			{Alias: "purged", RetiredAt: testTime},
+		},
+	}
+}
+
+func writeArchive(t *testing.T, a *Archive) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := Write(&buf, a); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriteReadRoundTrip(t *testing.T) {
+	want := testArchive()
+	data := writeArchive(t, want)
+
+	got, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("архив после чтения отличается:\nполучили %+v\nожидали  %+v", got, want)
+	}
+	if stats := got.Stats(); stats.Links != 2 || stats.DeletedLinks != 1 || stats.Tags != 3 || stats.Clicks != 15 {
+		t.Errorf("неверная сводка: %+v", stats)
+	}
+}
+
+func TestReadRejectsDamagedArchive(t *testing.T) {
+	data := string(writeArchive(t, testArchive()))
+	lines := strings.SplitAfter(strings.TrimSuffix(data, "\n"), "\n")
+
+	tests := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{name: "пустой", data: "", err: ErrMalformed},
+		{name: "без сводки", data: strings.Join(lines[:len(lines)-1], ""), err: ErrMalformed},
+		{name: "обрезан посреди записей", data: strings.Join(lines[:3], "") + lines[len(lines)-1], err: ErrIntegrity},
+		{name: "обрезан посреди строки", data: data[:len(data)-10], err: ErrMalformed},
+		{name: "другая версия схемы", data: strings.Replace(data, `"schema_version":1`, `"schema_version":2`, 1), err: ErrUnsupportedVersion},
+		{name: "нет заголовка", data: strings.Join(lines[1:], ""), err: ErrMalformed},
+		{name: "записи после сводки", data: data + lines[1], err: ErrMalformed},
+		{name: "неизвестный тип", data: strings.Replace(data, `"type":"folder"`, `"type":"bookmark"`, 1), err: ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(strings.NewReader(tt.data)); !errors.Is(err, tt.err) {
+				t.Errorf("Read: ошибка %v, ожидалась %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsInconsistentArchive(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(a *Archive)
+	}{
+		{name: "повторный ID пользователя", modify: func(a *Archive) { a.Users[1].ID = 1 }},
+		{name: "повторный email", modify: func(a *Archive) { a.Users[1].Mail = a.Users[0].Mail }},
+		{name: "неизвестная роль", modify: func(a *Archive) { a.Users[1].Role = "root" }},
+		{name: "хеш пароля без флага в заголовке", modify: func(a *Archive) {
+			a.Header.PasswordHashes = false
+			a.Users[0].TOTPSecret, a.Users[0].TOTPEnabledAt, a.Users[0].TOTPLastStep, a.Users[0].RecoveryCodes = "", time.Time{}, 0, nil
+		}},
+		{name: "2FA без хешей паролей", modify: func(a *Archive) {
+			a.Header.PasswordHashes = false
+			a.Users[0].PasswordHash = ""
+		}},
+		{name: "неполная 2FA", modify: func(a *Archive) { a.Users[0].TOTPSecret = "" }},
+		{name: "коды восстановления без 2FA", modify: func(a *Archive) { a.Users[1].RecoveryCodes = []string{"code-hash"} }},
+		{name: "повторная привязка OIDC", modify: func(a *Archive) { a.Users[1].OIDCIdentities = a.Users[0].OIDCIdentities }},
+		{name: "участник несуществующего пространства", modify: func(a *Archive) { a.Members[1].WorkspaceID = 11 }},
+		{name: "участник — несуществующий пользователь", modify: func(a *Archive) { a.Members[1].UserID = 3 }},
+		{name: "участник дважды", modify: func(a *Archive) { a.Members[1].UserID = 1 }},
+		{name: "папка без владельца", modify: func(a *Archive) { a.Folders[0].UserID = 0 }},
+		{name: "папка двух владельцев", modify: func(a *Archive) { a.Folders[0].WorkspaceID = 10 }},
+		{name: "папка несуществующего пользователя", modify: func(a *Archive) { a.Folders[0].UserID = 3 }},
+		{name: "ссылка в чужой личной папке", modify: func(a *Archive) { a.Links[0].UserID = 2 }},
+		{name: "личная ссылка в папке пространства", modify: func(a *Archive) { a.Links[0].FolderID = 101 }},
+		{name: "ссылка в несуществующей папке", modify: func(a *Archive) { a.Links[0].FolderID = 102 }},
+		{name: "повторный alias", modify: func(a *Archive) { a.Links[1].Alias = "docs" }},
+		{name: "отрицательные переходы", modify: func(a *Archive) { a.Links[0].Clicks = -1 }},
+		{name: "выведенный alias совпадает с живым", modify: func(a *Archive) { a.RetiredAliases[1].Alias = "team" }},
+		{name: "выведенный alias несуществующей ссылки", modify: func(a *Archive) { a.RetiredAliases[0].LinkID = 1002 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testArchive()
+			tt.modify(a)
+			if err := a.Validate(); !errors.Is(err, ErrIntegrity) {
+				t.Fatalf("Validate: ошибка %v, ожидалась ErrIntegrity", err)
+			}
+			// Read проверяет то же самое
+			if _, err := Read(bytes.NewReader(writeArchive(t, a))); !errors.Is(err, ErrIntegrity) {
+				t.Errorf("Read: ошибка %v, ожидалась ErrIntegrity", err)
+			}
+		})
+	}
+	if err := testArchive().Validate(); err != nil {
+		t.Fatalf("Validate отклонил целый архив: %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	userRoles   = map[string]bool{"user": true, "admin": true}
+	memberRoles = map[string]bool{"owner": true, "editor": true, "viewer": true}
+)
+
+// tagKey — тег с учётом владельца: одинаковые имена у разных владельцев — разные теги.
+type tagKey struct {
+	userID, workspaceID int64
+	name                string
+}
+
+// newTagKey возвращает ключ тега name ссылки l. Владелец тега — пространство ссылки, а у личной ссылки — её автор.
+func newTagKey(l Link, name string) tagKey {
+	if l.WorkspaceID != 0 {
+		return tagKey{workspaceID: l.WorkspaceID, name: strings.ToLower(name)}
+	}
+	return tagKey{userID: l.UserID, name: strings.ToLower(name)}
+}
+
+// Validate проверяет ссылочную целостность архива: уникальность ID, email и alias, что участники,
+// папки и ссылки ссылаются на существующие записи и что ссылка лежит в папке своего владельца.
+func (a *Archive) Validate() error {
+	type identityKey struct{ issuer, subject string }
+	users := make(map[int64]bool, len(a.Users))
+	mails := make(map[string]bool, len(a.Users))
+	identities := make(map[identityKey]bool)
+	for _, u := range a.Users {
+		hasTOTP := u.TOTPSecret != "" || !u.TOTPEnabledAt.IsZero() || u.TOTPLastStep != 0 || len(u.RecoveryCodes) > 0
+		switch {
+		case u.ID <= 0 || users[u.ID]:
+			return integrityError("user %d: invalid or duplicate id", u.ID)
+		case u.Mail == "" || mails[u.Mail]:
+			return integrityError("user %d: empty or duplicate mail %q", u.ID, u.Mail)
+		case !userRoles[u.Role]:
+			return integrityError("user %d: unknown role %q", u.ID, u.Role)
+		case u.PasswordHash != "" && !a.Header.PasswordHashes:
+			return integrityError("user %d: password hash in an archive exported without hashes", u.ID)
+		case hasTOTP && !a.Header.PasswordHashes:
+			return integrityError("user %d: 2fa state in an archive exported without hashes", u.ID)
+		case hasTOTP && (u.TOTPSecret == "" || u.TOTPEnabledAt.IsZero()):
+			return integrityError("user %d: incomplete 2fa state", u.ID)
+		}
+		for _, o := range u.OIDCIdentities {
+			key := identityKey{o.Issuer, o.Subject}
+			if o.Issuer == "" || o.Subject == "" || identities[key] {
+				return integrityError("user %d: empty or duplicate oidc identity %q at %q", u.ID, o.Subject, o.Issuer)
+			}
+			identities[key] = true
+		}
+		users[u.ID] = true
+		mails[u.Mail] = true
+	}
+
+	workspaces := make(map[int64]bool, len(a.Workspaces))
+	for _, w := range a.Workspaces {
+		if w.ID <= 0 || workspaces[w.ID] {
+			return integrityError("workspace %d: invalid or duplicate id", w.ID)
+		}
+		workspaces[w.ID] = true
+	}
+
+	type memberKey struct{ workspaceID, userID int64 }
+	members := make(map[memberKey]bool, len(a.Members))
+	for _, m := range a.Members {
+		key := memberKey{m.WorkspaceID, m.UserID}
+		switch {
+		case !workspaces[m.WorkspaceID]:
+			return integrityError("member %d: workspace %d does not exist", m.UserID, m.WorkspaceID)
+		case !users[m.UserID]:
+			return integrityError("member of workspace %d: user %d does not exist", m.WorkspaceID, m.UserID)
+		case members[key]:
+			return integrityError("user %d is a member of workspace %d twice", m.UserID, m.WorkspaceID)
+		case !memberRoles[m.Role]:
+			return integrityError("member %d of workspace %d: unknown role %q", m.UserID, m.WorkspaceID, m.Role)
+		}
+		members[key] = true
+	}
+
+	folders := make(map[int64]Folder, len(a.Folders))
+	for _, f := range a.Folders {
+		if _, ok := folders[f.ID]; f.ID <= 0 || ok {
+			return integrityError("folder %d: invalid or duplicate id", f.ID)
+		}
+		if (f.UserID == 0) == (f.WorkspaceID == 0) {
+			return integrityError("folder %d: must belong to either a user or a workspace", f.ID)
+		}
+		if err := checkOwner(users, workspaces, f.UserID, f.WorkspaceID); err != nil {
+			return integrityError("folder %d: %v", f.ID, err)
+		}
+		folders[f.ID] = f
+	}
+
+	links := make(map[int64]bool, len(a.Links))
+	aliases := make(map[string]bool, len(a.Links)+len(a.RetiredAliases))
+	for _, l := range a.Links {
+		switch {
+		case l.ID <= 0 || links[l.ID]:
+			return integrityError("link %q: invalid or duplicate id %d", l.Alias, l.ID)
+		case l.Alias == "" || aliases[l.Alias]:
+			return integrityError("link %d: empty or duplicate alias %q", l.ID, l.Alias)
+		case l.URL == "":
+			return integrityError("link %q: empty url", l.Alias)
+		case l.Clicks < 0:
+			return integrityError("link %q: negative clicks", l.Alias)
+		case len(l.Tags) > 0 && l.UserID == 0 && l.WorkspaceID == 0:
+			return integrityError("link %q: tags on a link without owner", l.Alias)
+		}
+		if err := checkOwner(users, workspaces, l.UserID, l.WorkspaceID); err != nil {
+			return integrityError("link %q: %v", l.Alias, err)
+		}
+		if l.FolderID != 0 {
+			f, ok := folders[l.FolderID]
+			if !ok {
+				return integrityError("link %q: folder %d does not exist", l.Alias, l.FolderID)
+			}
+			if f.WorkspaceID != l.WorkspaceID || (f.WorkspaceID == 0 && f.UserID != l.UserID) {
+				return integrityError("link %q: folder %d belongs to another owner", l.Alias, l.FolderID)
+			}
+		}
+		for _, t := range l.Tags {
+			if strings.TrimSpace(t) == "" {
+				return integrityError("link %q: empty tag", l.Alias)
+			}
+		}
+		links[l.ID] = true
+		aliases[l.Alias] = true
+	}
+
+	for _, r := range a.RetiredAliases {
+		if r.Alias == "" || aliases[r.Alias] {
+			return integrityError("retired alias %q: empty or already used", r.Alias)
+		}
+		if r.LinkID != 0 && !links[r.LinkID] {
+			return integrityError("retired alias %q: link %d does not exist", r.Alias, r.LinkID)
+		}
+		aliases[r.Alias] = true
+	}
+	return nil
+}
+
+// checkOwner проверяет, что пользователь и пространство владельца (0 — не задан) есть в архиве.
+func checkOwner(users, workspaces map[int64]bool, userID, workspaceID int64) error {
+	if userID != 0 && !users[userID] {
+		return fmt.Errorf("user %d does not exist", userID)
+	}
+	if workspaceID != 0 && !workspaces[workspaceID] {
+		return fmt.Errorf("workspace %d does not exist", workspaceID)
+	}
+	return nil
+}
+
+func integrityError(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrIntegrity, fmt.Sprintf(format, args...))
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"encoding/json"
 	"log"
+	"log/slog"
 	"os"
 )
 
@@ -10,12 +11,26 @@ type Config struct {
 	Env        string     `json:"env"`
 	HTTPServer HTTPServer `json:"http_server"`
 	Storage    Storage    `json:"storage"`
+	RateLimit  RateLimit  `json:"rate_limit"`
+	Auth       Auth       `json:"auth"`
+	Mail       Mail       `json:"mail"`
+	OIDC       OIDC       `json:"oidc"`
+	Links      Links      `json:"links"`
+
+	SecurityHeaders SecurityHeaders `json:"security_headers"`
+
+	// фрагменты ключей атрибутов логов, значения которых маскируются (дополнительно к logging.DefaultSensitiveKeys)
+	LogRedactKeys []string `json:"log_redact_keys"`
 }
 
 type HTTPServer struct {
 	Address     string `json:"address"`
 	Timeout     int    `json:"timeout"`      // время ожидания ответа от сервера (секунды)
 	IdleTimeout int    `json:"idle_timeout"` // время ожидания закрытия соединения (секунды)
+	// время на завершение активных запросов при остановке (секунды)
+	ShutdownTimeout int `json:"shutdown_timeout"`
+	// сколько /readyz отвечает 503 перед закрытием listener, чтобы балансировщик успел снять инстанс (секунды)
+	ShutdownDrainSeconds int `json:"shutdown_drain_seconds"`
 }
 
 type Storage struct {
@@ -27,6 +42,129 @@ type Storage struct {
 	ServerPort string `json:"server_port"`
 }
 
+// RateLimit — настройки ограничения частоты запросов.
+type RateLimit struct {
+	Backend string `json:"backend"` // "memory" (один инстанс) или "postgres" (общие лимиты для нескольких инстансов)
+	// политики по группам маршрутов: "redirect", "shorten", "login"
+	Policies map[string]RateLimitPolicy `json:"policies"`
+}
+
+type RateLimitPolicy struct {
+	RequestsPerMinute int    `json:"requests_per_minute"` // скорость пополнения ведра
+	Burst             int    `json:"burst"`               // ёмкость ведра
+	Key               string `json:"key"`                 // по чему считаем лимит: "ip", "user" или "api_key"
+}
+
+// Auth — настройки входа и защиты аккаунтов.
+type Auth struct {
+	Lockout        Lockout        `json:"lockout"`
+	PasswordPolicy PasswordPolicy `json:"password_policy"`
+	// ключ для подписи токенов в ссылках из писем, берётся из переменной окружения APP_SECRET
+	Secret string `json:"-"`
+	// сколько часов действует ссылка подтверждения email
+	VerificationTTLHours int `json:"verification_ttl_hours"`
+	// сколько минут действует ссылка сброса пароля
+	ResetTTLMinutes int `json:"reset_ttl_minutes"`
+	// требовать двухфакторную аутентификацию от всех пользователей
+	Require2FA bool    `json:"require_2fa"`
+	Session    Session `json:"session"`
+	// email-адреса, которым при старте выдаётся роль администратора
+	Admins []string `json:"admins"`
+}
+
+// Session — сроки жизни сессий.
+type Session struct {
+	LifetimeHours        int `json:"lifetime_hours"`         // сессия истекает после стольких часов бездействия
+	RememberDays         int `json:"remember_days"`          // то же, если при входе отмечено "запомнить меня"
+	MaxLifetimeDays      int `json:"max_lifetime_days"`      // абсолютный предел с момента входа
+	RenewIntervalMinutes int `json:"renew_interval_minutes"` // как часто продлевать сессию при активности
+}
+
+// Mail — настройки отправки писем.
+type Mail struct {
+	Driver string `json:"driver"` // "smtp", "file" (письма складываются в Dir) или "log"
+	From   string `json:"from"`
+	Dir    string `json:"dir"`
+	SMTP   SMTP   `json:"smtp"`
+}
+
+type SMTP struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"-"` // из переменной окружения SMTP_PASSWORD
+}
+
+// Links — настройки работы со ссылками.
+type Links struct {
+	// сколько дней удалённая ссылка лежит в корзине, прежде чем её сотрут навсегда (0 — 30 дней)
+	TrashRetentionDays int       `json:"trash_retention_days"`
+	URLPolicy          URLPolicy `json:"url_policy"`
+}
+
+// URLPolicy — проверка и нормализация адресов назначения. Пустая секция — только http(s), до 2048 символов,
+// без ссылок на localhost и частные сети; адреса, в которые резолвится имя, тоже проверяются.
+type URLPolicy struct {
+	AllowedSchemes    []string `json:"allowed_schemes"`     // пусто — http и https
+	MaxLength         int      `json:"max_length"`          // 0 — 2048
+	StripTracking     bool     `json:"strip_tracking"`      // убирать utm_*, fbclid, gclid и т. п.
+	TrackingParams    []string `json:"tracking_params"`     // дополнительные трекинговые параметры
+	AllowPrivateHosts bool     `json:"allow_private_hosts"` // разрешить localhost и частные сети
+	ResolveHosts      bool     `json:"resolve_hosts"`       // проверять адреса, в которые резолвится хост (по умолчанию true)
+}
+
+// SecurityHeaders — заголовки безопасности в ответах.
+type SecurityHeaders struct {
+	HSTSMaxAgeSeconds     int    `json:"hsts_max_age_seconds"` // 0 — не отправлять HSTS (включать только за HTTPS)
+	HSTSIncludeSubdomains bool   `json:"hsts_include_subdomains"`
+	ReferrerPolicy        string `json:"referrer_policy"`
+	PermissionsPolicy     string `json:"permissions_policy"`
+	CSPReportURI          string `json:"csp_report_uri"`
+}
+
+// OIDC — вход через корпоративного провайдера OpenID Connect.
+type OIDC struct {
+	Enabled      bool     `json:"enabled"`
+	Name         string   `json:"name"`   // название провайдера на кнопке входа
+	Issuer       string   `json:"issuer"` // адрес провайдера, по нему ищется /.well-known/openid-configuration
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"-"`            // из переменной окружения OIDC_CLIENT_SECRET
+	RedirectURL  string   `json:"redirect_url"` // полный адрес /login/oidc/callback, зарегистрированный у провайдера
+	Scopes       []string `json:"scopes"`       // openid добавляется всегда; для email нужен scope "email"
+	AllowSignup  bool     `json:"allow_signup"` // создавать пользователя при первом входе
+}
+
+// PasswordPolicy — требования к паролю при регистрации и смене пароля.
+type PasswordPolicy struct {
+	MinLength       int     `json:"min_length"`
+	MaxLength       int     `json:"max_length"`
+	MinCharClasses  int     `json:"min_char_classes"` // из: строчные, заглавные, цифры, прочие
+	DenyCommon      bool    `json:"deny_common"`      // встроенный список распространённых паролей
+	DenyEmailAlike  bool    `json:"deny_email_alike"`
+	MaxEmailSimilar float64 `json:"max_email_similarity"` // 0..1, доля совпадения с email
+}
+
+// Lockout — прогрессивная задержка и временная блокировка после неудачных входов.
+type Lockout struct {
+	FreeAttempts     int `json:"free_attempts"`      // неудачи без задержки
+	BaseDelay        int `json:"base_delay_seconds"` // первая задержка, дальше удваивается (секунды)
+	MaxDelay         int `json:"max_delay_seconds"`
+	AccountThreshold int `json:"account_threshold"` // неудач до блокировки аккаунта
+	IPThreshold      int `json:"ip_threshold"`      // неудач до блокировки IP
+	LockoutMinutes   int `json:"lockout_minutes"`   // длительность блокировки (минуты)
+	WindowMinutes    int `json:"window_minutes"`    // окно, в котором считаются неудачи (минуты)
+}
+
+// LogValue не даёт паролю от БД попасть в лог, когда Storage логируется целиком.
+func (s Storage) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("db_host", s.DBHost),
+		slog.String("db_port", s.DBPort),
+		slog.String("db_user", s.DBUser),
+		slog.String("db_name", s.DBName),
+	)
+}
+
 // MustLoad читает путь к файлу конфига из переменной окружения CONFIG_PATH,
 // парсит JSON и возвращает указатель на Config.
 // В случае ошибки — завершает работу с логом.
@@ -53,7 +191,8 @@ func MustLoad() *Config {
 		log.Fatalf("error reading config file: %v", err)
 	}
 
-	var cfg Config
+	// ключи, которых нет в файле, сохраняют эти значения
+	cfg := Config{Links: Links{URLPolicy: URLPolicy{ResolveHosts: true}}}
 	if err := json.Unmarshal(data, &cfg); err != nil {
 		log.Fatalf("failed to parse config JSON: %v", err)
 	}
@@ -68,5 +207,18 @@ func MustLoad() *Config {
 		}
 	}
 
+	if secret, exists := os.LookupEnv("APP_SECRET"); exists {
+		cfg.Auth.Secret = secret
+	} else {
+		if cfg.Env == "local" {
+			cfg.Auth.Secret = "local-insecure-secret"
+		} else {
+			log.Fatal("APP_SECRET environment variable is not set ")
+		}
+	}
+
+	cfg.Mail.SMTP.Password = os.Getenv("SMTP_PASSWORD")
+	cfg.OIDC.ClientSecret = os.Getenv("OIDC_CLIENT_SECRET")
+
 	return &cfg
 }
@@ -0,0 +1,63 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// bitlyColumns — колонки CSV-выгрузки из кабинета Bitly.
+var bitlyColumns = columns{
+	alias:   []string{"bitlink", "link", "short link", "short url"},
+	url:     []string{"long url", "long_url", "destination url", "original url"},
+	title:   []string{"title"},
+	tags:    []string{"tags"},
+	created: []string{"created", "created_at", "date created", "creation date"},
+	clicks:  []string{"clicks", "total clicks", "engagements", "total engagements"},
+}
+
+// bitlyLink — ссылка из API Bitly v4 (GET /v4/groups/{group}/bitlinks).
+// Число переходов API отдаёт отдельно; поле clicks берём, если его добавил скрипт выгрузки.
+type bitlyLink struct {
+	ID             string          `json:"id"` // bit.ly/abc
+	Link           string          `json:"link"`
+	CustomBitlinks []string        `json:"custom_bitlinks"`
+	LongURL        string          `json:"long_url"`
+	Title          string          `json:"title"`
+	Tags           []string        `json:"tags"`
+	CreatedAt      string          `json:"created_at"`
+	Clicks         json.RawMessage `json:"clicks"` // число или строка; ошибка в нём не должна ломать весь файл
+}
+
+// parseBitlyJSON читает ответ API {"links": [...]} или массив ссылок. Если у ссылки есть собственный
+// (custom) bitlink, alias берётся из него.
+func parseBitlyJSON(data []byte) ([]Record, error) {
+	var links []bitlyLink
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &links); err != nil {
+			return nil, fmt.Errorf("invalid bitly json: %w", err)
+		}
+	} else {
+		var resp struct {
+			Links []bitlyLink `json:"links"`
+		}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, fmt.Errorf("invalid bitly json: %w", err)
+		}
+		links = resp.Links
+	}
+
+	records := make([]Record, 0, len(links))
+	for i, l := range links {
+		short := l.ID
+		if len(l.CustomBitlinks) > 0 {
+			short = l.CustomBitlinks[0]
+		} else if short == "" {
+			short = l.Link
+		}
+		rec := Record{Line: i + 1, Alias: aliasFromLink(short), URL: l.LongURL, Title: l.Title, Tags: l.Tags}
+		rec.parseStats(l.CreatedAt, strings.Trim(string(l.Clicks), `"`))
+		records = append(records, rec)
+	}
+	return records, nil
+}
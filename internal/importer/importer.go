@@ -0,0 +1,178 @@
+// Package importer читает выгрузки ссылок из других сокращателей (YOURLS, Bitly) и приводит их
+// к общему виду Record. Сохраняет записи сервисный слой: он же решает, что делать с занятыми alias.
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Форматы выгрузок.
+const (
+	FormatYOURLS = "yourls"
+	FormatBitly  = "bitly"
+)
+
+// Formats — поддерживаемые форматы в порядке показа в интерфейсе.
+var Formats = []string{FormatYOURLS, FormatBitly}
+
+var (
+	ErrUnknownFormat = errors.New("unknown import format")
+	ErrInvalidDate   = errors.New("unrecognized date")
+	ErrInvalidClicks = errors.New("invalid click count")
+)
+
+// Record — ссылка из выгрузки.
+type Record struct {
+	Line      int // номер записи в файле, с 1 (для CSV без учёта заголовка)
+	Alias     string
+	URL       string
+	Title     string
+	Tags      []string
+	CreatedAt time.Time // нулевое время — в выгрузке не было
+	Clicks    int64
+	Err       error // запись не разобрать (дата, число переходов): её пропускают, остальные импортируются
+}
+
+// Parse читает выгрузку формата format. CSV или JSON определяется по содержимому.
+func Parse(format string, r io.Reader) ([]Record, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read export: %w", err)
+	}
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("\xef\xbb\xbf")) // BOM от Excel
+	isJSON := len(data) > 0 && (data[0] == '{' || data[0] == '[')
+
+	switch format {
+	case FormatYOURLS:
+		if isJSON {
+			return parseYOURLSJSON(data)
+		}
+		return parseCSV(data, yourlsColumns)
+	case FormatBitly:
+		if isJSON {
+			return parseBitlyJSON(data)
+		}
+		return parseCSV(data, bitlyColumns)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// columns сопоставляет полям Record возможные названия колонок CSV (в нижнем регистре).
+type columns struct {
+	alias, url, title, tags, created, clicks []string
+}
+
+// parseCSV читает CSV с заголовком; колонки ищутся по названиям из cols.
+func parseCSV(data []byte, cols columns) ([]Record, error) {
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv: %w", err)
+	}
+	index := make(map[string]int, len(header))
+	for i, h := range header {
+		index[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	find := func(names []string) int {
+		for _, n := range names {
+			if i, ok := index[n]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+	aliasCol, urlCol := find(cols.alias), find(cols.url)
+	if aliasCol < 0 || urlCol < 0 {
+		return nil, fmt.Errorf("csv header must contain %q and %q columns", cols.alias[0], cols.url[0])
+	}
+	titleCol, tagsCol, createdCol, clicksCol := find(cols.title), find(cols.tags), find(cols.created), find(cols.clicks)
+
+	var records []Record
+	for line := 1; ; line++ {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid csv: %w", err)
+		}
+		cell := func(i int) string {
+			if i < 0 || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+		rec := Record{Line: line, Alias: aliasFromLink(cell(aliasCol)), URL: cell(urlCol), Title: cell(titleCol)}
+		if tags := cell(tagsCol); tags != "" {
+			rec.Tags = strings.Split(tags, ",")
+		}
+		rec.parseStats(cell(createdCol), cell(clicksCol))
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// parseStats заполняет дату создания и число переходов; ошибку запоминает в rec.Err.
+func (rec *Record) parseStats(created, clicks string) {
+	var err error
+	if rec.CreatedAt, err = parseTime(created); err != nil {
+		rec.Err = err
+		return
+	}
+	if rec.Clicks, err = parseClicks(clicks); err != nil {
+		rec.Err = err
+	}
+}
+
+// aliasFromLink достаёт alias из короткой ссылки: «https://bit.ly/abc», «bit.ly/abc» и «abc» дают «abc».
+func aliasFromLink(s string) string {
+	s = strings.TrimRight(s, "/")
+	if i := strings.LastIndexByte(s, '/'); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
+
+// timeLayouts — форматы дат, которые встречаются в выгрузках.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05-0700", // Bitly API
+	"2006-01-02 15:04:05",      // YOURLS, время сервера
+	"2006-01-02 15:04:05 MST",
+	time.DateOnly,
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	if unix, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("%w %q", ErrInvalidDate, s)
+}
+
+func parseClicks(s string) (int64, error) {
+	if s == "" || s == "null" { // в JSON поле может быть null
+
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(strings.ReplaceAll(s, ",", ""), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%w %q", ErrInvalidClicks, s)
+	}
+	return n, nil
+}
@@ -0,0 +1,75 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// yourlsColumns — колонки таблицы yourls_url, как их выгружают плагины экспорта и phpMyAdmin.
+var yourlsColumns = columns{
+	alias:   []string{"keyword", "shorturl"},
+	url:     []string{"url", "longurl"},
+	title:   []string{"title"},
+	created: []string{"timestamp", "date"},
+	clicks:  []string{"clicks"},
+}
+
+// yourlsLink — ссылка в ответе API YOURLS (action=stats) или в массиве строк таблицы.
+type yourlsLink struct {
+	Keyword   string          `json:"keyword"`
+	ShortURL  string          `json:"shorturl"`
+	URL       string          `json:"url"`
+	Title     string          `json:"title"`
+	Timestamp string          `json:"timestamp"`
+	Clicks    json.RawMessage `json:"clicks"` // YOURLS отдаёт числа строками
+}
+
+// parseYOURLSJSON читает ответ API {"links": {"link_1": {...}, ...}} или массив объектов.
+func parseYOURLSJSON(data []byte) ([]Record, error) {
+	var links []yourlsLink
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &links); err != nil {
+			return nil, fmt.Errorf("invalid yourls json: %w", err)
+		}
+	} else {
+		var resp struct {
+			Links map[string]yourlsLink `json:"links"`
+		}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, fmt.Errorf("invalid yourls json: %w", err)
+		}
+		if resp.Links == nil {
+			return nil, errors.New(`yourls json must contain "links"`)
+		}
+		// ключи link_1, link_2, ... — сохраняем их порядок
+		keys := make([]string, 0, len(resp.Links))
+		for k := range resp.Links {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return linkKeyNumber(keys[i]) < linkKeyNumber(keys[j]) })
+		for _, k := range keys {
+			links = append(links, resp.Links[k])
+		}
+	}
+
+	records := make([]Record, 0, len(links))
+	for i, l := range links {
+		alias := l.Keyword
+		if alias == "" {
+			alias = aliasFromLink(l.ShortURL)
+		}
+		rec := Record{Line: i + 1, Alias: alias, URL: l.URL, Title: l.Title}
+		rec.parseStats(l.Timestamp, strings.Trim(string(l.Clicks), `"`))
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func linkKeyNumber(key string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(key, "link_"))
+	return n
+}
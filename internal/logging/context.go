@@ -0,0 +1,24 @@
+// Package logging содержит общие для всех слоёв вещи, связанные с логированием:
+// логгер, привязанный к запросу, и передачу его через context.
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+type ctxKey struct{}
+
+// WithLogger возвращает контекст, в котором лежит логгер l.
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext достаёт логгер запроса из контекста.
+// Если логгера там нет (фоновые задачи, тесты) — возвращает slog.Default().
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// RedactedValue — то, что попадает в лог вместо секрета.
+const RedactedValue = "[REDACTED]"
+
+// DefaultSensitiveKeys — фрагменты ключей атрибутов, значения которых никогда не должны попадать в лог:
+// "token" закрывает и api_token, и reset_token, "hash" — password_hash и code_hash.
+var DefaultSensitiveKeys = []string{
+	"password",
+	"secret",
+	"token",
+	"hash",
+	"cookie",
+	"authorization",
+}
+
+// Secret — строка, которая при логировании всегда маскируется,
+// под каким бы ключом её ни передали.
+type Secret string
+
+// LogValue реализует slog.LogValuer.
+func (Secret) LogValue() slog.Value {
+	return slog.StringValue(RedactedValue)
+}
+
+// String защищает от случайной печати через fmt.
+func (Secret) String() string {
+	return RedactedValue
+}
+
+// RedactHandler — обёртка над slog.Handler, которая маскирует значения атрибутов, ключ которых
+// содержит один из заданных фрагментов (без учёта регистра), в том числе внутри групп.
+type RedactHandler struct {
+	next slog.Handler
+	keys []string // фрагменты в нижнем регистре
+}
+
+// NewRedactHandler оборачивает next. Если keys пуст — используются DefaultSensitiveKeys.
+func NewRedactHandler(next slog.Handler, keys []string) *RedactHandler {
+	if len(keys) == 0 {
+		keys = DefaultSensitiveKeys
+	}
+	lower := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if k = strings.ToLower(k); k != "" {
+			lower = append(lower, k)
+		}
+	}
+	return &RedactHandler{next: next, keys: lower}
+}
+
+func (h *RedactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *RedactHandler) Handle(ctx context.Context, r slog.Record) error {
+	nr := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		nr.AddAttrs(h.redact(a))
+		return true
+	})
+	return h.next.Handle(ctx, nr)
+}
+
+func (h *RedactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = h.redact(a)
+	}
+	return &RedactHandler{next: h.next.WithAttrs(redacted), keys: h.keys}
+}
+
+func (h *RedactHandler) WithGroup(name string) slog.Handler {
+	return &RedactHandler{next: h.next.WithGroup(name), keys: h.keys}
+}
+
+// sensitive сообщает, что в ключе есть один из фрагментов: "API_Token" и "reset_token" совпадают с "token".
+func (h *RedactHandler) sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range h.keys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *RedactHandler) redact(a slog.Attr) slog.Attr {
+	if h.sensitive(a.Key) {
+		return slog.String(a.Key, RedactedValue)
+	}
+	// Resolve вызывает LogValue у LogValuer-ов (например, Secret) до того, как значение уйдёт дальше
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		group := v.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			redacted[i] = h.redact(ga)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
@@ -0,0 +1,54 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"url-shorter/internal/logging"
+)
+
+// FileMailer складывает письма в каталог в виде .eml файлов — удобно для локальной разработки.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	name := fmt.Sprintf("%s_%s.eml", time.Now().Format("20060102T150405.000000000"), sanitizeFileName(msg.To))
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, format(m.from, msg), 0o600); err != nil {
+		return fmt.Errorf("failed to write mail file: %w", err)
+	}
+	logging.FromContext(ctx).Info("mail written to file", "to", msg.To, "subject", msg.Subject, "path", path)
+	return nil
+}
+
+func sanitizeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '@':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// LogMailer только отмечает в логе, кому и о чём ушло письмо. Тело не пишется: в нём ссылки
+// с токенами подтверждения, сброса пароля и приглашений, а маскирование по ключам внутри
+// свободного текста их не найдёт. Прочитать письма локально можно через FileMailer.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	logging.FromContext(ctx).Info("mail", "to", msg.To, "subject", msg.Subject, "body", logging.Secret(msg.Body))
+	return nil
+}
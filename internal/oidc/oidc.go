@@ -0,0 +1,116 @@
+// Package oidc — вход через внешнего провайдера OpenID Connect (authorization code + PKCE).
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var ErrNonceMismatch = errors.New("id token nonce mismatch")
+
+// Config — параметры клиента, зарегистрированного у провайдера.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string   // адрес нашего /login/oidc/callback
+	Scopes       []string // openid добавляется всегда
+}
+
+// Identity — проверенные утверждения из ID-токена.
+type Identity struct {
+	Issuer        string
+	Subject       string // постоянный идентификатор пользователя у провайдера
+	Email         string
+	EmailVerified bool
+}
+
+// Provider ходит к провайдеру: строит ссылку на вход и обменивает код на проверенный ID-токен.
+type Provider struct {
+	oauth    oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+}
+
+// NewProvider загружает discovery-документ issuer'а (/.well-known/openid-configuration).
+func NewProvider(ctx context.Context, cfg Config) (*Provider, error) {
+	p, err := gooidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover oidc provider: %w", err)
+	}
+	scopes := []string{gooidc.ScopeOpenID}
+	for _, s := range cfg.Scopes {
+		if s != gooidc.ScopeOpenID {
+			scopes = append(scopes, s)
+		}
+	}
+	return &Provider{
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     p.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier: p.Verifier(&gooidc.Config{ClientID: cfg.ClientID}),
+	}, nil
+}
+
+// AuthCodeURL возвращает адрес страницы входа провайдера.
+// verifier — PKCE code verifier, в запрос уходит только его S256-хеш.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	return p.oauth.AuthCodeURL(state, gooidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+// Exchange обменивает код авторизации на токены, проверяет подпись, аудиторию и срок ID-токена,
+// а также совпадение nonce с тем, что был отправлен в AuthCodeURL.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Identity, error) {
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return Identity{}, errors.New("token response has no id_token")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to verify id token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return Identity{}, ErrNonceMismatch
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return Identity{}, fmt.Errorf("failed to parse id token claims: %w", err)
+	}
+	return Identity{
+		Issuer:        idToken.Issuer,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+	}, nil
+}
+
+// NewVerifier генерирует PKCE code verifier.
+func NewVerifier() string {
+	return oauth2.GenerateVerifier()
+}
+
+// RandomString — случайное значение для state и nonce.
+func RandomString() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval — как часто память чистится от вёдер, которые уже снова полны.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	policy  Policy
+}
+
+// MemoryLimiter хранит вёдра в памяти процесса. Подходит для одного инстанса.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (l *MemoryLimiter) Allow(_ context.Context, key string, p Policy) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(p.Burst), updated: now, policy: p}
+		l.buckets[key] = b
+	}
+	b.tokens = refill(p, b.tokens, now.Sub(b.updated))
+	b.updated = now
+	b.policy = p
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return newResult(p, allowed, b.tokens), nil
+}
+
+// sweep удаляет полные вёдра: они ничем не отличаются от отсутствующих.
+func (l *MemoryLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if refill(b.policy, b.tokens, now.Sub(b.updated)) >= float64(b.policy.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,36 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// BucketStore — хранилище вёдер, общее для всех инстансов (таблица rate_limits).
+// TakeToken должен атомарно пополнить ведро, забрать токен, если он есть,
+// и вернуть, удалось ли это, и сколько токенов осталось.
+type BucketStore interface {
+	TakeToken(ctx context.Context, key string, ratePerSec float64, burst int) (bool, float64, error)
+	DeleteStaleBuckets(ctx context.Context, olderThan time.Time) error
+}
+
+// PostgresLimiter хранит вёдра в БД, поэтому лимиты общие для нескольких инстансов.
+type PostgresLimiter struct {
+	store BucketStore
+}
+
+func NewPostgresLimiter(s BucketStore) *PostgresLimiter {
+	return &PostgresLimiter{store: s}
+}
+
+func (l *PostgresLimiter) Allow(ctx context.Context, key string, p Policy) (Result, error) {
+	allowed, tokens, err := l.store.TakeToken(ctx, key, p.rate(), p.Burst)
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(p, allowed, tokens), nil
+}
+
+// Cleanup удаляет вёдра, которые не трогали дольше maxIdle.
+func (l *PostgresLimiter) Cleanup(ctx context.Context, maxIdle time.Duration) error {
+	return l.store.DeleteStaleBuckets(ctx, time.Now().Add(-maxIdle))
+}
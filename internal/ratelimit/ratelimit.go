@@ -0,0 +1,64 @@
+// Package ratelimit реализует ограничение частоты запросов по алгоритму token bucket.
+// Ведро ёмкостью Burst пополняется со скоростью RequestsPerMinute/60 токенов в секунду,
+// каждый запрос забирает один токен.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Способы выбора ключа, по которому считается лимит.
+const (
+	KeyIP     = "ip"
+	KeyUser   = "user"
+	KeyAPIKey = "api_key"
+)
+
+// Policy — лимит для группы маршрутов.
+type Policy struct {
+	RequestsPerMinute int
+	Burst             int
+	Key               string // KeyIP, KeyUser или KeyAPIKey
+}
+
+func (p Policy) rate() float64 {
+	return float64(p.RequestsPerMinute) / 60
+}
+
+// Result — итог попытки забрать токен, из него строятся заголовки ответа.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // через сколько появится следующий токен (если запрос отклонён)
+	Reset      time.Duration // через сколько ведро наполнится полностью
+}
+
+// Limiter — бэкенд лимитов. key уже содержит имя политики и идентификатор клиента.
+type Limiter interface {
+	Allow(ctx context.Context, key string, p Policy) (Result, error)
+}
+
+// newResult считает Result по числу токенов, оставшихся в ведре после попытки.
+func newResult(p Policy, allowed bool, tokens float64) Result {
+	rate := p.rate()
+	res := Result{
+		Allowed:   allowed,
+		Limit:     p.Burst,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+	}
+	if rate > 0 {
+		res.Reset = time.Duration((float64(p.Burst) - tokens) / rate * float64(time.Second))
+		if !allowed {
+			res.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+		}
+	}
+	return res
+}
+
+// refill возвращает количество токенов спустя elapsed после последнего обновления.
+func refill(p Policy, tokens float64, elapsed time.Duration) float64 {
+	return math.Min(float64(p.Burst), tokens+elapsed.Seconds()*p.rate())
+}
@@ -0,0 +1,355 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/service"
+	"url-shorter/internal/store"
+)
+
+// AdminService определяет контракт сервиса админки.
+type AdminService interface {
+	SearchUsers(ctx context.Context, query string) ([]store.User, error)
+	DisableUser(ctx context.Context, actorID, userID int64) error
+	EnableUser(ctx context.Context, userID int64) error
+	SearchLinks(ctx context.Context, query string) ([]store.Link, error)
+	TakeDownLink(ctx context.Context, linkID int64, reason string) error
+	RestoreLink(ctx context.Context, linkID int64) error
+	Stats(ctx context.Context) (store.Stats, error)
+	AuditEvents(ctx context.Context, f store.AuditFilter) ([]store.AuditEvent, error)
+	LoginEvents(ctx context.Context, f store.LoginEventFilter) ([]store.LoginEvent, error)
+	LoginLocks(ctx context.Context) ([]store.LoginLock, error)
+}
+
+// RequireAdminMiddleware пускает дальше только администраторов. Ставится после AuthMiddleware:
+// роль проверяется по БД на каждый запрос, чтобы снятие прав действовало сразу.
+// API-токены в админку не пускаем — только браузерная сессия.
+func (s *Server) RequireAdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requireSession(w, r) {
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		user, err := s.userService.GetUser(r.Context(), userID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to get user", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		if !user.IsAdmin() {
+			logging.FromContext(r.Context()).Warn("доступ в админку без прав", "user_id", userID, "path", r.URL.Path)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminRoutes — роутер админки, монтируется под /admin/.
+func (s *Server) adminRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/{$}", s.handleAdminDashboard())
+	mux.HandleFunc("GET /admin/users", s.handleAdminUsers())
+	mux.HandleFunc("POST /admin/users/{id}/disable", s.handleAdminSetUserDisabled(true))
+	mux.HandleFunc("POST /admin/users/{id}/enable", s.handleAdminSetUserDisabled(false))
+	mux.HandleFunc("GET /admin/links", s.handleAdminLinks())
+	mux.HandleFunc("POST /admin/links/{id}/takedown", s.handleAdminTakeDownLink())
+	mux.HandleFunc("POST /admin/links/{id}/restore", s.handleAdminRestoreLink())
+	mux.HandleFunc("GET /admin/audit", s.handleAdminAudit())
+	mux.HandleFunc("GET /admin/audit/export", s.handleAdminAuditExport())
+	mux.HandleFunc("GET /admin/logins", s.handleAdminLogins())
+	return mux
+}
+
+// adminUsersData — данные страницы поиска пользователей.
+type adminUsersData struct {
+	Query   string
+	Users   []store.User
+	Errors  []string
+	Success string
+}
+
+// adminLinksData — данные страницы поиска ссылок.
+type adminLinksData struct {
+	Query   string
+	Links   []store.Link
+	Errors  []string
+	Success string
+}
+
+func (s *Server) handleAdminDashboard() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats, err := s.adminService.Stats(r.Context())
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to get stats", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		render(w, r, http.StatusOK, "admin.html", stats)
+	}
+}
+
+func (s *Server) renderAdminUsers(w http.ResponseWriter, r *http.Request, status int, data adminUsersData) {
+	users, err := s.adminService.SearchUsers(r.Context(), data.Query)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to search users", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	data.Users = users
+	render(w, r, status, "admin_users.html", data)
+}
+
+func (s *Server) handleAdminUsers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.renderAdminUsers(w, r, http.StatusOK, adminUsersData{Query: r.URL.Query().Get("q")})
+	}
+}
+
+func (s *Server) handleAdminSetUserDisabled(disabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		data := adminUsersData{Query: r.FormValue("q")}
+
+		if disabled {
+			actorID, _ := getUserIDFromContext(r.Context())
+			err = s.adminService.DisableUser(r.Context(), actorID, id)
+			data.Success = "Аккаунт заблокирован"
+		} else {
+			err = s.adminService.EnableUser(r.Context(), id)
+			data.Success = "Аккаунт разблокирован"
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrCannotDisableSelf):
+				s.renderAdminUsers(w, r, http.StatusBadRequest, adminUsersData{Query: data.Query, Errors: []string{"Нельзя заблокировать собственный аккаунт"}})
+			case errors.Is(err, store.ErrUserNotFound):
+				http.NotFound(w, r)
+			default:
+				logging.FromContext(r.Context()).Error("failed to change user status", "error", err)
+				http.Error(w, "Server error", http.StatusInternalServerError)
+			}
+			return
+		}
+		s.renderAdminUsers(w, r, http.StatusOK, data)
+	}
+}
+
+func (s *Server) renderAdminLinks(w http.ResponseWriter, r *http.Request, status int, data adminLinksData) {
+	links, err := s.adminService.SearchLinks(r.Context(), data.Query)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to search links", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	data.Links = links
+	render(w, r, status, "admin_links.html", data)
+}
+
+func (s *Server) handleAdminLinks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.renderAdminLinks(w, r, http.StatusOK, adminLinksData{Query: r.URL.Query().Get("q")})
+	}
+}
+
+func (s *Server) handleAdminTakeDownLink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if err := s.adminService.TakeDownLink(r.Context(), id, r.FormValue("reason")); err != nil {
+			s.handleAdminLinkError(w, r, err)
+			return
+		}
+		s.renderAdminLinks(w, r, http.StatusOK, adminLinksData{Query: r.FormValue("q"), Success: "Ссылка снята"})
+	}
+}
+
+func (s *Server) handleAdminRestoreLink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if err := s.adminService.RestoreLink(r.Context(), id); err != nil {
+			s.handleAdminLinkError(w, r, err)
+			return
+		}
+		s.renderAdminLinks(w, r, http.StatusOK, adminLinksData{Query: r.FormValue("q"), Success: "Ссылка восстановлена"})
+	}
+}
+
+func (s *Server) handleAdminLinkError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, store.ErrShortURLNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	logging.FromContext(r.Context()).Error("failed to change link status", "error", err)
+	http.Error(w, "Server error", http.StatusInternalServerError)
+}
+
+// auditPageLimit — сколько записей журнала показываем на странице; выгрузка отдаёт больше.
+const auditPageLimit = 200
+
+// adminAuditData — данные страницы журнала аудита.
+type adminAuditData struct {
+	Filter      auditQuery
+	Events      []store.AuditEvent
+	TargetTypes []string
+	Errors      []string
+}
+
+var auditTargetTypes = []string{service.AuditTargetUser, service.AuditTargetSession, service.AuditTargetLink, service.AuditTargetWorkspace, service.AuditTargetFolder}
+
+// auditQuery — фильтр журнала в том виде, в каком он пришёл из формы (для повторного показа и ссылки на выгрузку).
+type auditQuery struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      string // ГГГГ-ММ-ДД
+	Until      string // ГГГГ-ММ-ДД, включительно
+}
+
+// parseAuditFilter разбирает фильтр журнала из query-параметров.
+func parseAuditFilter(r *http.Request) (auditQuery, store.AuditFilter, error) {
+	q := r.URL.Query()
+	raw := auditQuery{
+		Actor:      q.Get("actor"),
+		Action:     q.Get("action"),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+		Since:      q.Get("since"),
+		Until:      q.Get("until"),
+	}
+	f := store.AuditFilter{Action: raw.Action, TargetType: raw.TargetType, TargetID: raw.TargetID}
+
+	var err error
+	if raw.Actor != "" {
+		if f.ActorID, err = strconv.ParseInt(raw.Actor, 10, 64); err != nil {
+			return raw, f, errors.New("ID пользователя должен быть числом")
+		}
+	}
+	if raw.Since != "" {
+		if f.Since, err = time.Parse(time.DateOnly, raw.Since); err != nil {
+			return raw, f, errors.New("дата должна быть в формате ГГГГ-ММ-ДД")
+		}
+	}
+	if raw.Until != "" {
+		if f.Until, err = time.Parse(time.DateOnly, raw.Until); err != nil {
+			return raw, f, errors.New("дата должна быть в формате ГГГГ-ММ-ДД")
+		}
+		f.Until = f.Until.AddDate(0, 0, 1)
+	}
+	return raw, f, nil
+}
+
+// GET /admin/audit — журнал аудита с фильтрами.
+func (s *Server) handleAdminAudit() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		raw, filter, err := parseAuditFilter(r)
+		if err != nil {
+			render(w, r, http.StatusBadRequest, "admin_audit.html", adminAuditData{Filter: raw, TargetTypes: auditTargetTypes, Errors: []string{err.Error()}})
+			return
+		}
+		filter.Limit = auditPageLimit
+		events, err := s.adminService.AuditEvents(r.Context(), filter)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to list audit events", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		render(w, r, http.StatusOK, "admin_audit.html", adminAuditData{Filter: raw, TargetTypes: auditTargetTypes, Events: events})
+	}
+}
+
+// GET /admin/audit/export — тот же журнал в JSON для выгрузки.
+func (s *Server) handleAdminAuditExport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, filter, err := parseAuditFilter(r)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		events, err := s.adminService.AuditEvents(r.Context(), filter)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to export audit events", "error", err)
+			writeJSONError(w, http.StatusInternalServerError, "server error")
+			return
+		}
+		if events == nil {
+			events = []store.AuditEvent{}
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="audit-`+time.Now().UTC().Format("20060102-150405")+`.json"`)
+		writeJSON(w, http.StatusOK, events)
+	}
+}
+
+// adminLoginsData — данные страницы разбора попыток входа.
+type adminLoginsData struct {
+	Filter     loginQuery
+	EventTypes []string
+	Events     []store.LoginEvent
+	Locks      []store.LoginLock
+	Errors     []string
+}
+
+var loginEventTypes = []string{store.LoginEventFailure, store.LoginEventBlocked, store.LoginEventLocked, store.LoginEventSuccess}
+
+// loginQuery — фильтр попыток входа в том виде, в каком он пришёл из формы.
+type loginQuery struct {
+	Mail  string
+	IP    string
+	Event string
+	Since string // ГГГГ-ММ-ДД
+}
+
+// GET /admin/logins — неудачные и заблокированные попытки входа и действующие блокировки.
+func (s *Server) handleAdminLogins() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		raw := loginQuery{Mail: q.Get("mail"), IP: q.Get("ip"), Event: q.Get("event"), Since: q.Get("since")}
+		data := adminLoginsData{Filter: raw, EventTypes: loginEventTypes}
+
+		filter := store.LoginEventFilter{Mail: raw.Mail, IP: raw.IP}
+		if raw.Event != "" {
+			if !slices.Contains(loginEventTypes, raw.Event) {
+				data.Errors = append(data.Errors, "Неизвестный тип события")
+			}
+			filter.Events = []string{raw.Event}
+		}
+		if raw.Since != "" {
+			var err error
+			if filter.Since, err = time.Parse(time.DateOnly, raw.Since); err != nil {
+				data.Errors = append(data.Errors, "дата должна быть в формате ГГГГ-ММ-ДД")
+			}
+		}
+		if len(data.Errors) > 0 {
+			render(w, r, http.StatusBadRequest, "admin_logins.html", data)
+			return
+		}
+
+		var err error
+		if data.Events, err = s.adminService.LoginEvents(r.Context(), filter); err == nil {
+			data.Locks, err = s.adminService.LoginLocks(r.Context())
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to list login events", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		render(w, r, http.StatusOK, "admin_logins.html", data)
+	}
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/service"
+	"url-shorter/internal/store"
+)
+
+// ----- JSON API для скриптов (аутентификация по API-токену или сессии) -----
+
+type shortenRequest struct {
+	URL string `json:"url"`
+}
+
+type linkResponse struct {
+	Alias    string `json:"alias"`
+	ShortURL string `json:"short_url"`
+	URL      string `json:"url"`
+}
+
+type workspaceResponse struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type linkListItem struct {
+	Alias     string    `json:"alias"`
+	ShortURL  string    `json:"short_url"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title,omitempty"`
+	Tags      []string  `json:"tags"`
+	Folder    string    `json:"folder,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	Clicks    int64     `json:"clicks"`
+	TakenDown bool      `json:"taken_down"`
+}
+
+type meResponse struct {
+	UserID     int64  `json:"user_id"`
+	Mail       string `json:"mail"`
+	AuthMethod string `json:"auth_method"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("failed to write json response", "error", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// GET /api/me — кто я; удобно проверить, что токен рабочий
+func (s *Server) handleAPIMe() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := getUserIDFromContext(r.Context())
+		mail, _, err := s.userService.GetUserByID(r.Context(), userID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to get user", "error", err)
+			writeJSONError(w, http.StatusInternalServerError, "server error")
+			return
+		}
+		writeJSON(w, http.StatusOK, meResponse{UserID: userID, Mail: mail, AuthMethod: getAuthMethod(r.Context())})
+	}
+}
+
+// POST /api/shorten {"url": "..."} — создать короткую ссылку
+func (s *Server) handleAPIShorten() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context())
+
+		var req shortenRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid json body")
+			return
+		}
+		if req.URL == "" {
+			writeJSONError(w, http.StatusBadRequest, "url is required")
+			return
+		}
+
+		userID, _ := getUserIDFromContext(r.Context())
+		verified, err := s.userService.IsEmailVerified(r.Context(), userID)
+		if err != nil {
+			log.Error("failed to check email verification", "error", err)
+			writeJSONError(w, http.StatusInternalServerError, "server error")
+			return
+		}
+		if !verified {
+			writeJSONError(w, http.StatusForbidden, "confirm your email before creating links")
+			return
+		}
+
+		workspace, ok := s.apiWorkspace(w, r)
+		if !ok {
+			return
+		}
+		if !workspace.CanEdit() {
+			writeJSONError(w, http.StatusForbidden, "viewers cannot create links in this workspace")
+			return
+		}
+
+		alias, longURL, err := s.urlService.CreateShortURL(r.Context(), store.Owner{UserID: userID, WorkspaceID: workspace.WorkspaceID}, req.URL)
+		if errors.Is(err, service.ErrInvalidLinkURL) {
+			writeJSONError(w, http.StatusBadRequest, linkURLText(err))
+			return
+		}
+		if err != nil {
+			log.Error("failed to create short url", "error", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to create short url")
+			return
+		}
+		writeJSON(w, http.StatusCreated, linkResponse{Alias: alias, ShortURL: absoluteURL(r, "/"+alias), URL: longURL})
+	}
+}
+
+// GET /api/links/{alias} — куда ведёт короткая ссылка
+func (s *Server) handleAPIGetLink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		alias := r.PathValue("alias")
+		originalURL, err := s.urlService.GetOriginalURL(r.Context(), alias)
+		if err != nil {
+			if errors.Is(err, store.ErrShortURLNotFound) {
+				writeJSONError(w, http.StatusNotFound, "link not found")
+				return
+			}
+			if errors.Is(err, store.ErrShortURLTakenDown) {
+				writeJSONError(w, http.StatusGone, "link has been disabled by the administrator")
+				return
+			}
+			if errors.Is(err, store.ErrShortURLDeleted) {
+				writeJSONError(w, http.StatusGone, "link has been deleted")
+				return
+			}
+			if errors.Is(err, store.ErrShortURLExpired) {
+				writeJSONError(w, http.StatusGone, "link has expired")
+				return
+			}
+			logging.FromContext(r.Context()).Error("failed to get link", "error", err)
+			writeJSONError(w, http.StatusInternalServerError, "server error")
+			return
+		}
+		writeJSON(w, http.StatusOK, linkResponse{Alias: alias, ShortURL: absoluteURL(r, "/"+alias), URL: originalURL})
+	}
+}
+
+// apiWorkspace определяет пространство запроса по заголовку X-Workspace-ID.
+// Если пользователь в нём не состоит, отвечает 403 и возвращает false.
+func (s *Server) apiWorkspace(w http.ResponseWriter, r *http.Request) (store.Membership, bool) {
+	workspace, err := s.currentWorkspace(r)
+	if err != nil {
+		if errors.Is(err, store.ErrNotWorkspaceMember) {
+			writeJSONError(w, http.StatusForbidden, "not a member of the workspace")
+			return store.Membership{}, false
+		}
+		logging.FromContext(r.Context()).Error("failed to get current workspace", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "server error")
+		return store.Membership{}, false
+	}
+	return workspace, true
+}
+
+// GET /api/workspaces — пространства, в которых состоит пользователь
+func (s *Server) handleAPIWorkspaces() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := getUserIDFromContext(r.Context())
+		list, err := s.workspaceService.List(r.Context(), userID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to list workspaces", "error", err)
+			writeJSONError(w, http.StatusInternalServerError, "server error")
+			return
+		}
+		resp := make([]workspaceResponse, 0, len(list))
+		for _, m := range list {
+			resp = append(resp, workspaceResponse{ID: m.WorkspaceID, Name: m.Name, Role: m.Role})
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// GET /api/links?tag=&folder= — последние ссылки пространства из X-Workspace-ID (без заголовка — личные)
+func (s *Server) handleAPIListLinks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspace, ok := s.apiWorkspace(w, r)
+		if !ok {
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		links, err := s.urlService.ListLinks(r.Context(), store.Owner{UserID: userID, WorkspaceID: workspace.WorkspaceID}, linkFilter(r))
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to list links", "error", err)
+			writeJSONError(w, http.StatusInternalServerError, "server error")
+			return
+		}
+		resp := make([]linkListItem, 0, len(links))
+		for _, l := range links {
+			tags := l.Tags
+			if tags == nil {
+				tags = []string{}
+			}
+			resp = append(resp, linkListItem{
+				Alias:     l.Alias,
+				ShortURL:  absoluteURL(r, "/"+l.Alias),
+				URL:       l.URL,
+				Title:     l.Title,
+				Tags:      tags,
+				Folder:    l.FolderName,
+				CreatedAt: l.CreatedAt,
+				ExpiresAt: l.ExpiresAt,
+				Clicks:    l.Clicks,
+				TakenDown: l.TakenDown(),
+			})
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
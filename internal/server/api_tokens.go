@@ -0,0 +1,103 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/store"
+)
+
+// tokensData — данные страницы управления API-токенами.
+type tokensData struct {
+	Tokens   []store.APIToken
+	NewToken string // открытое значение только что созданного токена, показывается один раз
+	Errors   []string
+	Success  string
+}
+
+// requireSession не даёт управлять токенами с помощью самих токенов.
+func requireSession(w http.ResponseWriter, r *http.Request) bool {
+	if getAuthMethod(r.Context()) != authMethodSession {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (s *Server) renderTokens(w http.ResponseWriter, r *http.Request, status int, data tokensData) {
+	userID, _ := getUserIDFromContext(r.Context())
+	tokens, err := s.userService.ListAPITokens(r.Context(), userID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to list api tokens", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	data.Tokens = tokens
+	render(w, r, status, "tokens.html", data)
+}
+
+func (s *Server) handleTokensPage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireSession(w, r) {
+			return
+		}
+		s.renderTokens(w, r, http.StatusOK, tokensData{})
+	}
+}
+
+func (s *Server) handleCreateToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireSession(w, r) {
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+
+		var expiresAt time.Time
+		if days := r.FormValue("expires_days"); days != "" {
+			n, err := strconv.Atoi(days)
+			if err != nil || n <= 0 {
+				s.renderTokens(w, r, http.StatusUnprocessableEntity, tokensData{Errors: []string{"Срок действия — целое число дней больше нуля"}})
+				return
+			}
+			expiresAt = time.Now().AddDate(0, 0, n)
+		}
+
+		token, err := s.userService.CreateAPIToken(r.Context(), userID, r.FormValue("name"), r.FormValue("scope"), expiresAt)
+		if err != nil {
+			if errors.Is(err, store.ErrInvalidData) {
+				s.renderTokens(w, r, http.StatusUnprocessableEntity, tokensData{Errors: []string{"Укажите название (до 100 символов) и область действия токена"}})
+				return
+			}
+			logging.FromContext(r.Context()).Error("failed to create api token", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		s.renderTokens(w, r, http.StatusCreated, tokensData{NewToken: token})
+	}
+}
+
+func (s *Server) handleRevokeToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireSession(w, r) {
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if err := s.userService.RevokeAPIToken(r.Context(), userID, id); err != nil {
+			if errors.Is(err, store.ErrAPITokenNotFound) {
+				http.NotFound(w, r)
+				return
+			}
+			logging.FromContext(r.Context()).Error("failed to revoke api token", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		s.renderTokens(w, r, http.StatusOK, tokensData{Success: "Токен отозван"})
+	}
+}
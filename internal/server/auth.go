@@ -3,7 +3,6 @@
 package server
 
 import (
-	"fmt"
 	"net/http"
 	"time"
 
@@ -24,28 +23,60 @@ func HashPassword(password string) (string, error) {
 
 // Хелпер для проверки пароля
 func CheckPasswordHash(password, hash string) bool {
-	fmt.Println("hash", hash, "password", password)
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
 
 // Хелперы для работы с куки
-func setSessionCookie(w http.ResponseWriter, token string) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    token,
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: true,
-		Path:     "/",
-	})
+
+// SetSecureCookies включает атрибут Secure у всех наших куки (нужен HTTPS).
+// Вызывать нужно до Start.
+func (s *Server) SetSecureCookies(secure bool) {
+	s.secureCookies = secure
 }
 
-func clearSessionCookie(w http.ResponseWriter) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    "",
-		Expires:  time.Unix(0, 0),
+// newCookie — куки с общими атрибутами: недоступна из JS, SameSite=Lax
+// (провайдер OIDC и ссылки из писем возвращают пользователя обычным переходом), Secure — по настройке.
+// Нулевой expires — куки живёт до закрытия браузера.
+func (s *Server) newCookie(name, value, path string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Expires:  expires,
 		HttpOnly: true,
-		Path:     "/",
-	})
+		Secure:   s.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (s *Server) clearCookie(w http.ResponseWriter, name, path string) {
+	c := s.newCookie(name, "", path, time.Unix(0, 0))
+	c.MaxAge = -1
+	http.SetCookie(w, c)
+}
+
+// setSessionCookie ставит куки сессии. Без "запомнить меня" куки живёт до закрытия браузера,
+// с ним — до maxExpiry; раньше сессию завершит сервер, если ей долго не пользовались.
+func (s *Server) setSessionCookie(w http.ResponseWriter, token string, remember bool, maxExpiry time.Time) {
+	var expires time.Time
+	if remember {
+		expires = maxExpiry
+	}
+	http.SetCookie(w, s.newCookie("session_token", token, "/", expires))
+}
+
+func (s *Server) clearSessionCookie(w http.ResponseWriter) {
+	s.clearCookie(w, "session_token", "/")
+}
+
+// challengeCookieName — куки между первым (пароль) и вторым (код 2FA) шагами входа.
+const challengeCookieName = "login_challenge"
+
+func (s *Server) setChallengeCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, s.newCookie(challengeCookieName, token, "/login", time.Now().Add(5*time.Minute)))
+}
+
+func (s *Server) clearChallengeCookie(w http.ResponseWriter) {
+	s.clearCookie(w, challengeCookieName, "/login")
 }
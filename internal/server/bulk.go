@@ -0,0 +1,377 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/service"
+	"url-shorter/internal/store"
+)
+
+// maxBulkUpload — предельный размер файла или тела запроса для пакетного сокращения.
+const maxBulkUpload = 2 << 20
+
+// bulkColumns — порядок колонок CSV без заголовка.
+var bulkColumns = []string{"url", "alias", "tags", "expires_at"}
+
+// bulkRow — строка пакета в JSON: объект или просто строка с URL.
+type bulkRow struct {
+	URL       string   `json:"url"`
+	Alias     string   `json:"alias"`
+	Tags      []string `json:"tags"`
+	ExpiresAt string   `json:"expires_at"`
+}
+
+func (b *bulkRow) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &b.URL)
+	}
+	type plain bulkRow
+	return json.Unmarshal(data, (*plain)(b))
+}
+
+type bulkResultItem struct {
+	Row      int    `json:"row"`
+	URL      string `json:"url"`
+	Alias    string `json:"alias,omitempty"`
+	ShortURL string `json:"short_url,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type bulkResponse struct {
+	Created int              `json:"created"`
+	Failed  int              `json:"failed"`
+	Error   string           `json:"error,omitempty"`
+	Results []bulkResultItem `json:"results"`
+}
+
+// bulkData — данные страницы пакетного сокращения.
+type bulkData struct {
+	Workspace store.Membership
+	Results   []bulkResultItem
+	Created   int
+	Errors    []string
+}
+
+// parseExpiry разбирает срок действия: RFC 3339 или дата ГГГГ-ММ-ДД (полночь UTC). Пустая строка — бессрочно.
+func parseExpiry(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
+
+// parseBulkJSON читает JSON-массив строк пакета.
+func parseBulkJSON(data []byte) ([]store.NewLink, error) {
+	var rows []bulkRow
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, errors.New("expected a JSON array of urls or objects with url, alias, tags and expires_at")
+	}
+	links := make([]store.NewLink, len(rows))
+	for i, row := range rows {
+		expiresAt, err := parseExpiry(row.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: expires_at must be RFC 3339 or YYYY-MM-DD", i+1)
+		}
+		links[i] = store.NewLink{URL: row.URL, Alias: row.Alias, Tags: row.Tags, ExpiresAt: expiresAt}
+	}
+	return links, nil
+}
+
+// parseBulkCSV читает CSV с колонками url, alias, tags, expires_at. Первая строка — заголовок, если в ней есть
+// колонка url, и тогда колонки могут идти в любом порядке; иначе колонки берутся в порядке bulkColumns.
+// Теги внутри ячейки разделяются запятыми.
+func parseBulkCSV(data []byte) ([]store.NewLink, error) {
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv: %w", err)
+	}
+
+	columns := bulkColumns
+	first := 0
+	if len(records) > 0 {
+		for _, cell := range records[0] {
+			if strings.EqualFold(strings.TrimSpace(cell), "url") {
+				columns, first = records[0], 1
+				break
+			}
+		}
+	}
+
+	links := make([]store.NewLink, 0, len(records)-first)
+	for i, rec := range records[first:] {
+		var l store.NewLink
+		for j, cell := range rec {
+			if j >= len(columns) {
+				break
+			}
+			switch strings.ToLower(strings.TrimSpace(columns[j])) {
+			case "url":
+				l.URL = cell
+			case "alias":
+				l.Alias = cell
+			case "tags":
+				if strings.TrimSpace(cell) != "" {
+					l.Tags = splitTags(cell)
+				}
+			case "expires_at":
+				if l.ExpiresAt, err = parseExpiry(cell); err != nil {
+					return nil, fmt.Errorf("row %d: expires_at must be RFC 3339 or YYYY-MM-DD", i+1)
+				}
+			}
+		}
+		if l.URL == "" && l.Alias == "" && len(l.Tags) == 0 && l.ExpiresAt.IsZero() {
+			continue // пустая строка
+		}
+		links = append(links, l)
+	}
+	return links, nil
+}
+
+// parseBulk выбирает формат по содержимому: JSON, если данные начинаются с «[», иначе CSV.
+func parseBulk(data []byte) ([]store.NewLink, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		return parseBulkJSON(trimmed)
+	}
+	return parseBulkCSV(data)
+}
+
+// bulkErrorText — причина, по которой строка не создана, для API и файла с результатами.
+func bulkErrorText(err error) string {
+	switch {
+	case errors.Is(err, store.ErrShortURLExists):
+		return "alias is already taken"
+	case errors.Is(err, service.ErrInvalidAlias):
+		return "alias must be 1-64 characters of latin letters, digits, '-' and '_' and must not be reserved"
+	case errors.Is(err, service.ErrInvalidLinkURL):
+		return linkURLText(err)
+	case errors.Is(err, service.ErrInvalidTag):
+		return "tags must be at most 50 characters and must not contain commas"
+	case errors.Is(err, service.ErrTooManyTags):
+		return "a link can have at most 20 tags"
+	case errors.Is(err, service.ErrInvalidExpiry):
+		return "expires_at must be in the future"
+	}
+	return "failed to create link"
+}
+
+// bulkErrorMessage — то же для страницы.
+func bulkErrorMessage(err error) string {
+	if msg := linkEditMessage(err); msg != "" {
+		return msg
+	}
+	if msg := tagsMessage(err); msg != "" {
+		return msg
+	}
+	if errors.Is(err, service.ErrInvalidExpiry) {
+		return "Срок действия должен быть в будущем"
+	}
+	return "Не удалось создать ссылку"
+}
+
+// bulkResults переводит итоги сервиса в ответ; message задаёт текст ошибки строки.
+func bulkResults(r *http.Request, results []service.BulkResult, message func(error) string) ([]bulkResultItem, int) {
+	items := make([]bulkResultItem, len(results))
+	created := 0
+	for i, res := range results {
+		items[i] = bulkResultItem{Row: res.Row, URL: res.URL, Alias: res.Alias}
+		if res.Alias != "" {
+			items[i].ShortURL = absoluteURL(r, "/"+res.Alias)
+			created++
+		}
+		if res.Err != nil {
+			items[i].Error = message(res.Err)
+		}
+	}
+	return items, created
+}
+
+// writeBulkCSV отдаёт итоги пакета файлом CSV.
+func writeBulkCSV(w http.ResponseWriter, r *http.Request, items []bulkResultItem) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="shortened.csv"`)
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"row", "url", "alias", "short_url", "error"})
+	for _, it := range items {
+		cw.Write([]string{fmt.Sprint(it.Row), it.URL, it.Alias, it.ShortURL, it.Error})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		logging.FromContext(r.Context()).Error("failed to write bulk results", "error", err)
+	}
+}
+
+// bulkOwner проверяет, что пользователь может создавать ссылки в текущем пространстве, и возвращает владельца.
+// Текст ошибки — для ответа клиенту, status 0 — всё в порядке.
+func (s *Server) bulkOwner(r *http.Request, workspace store.Membership) (store.Owner, int, string) {
+	userID, _ := getUserIDFromContext(r.Context())
+	verified, err := s.userService.IsEmailVerified(r.Context(), userID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to check email verification", "error", err)
+		return store.Owner{}, http.StatusInternalServerError, "server error"
+	}
+	if !verified {
+		return store.Owner{}, http.StatusForbidden, "confirm your email before creating links"
+	}
+	if !workspace.CanEdit() {
+		return store.Owner{}, http.StatusForbidden, "viewers cannot create links in this workspace"
+	}
+	return store.Owner{UserID: userID, WorkspaceID: workspace.WorkspaceID}, 0, ""
+}
+
+func (s *Server) renderBulk(w http.ResponseWriter, r *http.Request, status int, data bulkData) {
+	workspace, err := s.currentWorkspace(r)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to get current workspace", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	data.Workspace = workspace
+	render(w, r, status, "bulk.html", data)
+}
+
+// GET /bulk — форма пакетного сокращения.
+func (s *Server) handleBulkPage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.renderBulk(w, r, http.StatusOK, bulkData{})
+	}
+}
+
+// POST /bulk — создать ссылки из загруженного файла или вставленного текста.
+// Поле result: page — показать итоги на странице, csv или json — отдать их файлом.
+func (s *Server) handleBulkShorten() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspace, err := s.currentWorkspace(r)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to get current workspace", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		owner, status, msg := s.bulkOwner(r, workspace)
+		if status != 0 {
+			http.Error(w, msg, status)
+			return
+		}
+
+		data := []byte(r.PostFormValue("text"))
+		if file, _, err := r.FormFile("file"); err == nil {
+			data, err = io.ReadAll(io.LimitReader(file, maxBulkUpload+1))
+			file.Close()
+			if err != nil {
+				http.Error(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+		}
+		if len(data) > maxBulkUpload {
+			s.renderBulk(w, r, http.StatusRequestEntityTooLarge, bulkData{Errors: []string{"Файл больше 2 МБ"}})
+			return
+		}
+		links, err := parseBulk(data)
+		if err != nil {
+			s.renderBulk(w, r, http.StatusBadRequest, bulkData{Errors: []string{"Не удалось разобрать файл: " + err.Error()}})
+			return
+		}
+
+		results, err := s.urlService.ShortenBulk(r.Context(), owner, links, r.PostFormValue("atomic") != "")
+		var pageErrors []string
+		switch {
+		case errors.Is(err, service.ErrBulkEmpty):
+			s.renderBulk(w, r, http.StatusBadRequest, bulkData{Errors: []string{"В файле нет ни одной ссылки"}})
+			return
+		case errors.Is(err, service.ErrTooManyLinks):
+			s.renderBulk(w, r, http.StatusBadRequest, bulkData{Errors: []string{"За раз можно сократить не больше 1000 ссылок"}})
+			return
+		case errors.Is(err, service.ErrBulkRejected):
+			pageErrors = []string{"В файле есть ошибки, поэтому ни одна ссылка не создана"}
+		case err != nil:
+			logging.FromContext(r.Context()).Error("failed to shorten links in bulk", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		switch r.PostFormValue("result") {
+		case "csv":
+			items, _ := bulkResults(r, results, bulkErrorText)
+			writeBulkCSV(w, r, items)
+		case "json":
+			items, created := bulkResults(r, results, bulkErrorText)
+			w.Header().Set("Content-Disposition", `attachment; filename="shortened.json"`)
+			writeJSON(w, http.StatusOK, bulkResponse{Created: created, Failed: len(items) - created, Results: items})
+		default:
+			items, created := bulkResults(r, results, bulkErrorMessage)
+			s.renderBulk(w, r, http.StatusOK, bulkData{Results: items, Created: created, Errors: pageErrors})
+		}
+	}
+}
+
+// POST /api/shorten/bulk?atomic=1 — создать пакет ссылок из JSON-массива или CSV (Content-Type: text/csv).
+// С Accept: text/csv итоги отдаются в CSV.
+func (s *Server) handleAPIShortenBulk() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBulkUpload))
+		if err != nil {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "request body must be at most 2 MB")
+			return
+		}
+		var links []store.NewLink
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+			links, err = parseBulkCSV(data)
+		} else {
+			links, err = parseBulkJSON(data)
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		workspace, ok := s.apiWorkspace(w, r)
+		if !ok {
+			return
+		}
+		owner, status, msg := s.bulkOwner(r, workspace)
+		if status != 0 {
+			writeJSONError(w, status, msg)
+			return
+		}
+
+		results, err := s.urlService.ShortenBulk(r.Context(), owner, links, r.URL.Query().Get("atomic") == "1")
+		resp := bulkResponse{}
+		status = http.StatusOK
+		switch {
+		case errors.Is(err, service.ErrBulkEmpty):
+			writeJSONError(w, http.StatusBadRequest, "no links to shorten")
+			return
+		case errors.Is(err, service.ErrTooManyLinks):
+			writeJSONError(w, http.StatusBadRequest, "at most 1000 links can be shortened at once")
+			return
+		case errors.Is(err, service.ErrBulkRejected):
+			resp.Error, status = "batch rejected, no links were created", http.StatusUnprocessableEntity
+		case err != nil:
+			logging.FromContext(r.Context()).Error("failed to shorten links in bulk", "error", err)
+			writeJSONError(w, http.StatusInternalServerError, "server error")
+			return
+		}
+
+		resp.Results, resp.Created = bulkResults(r, results, bulkErrorText)
+		resp.Failed = len(resp.Results) - resp.Created
+		if strings.Contains(r.Header.Get("Accept"), "text/csv") {
+			writeBulkCSV(w, r, resp.Results)
+			return
+		}
+		writeJSON(w, status, resp)
+	}
+}
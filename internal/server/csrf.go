@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+	"url-shorter/internal/logging"
+)
+
+// Защита от CSRF по схеме double-submit: случайный токен лежит в куки и дублируется
+// в скрытом поле каждой формы (или в заголовке X-CSRF-Token для fetch).
+// Чужой сайт может заставить браузер отправить нашу куки, но прочитать её значение не может.
+const (
+	csrfCookieName = "csrf_token"
+	csrfFieldName  = "csrf_token"
+	csrfHeaderName = "X-CSRF-Token"
+	csrfContextKey = contextKey("csrf")
+)
+
+// CSRFMiddleware выдаёт токен, если его ещё нет, и проверяет его во всех запросах, меняющих состояние.
+// Запросы с Authorization: Bearer не проверяются: браузер сам такой заголовок не подставит.
+func (s *Server) CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := ""
+		if c, err := r.Cookie(csrfCookieName); err == nil && len(c.Value) == 43 {
+			token = c.Value
+		}
+		issued := false
+		if token == "" {
+			b := make([]byte, 32)
+			if _, err := rand.Read(b); err != nil {
+				logging.FromContext(r.Context()).Error("failed to generate csrf token", "error", err)
+				http.Error(w, "Server error", http.StatusInternalServerError)
+				return
+			}
+			token = base64.RawURLEncoding.EncodeToString(b)
+			issued = true
+			http.SetCookie(w, s.newCookie(csrfCookieName, token, "/", time.Time{}))
+		}
+
+		if !isSafeMethod(r.Method) {
+			if _, ok := bearerToken(r); !ok {
+				sent := r.Header.Get(csrfHeaderName)
+				if sent == "" {
+					sent = r.PostFormValue(csrfFieldName)
+				}
+				if issued || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+					logging.FromContext(r.Context()).Warn("csrf token mismatch", "method", r.Method, "path", r.URL.Path)
+					if strings.HasPrefix(r.URL.Path, "/api/") {
+						writeJSONError(w, http.StatusForbidden, "invalid csrf token")
+						return
+					}
+					http.Error(w, "Invalid or missing CSRF token, reload the page and try again", http.StatusForbidden)
+					return
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfContextKey, token)))
+	})
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// csrfField — скрытое поле формы с токеном текущего запроса, доступно в шаблонах как {{ csrfField }}.
+func csrfField(r *http.Request) template.HTML {
+	token, _ := r.Context().Value(csrfContextKey).(string)
+	return template.HTML(`<input type="hidden" name="` + csrfFieldName + `" value="` + template.HTMLEscapeString(token) + `">`)
+}
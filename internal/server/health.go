@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// readinessTimeout — сколько ждём все проверки готовности вместе.
+const readinessTimeout = 2 * time.Second
+
+// CheckFunc — проверка одной зависимости (БД, схема, кэш и т.д.).
+// nil означает, что зависимость в порядке.
+type CheckFunc func(ctx context.Context) error
+
+type readinessCheck struct {
+	name  string
+	check CheckFunc
+}
+
+type checkResult struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	DurationMS float64 `json:"duration_ms"`
+	// текст ошибки только пишется в лог: /readyz доступен без входа, а в ошибках pgx есть адрес БД
+	err error
+}
+
+type healthResponse struct {
+	Status string        `json:"status"`
+	Checks []checkResult `json:"checks,omitempty"`
+}
+
+// AddReadinessCheck регистрирует проверку, которую будет выполнять /readyz.
+// Вызывать нужно до Start.
+func (s *Server) AddReadinessCheck(name string, check CheckFunc) {
+	s.readinessChecks = append(s.readinessChecks, readinessCheck{name: name, check: check})
+}
+
+// handleHealthz — liveness: процесс жив и способен отвечать.
+func (s *Server) handleHealthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+	}
+}
+
+// handleReadyz — readiness: можно ли слать на инстанс трафик.
+// Во время graceful shutdown всегда отвечает 503, чтобы оркестратор снял инстанс с балансировки.
+func (s *Server) handleReadyz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.shuttingDown.Load() {
+			writeHealth(w, http.StatusServiceUnavailable, healthResponse{Status: "shutting_down"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		results := make([]checkResult, len(s.readinessChecks))
+		var wg sync.WaitGroup
+		for i, rc := range s.readinessChecks {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				start := time.Now()
+				err := rc.check(ctx)
+				res := checkResult{
+					Name:       rc.name,
+					Status:     "ok",
+					DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+				}
+				if err != nil {
+					res.Status = "fail"
+					res.err = err
+				}
+				results[i] = res
+			}()
+		}
+		wg.Wait()
+
+		resp := healthResponse{Status: "ready", Checks: results}
+		code := http.StatusOK
+		for _, res := range results {
+			if res.Status != "ok" {
+				resp.Status = "not_ready"
+				code = http.StatusServiceUnavailable
+				slog.Warn("readiness check failed", "check", res.Name, "error", res.err)
+			}
+		}
+		writeHealth(w, code, resp)
+	}
+}
+
+func writeHealth(w http.ResponseWriter, code int, resp healthResponse) {
+	writeJSON(w, code, resp)
+}
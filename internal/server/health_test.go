@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"url-shorter/internal/mail"
+)
+
+func TestReadyzHidesCheckErrors(t *testing.T) {
+	logs := captureLogs(t)
+	srv := newTestServer(t, newMemUserStorage(), mail.LogMailer{})
+	const detail = `failed to connect to host=db.internal port=5432: relation "schema_migrations" does not exist`
+	srv.AddReadinessCheck("database", func(ctx context.Context) error { return errors.New(detail) })
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("код ответа %d, ожидался 503", w.Code)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "db.internal") || strings.Contains(body, "schema_migrations") {
+		t.Errorf("текст ошибки попал в ответ: %s", body)
+	}
+	if !strings.Contains(body, `"status":"fail"`) {
+		t.Errorf("в ответе нет статуса проверки: %s", body)
+	}
+	if !strings.Contains(logs.String(), "db.internal") {
+		t.Errorf("текст ошибки не попал в лог:\n%s", logs)
+	}
+}
+
+func TestShutdownReportsNotReadyDuringDrain(t *testing.T) {
+	srv := newTestServer(t, newMemUserStorage(), mail.LogMailer{})
+	srv.SetDrainDelay(200 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() { done <- srv.Shutdown(context.Background()) }()
+
+	deadline := time.Now().Add(100 * time.Millisecond)
+	for !srv.shuttingDown.Load() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("во время паузы /readyz ответил %d, ожидался 503", w.Code)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown завершился до конца паузы: %v", err)
+	default:
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"url-shorter/internal/importer"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/service"
+	"url-shorter/internal/store"
+)
+
+// maxImportUpload — предельный размер файла выгрузки.
+const maxImportUpload = 20 << 20
+
+// importData — данные страницы импорта.
+type importData struct {
+	Workspace store.Membership
+	Formats   []string
+	Format    string
+	DryRun    bool
+	Rename    bool
+	Results   []importResultItem
+	Created   int
+	Renamed   int
+	Skipped   int
+	Errors    []string
+}
+
+type importResultItem struct {
+	service.ImportResult
+	ShortURL string
+	Reason   string
+}
+
+// importReason — почему ссылка пропущена или переименована, для страницы импорта.
+func importReason(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, store.ErrShortURLExists):
+		return "alias уже занят"
+	case errors.Is(err, service.ErrInvalidAlias):
+		return "alias не подходит: допустимы латиница, цифры, «-» и «_», до 64 символов"
+	case errors.Is(err, service.ErrInvalidLinkURL):
+		return linkURLMessage(err)
+	case errors.Is(err, importer.ErrInvalidDate):
+		return "не распознана дата создания"
+	case errors.Is(err, importer.ErrInvalidClicks):
+		return "неверное число переходов"
+	}
+	if msg := tagsMessage(err); msg != "" {
+		return msg
+	}
+	return "не удалось импортировать"
+}
+
+func (s *Server) renderImport(w http.ResponseWriter, r *http.Request, status int, data importData) {
+	workspace, err := s.currentWorkspace(r)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to get current workspace", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	data.Workspace, data.Formats = workspace, importer.Formats
+	render(w, r, status, "import.html", data)
+}
+
+// GET /import — форма импорта ссылок из YOURLS и Bitly.
+func (s *Server) handleImportPage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.renderImport(w, r, http.StatusOK, importData{Format: importer.FormatYOURLS, DryRun: true})
+	}
+}
+
+// POST /import — импортировать выгрузку в текущее пространство (или только проверить её, если dry_run).
+func (s *Server) handleImport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := importData{
+			Format: r.PostFormValue("format"),
+			DryRun: r.PostFormValue("dry_run") != "",
+			Rename: r.PostFormValue("rename") != "",
+		}
+		workspace, err := s.currentWorkspace(r)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to get current workspace", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		owner, status, msg := s.bulkOwner(r, workspace)
+		if status != 0 {
+			http.Error(w, msg, status)
+			return
+		}
+
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			data.Errors = []string{"Выберите файл выгрузки"}
+			s.renderImport(w, r, http.StatusBadRequest, data)
+			return
+		}
+		// читаем на байт больше предела, чтобы отличить слишком большой файл от файла ровно в предел
+		upload, err := io.ReadAll(io.LimitReader(file, maxImportUpload+1))
+		file.Close()
+		if err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+		if len(upload) > maxImportUpload {
+			data.Errors = []string{"Файл больше 20 МБ"}
+			s.renderImport(w, r, http.StatusRequestEntityTooLarge, data)
+			return
+		}
+		records, err := importer.Parse(data.Format, bytes.NewReader(upload))
+		if err != nil {
+			data.Errors = []string{"Не удалось разобрать выгрузку: " + err.Error()}
+			s.renderImport(w, r, http.StatusBadRequest, data)
+			return
+		}
+
+		results, err := s.urlService.ImportLinks(r.Context(), owner, records,
+			service.ImportOptions{DryRun: data.DryRun, RenameConflicts: data.Rename})
+		switch {
+		case errors.Is(err, service.ErrBulkEmpty):
+			data.Errors = []string{"В выгрузке нет ни одной ссылки"}
+			s.renderImport(w, r, http.StatusBadRequest, data)
+			return
+		case errors.Is(err, service.ErrTooManyLinks):
+			data.Errors = []string{"За раз можно импортировать не больше 50 000 ссылок"}
+			s.renderImport(w, r, http.StatusBadRequest, data)
+			return
+		case err != nil:
+			logging.FromContext(r.Context()).Error("failed to import links", "error", err)
+			data.Errors = []string{"Импорт прерван из-за ошибки сервера; ссылки ниже уже созданы"}
+		}
+
+		data.Results = make([]importResultItem, len(results))
+		for i, res := range results {
+			data.Results[i] = importResultItem{ImportResult: res, Reason: importReason(res.Err)}
+			if res.Alias != "" && !data.DryRun {
+				data.Results[i].ShortURL = absoluteURL(r, "/"+res.Alias)
+			}
+			switch res.Status {
+			case service.ImportCreated:
+				data.Created++
+			case service.ImportRenamed:
+				data.Renamed++
+			default:
+				data.Skipped++
+			}
+		}
+		s.renderImport(w, r, http.StatusOK, data)
+	}
+}
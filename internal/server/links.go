@@ -0,0 +1,362 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/service"
+	"url-shorter/internal/store"
+)
+
+// linkData — данные страницы редактирования ссылки.
+type linkData struct {
+	Link     store.Link
+	Form     store.LinkEdit // что показываем в форме: текущие значения или введённые с ошибкой
+	TagsForm string         // теги через запятую — как Form, для формы тегов
+	Folders  []store.Folder // куда можно переложить ссылку
+	CanEdit  bool
+	History  []store.LinkVersion
+	ShortURL string
+	Errors   []string
+	Success  string
+}
+
+func (s *Server) renderLink(w http.ResponseWriter, r *http.Request, status int, alias string, data linkData) {
+	userID, _ := getUserIDFromContext(r.Context())
+	link, canEdit, err := s.urlService.GetLink(r.Context(), userID, alias)
+	if err != nil {
+		s.handleLinkError(w, r, err)
+		return
+	}
+	history, err := s.urlService.LinkHistory(r.Context(), userID, alias)
+	if err != nil {
+		s.handleLinkError(w, r, err)
+		return
+	}
+	if canEdit {
+		data.Folders, err = s.urlService.Folders(r.Context(), store.Owner{UserID: link.UserID, WorkspaceID: link.WorkspaceID})
+		if err != nil {
+			s.handleLinkError(w, r, err)
+			return
+		}
+	}
+	data.Link, data.CanEdit, data.History = link, canEdit, history
+	data.ShortURL = absoluteURL(r, "/"+link.Alias)
+	if data.Form == (store.LinkEdit{}) {
+		data.Form = store.LinkEdit{Alias: link.Alias, URL: link.URL, Title: link.Title, Notes: link.Notes}
+	}
+	if data.TagsForm == "" {
+		data.TagsForm = strings.Join(link.Tags, ", ")
+	}
+	render(w, r, status, "link.html", data)
+}
+
+// handleLinkError отвечает на ошибки, после которых страницу ссылки показать нельзя.
+func (s *Server) handleLinkError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrShortURLNotFound), errors.Is(err, store.ErrLinkVersionNotFound):
+		http.NotFound(w, r)
+	case errors.Is(err, service.ErrLinkForbidden):
+		http.Error(w, "Viewers cannot edit links in this workspace", http.StatusForbidden)
+	case errors.Is(err, store.ErrShortURLDeleted):
+		http.Error(w, "This link is in the trash", http.StatusGone)
+	case errors.Is(err, service.ErrTrashExpired):
+		http.Error(w, "This link has been deleted permanently", http.StatusGone)
+	default:
+		logging.FromContext(r.Context()).Error("failed to load link", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+	}
+}
+
+// linkEditMessage переводит ошибку проверки правки в сообщение для формы; пустая строка — ошибка не из формы.
+func linkEditMessage(err error) string {
+	switch {
+	case errors.Is(err, service.ErrInvalidAlias):
+		return "Alias может содержать латинские буквы, цифры, «-» и «_» (до 64 символов) и не должен совпадать с адресами страниц сервиса"
+	case errors.Is(err, store.ErrShortURLExists):
+		return "Такой alias уже занят"
+	case errors.Is(err, service.ErrInvalidLinkURL):
+		return linkURLMessage(err)
+	case errors.Is(err, service.ErrLinkFieldTooLong):
+		return "Заголовок — до 200 символов, заметки — до 2000"
+	}
+	return ""
+}
+
+// linkURLMessage объясняет, почему адрес назначения не принят (err оборачивает service.ErrInvalidLinkURL).
+func linkURLMessage(err error) string {
+	switch {
+	case errors.Is(err, service.ErrURLTooLong):
+		return "Адрес слишком длинный"
+	case errors.Is(err, service.ErrURLSchemeNotAllowed):
+		return "Такие адреса сокращать нельзя: разрешены только ссылки на веб-страницы (http:// и https://)"
+	case errors.Is(err, service.ErrURLPrivateHost):
+		return "Адрес ведёт в локальную или частную сеть — такие ссылки сокращать нельзя"
+	case errors.Is(err, service.ErrURLHostNotResolved):
+		return "Не удалось найти сайт по этому адресу"
+	case errors.Is(err, service.ErrURLHostCheckFailed):
+		return "Не удалось проверить адрес: DNS не ответил. Попробуйте ещё раз"
+	}
+	return "Введите полный адрес, начинающийся с http:// или https://"
+}
+
+// linkURLText — то же для API.
+func linkURLText(err error) string {
+	switch {
+	case errors.Is(err, service.ErrURLTooLong):
+		return "url is too long"
+	case errors.Is(err, service.ErrURLSchemeNotAllowed):
+		return "url scheme is not allowed"
+	case errors.Is(err, service.ErrURLPrivateHost):
+		return "url must not point to a private or loopback address"
+	case errors.Is(err, service.ErrURLHostNotResolved):
+		return "url host does not resolve"
+	case errors.Is(err, service.ErrURLHostCheckFailed):
+		return "could not check url host, try again later"
+	}
+	return "url must be an absolute http or https url"
+}
+
+// GET /links/{alias} — ссылка, форма редактирования и история изменений.
+func (s *Server) handleLinkPage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data linkData
+		switch {
+		case r.URL.Query().Has("saved"):
+			data.Success = "Изменения сохранены"
+		case r.URL.Query().Has("rolledback"):
+			data.Success = "Прежний адрес восстановлен"
+		case r.URL.Query().Has("restored"):
+			data.Success = "Ссылка восстановлена из корзины"
+		}
+		s.renderLink(w, r, http.StatusOK, r.PathValue("alias"), data)
+	}
+}
+
+// POST /links/{alias} — сохранить правку ссылки.
+func (s *Server) handleUpdateLink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		alias := r.PathValue("alias")
+		edit := store.LinkEdit{
+			Alias: r.FormValue("alias"),
+			URL:   r.FormValue("url"),
+			Title: r.FormValue("title"),
+			Notes: r.FormValue("notes"),
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		link, err := s.urlService.UpdateLink(r.Context(), userID, alias, edit)
+		if err != nil {
+			if msg := linkEditMessage(err); msg != "" {
+				s.renderLink(w, r, http.StatusBadRequest, alias, linkData{Form: edit, Errors: []string{msg}})
+				return
+			}
+			s.handleLinkError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/links/"+url.PathEscape(link.Alias)+"?saved=1", http.StatusSeeOther)
+	}
+}
+
+// POST /links/{alias}/rollback/{version} — вернуть адрес назначения из прежней версии.
+func (s *Server) handleRollbackLink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		versionID, err := strconv.ParseInt(r.PathValue("version"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		link, err := s.urlService.RollbackLink(r.Context(), userID, r.PathValue("alias"), versionID)
+		if err != nil {
+			s.handleLinkError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/links/"+url.PathEscape(link.Alias)+"?rolledback=1", http.StatusSeeOther)
+	}
+}
+
+// updateLinkRequest — тело PATCH /api/links/{alias}; незаданные поля не меняются.
+type updateLinkRequest struct {
+	Alias    *string   `json:"alias"`
+	URL      *string   `json:"url"`
+	Title    *string   `json:"title"`
+	Notes    *string   `json:"notes"`
+	Tags     *[]string `json:"tags"`      // заменяет все теги ссылки
+	FolderID *int64    `json:"folder_id"` // 0 — вынуть из папки
+}
+
+type linkDetailsResponse struct {
+	Alias     string    `json:"alias"`
+	ShortURL  string    `json:"short_url"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title"`
+	Notes     string    `json:"notes"`
+	Tags      []string  `json:"tags"`
+	FolderID  int64     `json:"folder_id,omitempty"`
+	Folder    string    `json:"folder,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	Clicks    int64     `json:"clicks"`
+}
+
+type linkVersionResponse struct {
+	ID        int64     `json:"id"`
+	Alias     string    `json:"alias"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title"`
+	Notes     string    `json:"notes"`
+	ChangedBy string    `json:"changed_by"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// writeLinkAPIError отвечает JSON-ошибкой на ошибки правки ссылки.
+func writeLinkAPIError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrShortURLNotFound):
+		writeJSONError(w, http.StatusNotFound, "link not found")
+	case errors.Is(err, store.ErrLinkVersionNotFound):
+		writeJSONError(w, http.StatusNotFound, "version not found")
+	case errors.Is(err, service.ErrLinkForbidden):
+		writeJSONError(w, http.StatusForbidden, "viewers cannot edit links in this workspace")
+	case errors.Is(err, store.ErrShortURLDeleted):
+		writeJSONError(w, http.StatusGone, "link is in the trash")
+	case errors.Is(err, service.ErrTrashExpired):
+		writeJSONError(w, http.StatusGone, "trash retention period has expired")
+	case errors.Is(err, store.ErrShortURLExists):
+		writeJSONError(w, http.StatusConflict, "alias is already taken")
+	case errors.Is(err, service.ErrInvalidAlias):
+		writeJSONError(w, http.StatusBadRequest, "alias must be 1-64 characters of latin letters, digits, '-' and '_' and must not be reserved")
+	case errors.Is(err, service.ErrInvalidLinkURL):
+		writeJSONError(w, http.StatusBadRequest, linkURLText(err))
+	case errors.Is(err, service.ErrLinkFieldTooLong):
+		writeJSONError(w, http.StatusBadRequest, "title must be at most 200 characters and notes at most 2000")
+	case errors.Is(err, service.ErrInvalidTag):
+		writeJSONError(w, http.StatusBadRequest, "tags must be at most 50 characters and must not contain commas")
+	case errors.Is(err, service.ErrTooManyTags):
+		writeJSONError(w, http.StatusBadRequest, "a link can have at most 20 tags")
+	case errors.Is(err, service.ErrTooManyLinks):
+		writeJSONError(w, http.StatusBadRequest, "at most 500 links can be changed at once")
+	case errors.Is(err, service.ErrInvalidFolderName):
+		writeJSONError(w, http.StatusBadRequest, "folder name must be 1-100 characters")
+	case errors.Is(err, store.ErrFolderExists):
+		writeJSONError(w, http.StatusConflict, "folder with this name already exists")
+	case errors.Is(err, store.ErrFolderNotFound):
+		writeJSONError(w, http.StatusNotFound, "folder not found")
+	default:
+		logging.FromContext(r.Context()).Error("failed to update link", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "server error")
+	}
+}
+
+func linkDetails(r *http.Request, l store.Link) linkDetailsResponse {
+	tags := l.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return linkDetailsResponse{
+		Alias:     l.Alias,
+		ShortURL:  absoluteURL(r, "/"+l.Alias),
+		URL:       l.URL,
+		Title:     l.Title,
+		Notes:     l.Notes,
+		Tags:      tags,
+		FolderID:  l.FolderID,
+		Folder:    l.FolderName,
+		CreatedAt: l.CreatedAt,
+		UpdatedAt: l.UpdatedAt,
+		ExpiresAt: l.ExpiresAt,
+		Clicks:    l.Clicks,
+	}
+}
+
+// PATCH /api/links/{alias} {"url": "...", "alias": "...", "title": "...", "notes": "...", "tags": [...], "folder_id": 1} — изменить ссылку
+func (s *Server) handleAPIUpdateLink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req updateLinkRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid json body")
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		alias := r.PathValue("alias")
+		link, _, err := s.urlService.GetLink(r.Context(), userID, alias)
+		if err != nil {
+			writeLinkAPIError(w, r, err)
+			return
+		}
+		edit := store.LinkEdit{Alias: link.Alias, URL: link.URL, Title: link.Title, Notes: link.Notes}
+		if req.Alias != nil {
+			edit.Alias = *req.Alias
+		}
+		if req.URL != nil {
+			edit.URL = *req.URL
+		}
+		if req.Title != nil {
+			edit.Title = *req.Title
+		}
+		if req.Notes != nil {
+			edit.Notes = *req.Notes
+		}
+		link, err = s.urlService.UpdateLink(r.Context(), userID, alias, edit)
+		if err == nil && req.Tags != nil {
+			link, err = s.urlService.SetLinkTags(r.Context(), userID, link.Alias, *req.Tags)
+		}
+		if err == nil && req.FolderID != nil {
+			link, err = s.urlService.MoveLink(r.Context(), userID, link.Alias, *req.FolderID)
+		}
+		if err != nil {
+			writeLinkAPIError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, linkDetails(r, link))
+	}
+}
+
+// GET /api/links/{alias}/history — прежние версии ссылки, начиная с последней
+func (s *Server) handleAPILinkHistory() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := getUserIDFromContext(r.Context())
+		history, err := s.urlService.LinkHistory(r.Context(), userID, r.PathValue("alias"))
+		if err != nil {
+			writeLinkAPIError(w, r, err)
+			return
+		}
+		resp := make([]linkVersionResponse, 0, len(history))
+		for _, v := range history {
+			resp = append(resp, linkVersionResponse{
+				ID:        v.ID,
+				Alias:     v.Alias,
+				URL:       v.URL,
+				Title:     v.Title,
+				Notes:     v.Notes,
+				ChangedBy: v.ChangedByMail,
+				ChangedAt: v.ChangedAt,
+			})
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// POST /api/links/{alias}/rollback/{version} — вернуть адрес назначения из прежней версии
+func (s *Server) handleAPIRollbackLink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		versionID, err := strconv.ParseInt(r.PathValue("version"), 10, 64)
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, "version not found")
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		link, err := s.urlService.RollbackLink(r.Context(), userID, r.PathValue("alias"), versionID)
+		if err != nil {
+			writeLinkAPIError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, linkDetails(r, link))
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+	"url-shorter/internal/audit"
+	"url-shorter/internal/logging"
+
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 128
+)
+
+// requestInfo — изменяемые данные о запросе, которые становятся известны уже внутри цепочки
+// (пользователь появляется только в AuthMiddleware, паттерн маршрута — во вложенном роутере),
+// а нужны снаружи, в access-логе.
+type requestInfo struct {
+	id     string
+	userID int64
+	route  string
+}
+
+const requestInfoContextKey = contextKey("requestInfo")
+
+func getRequestInfo(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoContextKey).(*requestInfo)
+	return info
+}
+
+// RequestIDMiddleware берёт X-Request-ID из запроса (или генерирует новый),
+// возвращает его в ответе и кладёт в контекст логгер с этим ID, а для журнала аудита — ID и IP клиента.
+func (s *Server) RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestInfoContextKey, &requestInfo{id: id})
+		ctx = logging.WithLogger(ctx, slog.Default().With("request_id", id))
+		ctx = audit.WithActor(ctx, audit.Actor{IP: clientIP(r), RequestID: id})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// AccessLogMiddleware пишет одну структурированную строку на каждый запрос.
+// Должен стоять внутри RequestIDMiddleware.
+func (s *Server) AccessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := r.Pattern
+		info := getRequestInfo(r.Context())
+		if info != nil && info.route != "" {
+			route = info.route
+		}
+		attrs := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", route,
+			"status", status,
+			"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"bytes", rec.bytes,
+			"client_ip", clientIP(r),
+			"user_agent", r.UserAgent(),
+		}
+		if info != nil && info.userID != 0 {
+			attrs = append(attrs, "user_id", info.userID)
+		}
+
+		// пробы оркестратора дёргают сервер каждые несколько секунд, в info они только шумят
+		level := slog.LevelInfo
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			level = slog.LevelDebug
+		}
+		logging.FromContext(r.Context()).Log(r.Context(), level, "request handled", attrs...)
+	})
+}
+
+// statusRecorder запоминает код ответа и число записанных байт.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap нужен http.ResponseController, чтобы добраться до исходного ResponseWriter.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// clientIP возвращает IP клиента из адреса соединения.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// validRequestID не даёт протащить в логи мусор через заголовок X-Request-ID.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"url-shorter/internal/mail"
+	"url-shorter/internal/service"
+)
+
+const testPassword = "Correct-Horse-Battery-42"
+
+func newTestServer(t *testing.T, users *memUserStorage, mailer mail.Mailer) *Server {
+	t.Helper()
+	usrs := service.NewUserService(users, service.UserOptions{
+		Mailer: mailer,
+		Secret: []byte("test-secret-test-secret-test-secret"),
+	})
+	return New("", nil, usrs, nil, nil)
+}
+
+// assertNotLogged проверяет, что секрета нет в логах ни как есть, ни в экранированном виде.
+func assertNotLogged(t *testing.T, logs, what, secret string) {
+	t.Helper()
+	if secret == "" {
+		t.Fatalf("%s: пустой секрет, проверять нечего", what)
+	}
+	for _, s := range []string{secret, url.QueryEscape(secret)} {
+		if strings.Contains(logs, s) {
+			t.Errorf("%s попал в логи:\n%s", what, logs)
+			return
+		}
+	}
+}
+
+func TestRegisterDoesNotLogSecrets(t *testing.T) {
+	logs := captureLogs(t)
+	users := newMemUserStorage()
+	mailer := &recordingMailer{next: mail.LogMailer{}}
+	srv := newTestServer(t, users, mailer)
+
+	w := postForm(t, srv, "/register", url.Values{"mail": {"new@example.com"}, "password": {testPassword}})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("POST /register: код %d, тело %q", w.Code, w.Body.String())
+	}
+	if len(mailer.sent) != 1 {
+		t.Fatalf("отправлено писем: %d, ожидалось 1", len(mailer.sent))
+	}
+	_, rest, ok := strings.Cut(mailer.sent[0].Body, "token=")
+	if !ok {
+		t.Fatalf("в письме нет ссылки с токеном: %q", mailer.sent[0].Body)
+	}
+	token, _ := url.QueryUnescape(strings.Fields(rest)[0])
+
+	out := logs.String()
+	if !strings.Contains(out, "user registered") {
+		t.Fatalf("в логах нет записи о регистрации, перехват не сработал:\n%s", out)
+	}
+	assertNotLogged(t, out, "пароль", testPassword)
+	assertNotLogged(t, out, "хеш пароля", users.users[1].hash)
+	assertNotLogged(t, out, "токен подтверждения", token)
+}
+
+func TestLoginDoesNotLogSecrets(t *testing.T) {
+	logs := captureLogs(t)
+	users := newMemUserStorage()
+	hash, err := HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.SaveUser(t.Context(), "user@example.com", hash); err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t, users, mail.LogMailer{})
+
+	const wrongPassword = "Wrong-Password-Guess-17"
+	w := postForm(t, srv, "/login", url.Values{"mail": {"user@example.com"}, "password": {wrongPassword}})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("вход с неверным паролем: код %d", w.Code)
+	}
+
+	w = postForm(t, srv, "/login", url.Values{"mail": {"user@example.com"}, "password": {testPassword}, "remember": {"1"}})
+	session := responseCookie(w, "session_token")
+	if session == nil {
+		t.Fatalf("вход не выдал сессию: код %d, тело %q", w.Code, w.Body.String())
+	}
+
+	out := logs.String()
+	if !strings.Contains(out, "неудачная попытка входа") {
+		t.Fatalf("в логах нет записи о неудачном входе, перехват не сработал:\n%s", out)
+	}
+	assertNotLogged(t, out, "пароль", testPassword)
+	assertNotLogged(t, out, "неверный пароль", wrongPassword)
+	assertNotLogged(t, out, "хеш пароля", hash)
+	assertNotLogged(t, out, "токен сессии", session.Value)
+}
+
+func TestRedactMatchesKeyFragments(t *testing.T) {
+	logs := captureLogs(t)
+	secrets := map[string]string{
+		"api_token":      "api-token-value-1",
+		"reset_token":    "reset-token-value-2",
+		"totp_secret":    "totp-secret-value-3",
+		"code_hash":      "code-hash-value-4",
+		"Password":       "password-value-5",
+		"NEW_PASSWORD":   "password-value-6",
+		"X-Api-Token":    "api-token-value-7",
+		"Authorization":  "bearer-value-8",
+		"session_cookie": "cookie-value-9",
+	}
+	for key, value := range secrets {
+		slog.Info("секрет", key, value)
+		slog.Info("секрет в группе", slog.Group("request", key, value))
+	}
+	slog.Info("обычный атрибут", "alias", "docs-alias-value")
+
+	out := logs.String()
+	for key, value := range secrets {
+		assertNotLogged(t, out, key, value)
+	}
+	if !strings.Contains(out, "docs-alias-value") {
+		t.Errorf("замаскирован атрибут без секрета:\n%s", out)
+	}
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/mail"
+	"url-shorter/internal/service"
+	"url-shorter/internal/store"
+)
+
+func TestMain(m *testing.M) {
+	// шаблоны ищутся относительно корня репозитория, как при обычном запуске
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// memUserStorage — хранилище пользователей в памяти для тестов хендлеров. Методы, которые тестам
+// не нужны, не реализованы: вызов такого метода паникует и сразу показывает, чего не хватает.
+type memUserStorage struct {
+	service.UserStorage
+
+	mu         sync.Mutex
+	users      map[int64]*memUser
+	sessions   map[string]store.Session
+	identities map[[2]string]int64 // (issuer, subject) → пользователь
+	nextID     int64
+}
+
+type memUser struct {
+	store.User
+	hash string
+}
+
+func newMemUserStorage() *memUserStorage {
+	return &memUserStorage{
+		users:      make(map[int64]*memUser),
+		sessions:   make(map[string]store.Session),
+		identities: make(map[[2]string]int64),
+	}
+}
+
+func (m *memUserStorage) SaveUser(ctx context.Context, mail, hash string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Mail == mail {
+			return 0, store.ErrUserExists
+		}
+	}
+	m.nextID++
+	m.users[m.nextID] = &memUser{User: store.User{ID: m.nextID, Mail: mail, Role: "user", CreatedAt: time.Now()}, hash: hash}
+	return m.nextID, nil
+}
+
+func (m *memUserStorage) GetUserByEmail(ctx context.Context, mail string) (int64, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Mail == mail {
+			return u.ID, u.hash, nil
+		}
+	}
+	return 0, "", store.ErrUserNotFound
+}
+
+func (m *memUserStorage) GetUserByID(ctx context.Context, id int64) (string, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[id]
+	if !ok {
+		return "", "", store.ErrUserNotFound
+	}
+	return u.Mail, u.hash, nil
+}
+
+func (m *memUserStorage) GetUser(ctx context.Context, id int64) (store.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[id]
+	if !ok {
+		return store.User{}, store.ErrUserNotFound
+	}
+	return u.User, nil
+}
+
+func (m *memUserStorage) MarkEmailVerified(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if u, ok := m.users[id]; ok && u.VerifiedAt.IsZero() {
+		u.VerifiedAt = time.Now()
+	}
+	return nil
+}
+
+func (m *memUserStorage) CreateSession(ctx context.Context, s store.Session) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.ID = int64(len(m.sessions) + 1)
+	token := fmt.Sprintf("session-token-%032d", s.ID)
+	m.sessions[token] = s
+	return token, nil
+}
+
+func (m *memUserStorage) GetUserIDByOIDCIdentity(ctx context.Context, issuer, subject string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, ok := m.identities[[2]string{issuer, subject}]
+	if !ok {
+		return 0, store.ErrOIDCIdentityNotFound
+	}
+	return id, nil
+}
+
+// LinkOIDCIdentity повторяет store.LinkOIDCIdentity: неподтверждённый аккаунт переходит владельцу
+// адреса, пароль и сессии прежнего регистранта удаляются.
+func (m *memUserStorage) LinkOIDCIdentity(ctx context.Context, userID int64, issuer, subject string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[userID]
+	if !ok {
+		return false, store.ErrUserNotFound
+	}
+	m.identities[[2]string{issuer, subject}] = userID
+	if !u.VerifiedAt.IsZero() {
+		return false, nil
+	}
+	u.VerifiedAt = time.Now()
+	u.hash = ""
+	for token, s := range m.sessions {
+		if s.UserID == userID {
+			delete(m.sessions, token)
+		}
+	}
+	return true, nil
+}
+
+func (m *memUserStorage) GetLoginThrottle(ctx context.Context, scope, key string) (store.LoginThrottle, error) {
+	return store.LoginThrottle{}, nil
+}
+
+func (m *memUserStorage) RecordLoginFailure(ctx context.Context, scope, key string, window time.Duration) (store.LoginThrottle, error) {
+	return store.LoginThrottle{Failures: 1, LastFailure: time.Now()}, nil
+}
+
+func (m *memUserStorage) ResetLoginThrottle(ctx context.Context, scope, key string) error {
+	return nil
+}
+
+func (m *memUserStorage) SaveLoginEvent(ctx context.Context, e store.LoginEvent) error {
+	return nil
+}
+
+func (m *memUserStorage) GetTOTP(ctx context.Context, userID int64) (store.TOTP, error) {
+	return store.TOTP{}, nil
+}
+
+// recordingMailer запоминает письма и передаёт их дальше, в next.
+type recordingMailer struct {
+	next mail.Mailer
+
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	m.sent = append(m.sent, msg)
+	m.mu.Unlock()
+	return m.next.Send(ctx, msg)
+}
+
+// captureLogs направляет логи в буфер через ту же маскировку, что и в main, до конца теста.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	h := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	slog.SetDefault(slog.New(logging.NewRedactHandler(h, logging.DefaultSensitiveKeys)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+// testCSRFToken — значение CSRF-куки и поля формы в тестовых запросах (43 символа, как у настоящего).
+var testCSRFToken = strings.Repeat("c", 43)
+
+// postForm отправляет форму с CSRF-токеном и возвращает ответ.
+func postForm(t *testing.T, h http.Handler, path string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	form.Set(csrfFieldName, testCSRFToken)
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: testCSRFToken})
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func responseCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
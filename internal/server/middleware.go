@@ -2,15 +2,40 @@ package server
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strings"
+	"url-shorter/internal/audit"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/service"
+	"url-shorter/internal/store"
 )
 
 // Определим ключ для контекста, чтобы избежать коллизий
 type contextKey string
-const userContextKey = contextKey("userID")
+
+const (
+	userContextKey       = contextKey("userID")
+	authMethodContextKey = contextKey("authMethod")
+	scopeContextKey      = contextKey("scope")
+	sessionContextKey    = contextKey("session")
+	apiTokenContextKey   = contextKey("apiTokenID")
+)
+
+// Способы, которыми пользователь подтвердил свою личность.
+const (
+	authMethodSession  = "session"   // куки session_token, браузер
+	authMethodAPIToken = "api_token" // Authorization: Bearer, скрипты
+)
 
 func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Скрипты присылают персональный токен в заголовке
+		if token, ok := bearerToken(r); ok {
+			s.authenticateAPIToken(w, r, next, token)
+			return
+		}
+
 		// Получаем куки
 		cookie, err := r.Cookie("session_token")
 		if err != nil {
@@ -21,25 +46,104 @@ func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
 
 		// Проверяем токен сессии в БД
 		token := cookie.Value
-		userID, err := s.userService.GetUserIDBySessionToken(r.Context(), token)
+		session, err := s.userService.AuthenticateSession(r.Context(), token)
 		if err != nil {
 			// Если сессия не найдена или истекла, удаляем куки и отправляем на вход
-			clearSessionCookie(w)
+			s.clearSessionCookie(w)
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
 
-		// Сохраняем ID пользователя в контексте запроса
-		// Это позволит другим хендлерам знать, какой пользователь отправил запрос
-		ctx := context.WithValue(r.Context(), userContextKey, userID)
-
-		// Вызываем следующий обработчик в цепочке с обновленным контекстом
-		next.ServeHTTP(w, r.WithContext(ctx))
+		// У сессии в браузере полный доступ
+		r = r.WithContext(context.WithValue(r.Context(), sessionContextKey, session))
+		s.serveAuthenticated(w, r, next, session.UserID, authMethodSession, store.ScopeWrite)
 	})
 }
 
+// authenticateAPIToken пускает запрос с API-токеном только в /api/ и только в пределах области действия токена:
+// с токеном "read" нельзя ничего менять.
+func (s *Server) authenticateAPIToken(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	apiToken, err := s.userService.AuthenticateAPIToken(r.Context(), token)
+	if err != nil {
+		if !errors.Is(err, service.ErrInvalidAPIToken) {
+			logging.FromContext(r.Context()).Error("failed to authenticate api token", "error", err)
+			writeJSONError(w, http.StatusInternalServerError, "server error")
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeJSONError(w, http.StatusUnauthorized, "invalid or expired api token")
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		writeJSONError(w, http.StatusForbidden, "api tokens are accepted only under /api/")
+		return
+	}
+	if apiToken.Scope == store.ScopeRead && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="write"`)
+		writeJSONError(w, http.StatusForbidden, "token scope does not allow this request")
+		return
+	}
+	// ID проверенного токена нужен лимитеру запросов: считаем по токену, а не по тому, что прислал клиент
+	r = r.WithContext(context.WithValue(r.Context(), apiTokenContextKey, apiToken.ID))
+	s.serveAuthenticated(w, r, next, apiToken.UserID, authMethodAPIToken, apiToken.Scope)
+}
+
+// serveAuthenticated кладёт пользователя в контекст и вызывает следующий обработчик.
+func (s *Server) serveAuthenticated(w http.ResponseWriter, r *http.Request, next http.Handler, userID int64, method, scope string) {
+	// Сохраняем ID пользователя в контексте запроса
+	// Это позволит другим хендлерам знать, какой пользователь отправил запрос
+	ctx := context.WithValue(r.Context(), userContextKey, userID)
+	ctx = context.WithValue(ctx, authMethodContextKey, method)
+	ctx = context.WithValue(ctx, scopeContextKey, scope)
+	ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With("user_id", userID))
+	actor := audit.ActorFromContext(ctx)
+	actor.UserID = userID
+	ctx = audit.WithActor(ctx, actor)
+
+	// Вызываем следующий обработчик в цепочке с обновленным контекстом
+	req := r.WithContext(ctx)
+	next.ServeHTTP(w, req)
+
+	// Вложенный роутер записал свой паттерн в req, отдаём его и пользователя в access-лог
+	if info := getRequestInfo(ctx); info != nil {
+		info.userID = userID
+		info.route = req.Pattern
+	}
+}
+
 // Хелпер для получения userID из контекста в других хендлерах
-func getUserIDFromContext(ctx context.Context) (int, bool) {
-    userID, ok := ctx.Value(userContextKey).(int)
-    return userID, ok
-}
\ No newline at end of file
+func getUserIDFromContext(ctx context.Context) (int64, bool) {
+	userID, ok := ctx.Value(userContextKey).(int64)
+	return userID, ok
+}
+
+// getAuthMethod возвращает способ аутентификации текущего запроса.
+func getAuthMethod(ctx context.Context) string {
+	method, _ := ctx.Value(authMethodContextKey).(string)
+	return method
+}
+
+// getSession возвращает текущую сессию (только для входа через браузер).
+func getSession(ctx context.Context) (store.Session, bool) {
+	session, ok := ctx.Value(sessionContextKey).(store.Session)
+	return session, ok
+}
+
+// getSessionID возвращает ID текущей сессии (только для входа через браузер).
+func getSessionID(ctx context.Context) (int64, bool) {
+	session, ok := getSession(ctx)
+	return session.ID, ok
+}
+
+// getAPITokenID возвращает ID API-токена, которым аутентифицирован запрос.
+func getAPITokenID(ctx context.Context) (int64, bool) {
+	id, ok := ctx.Value(apiTokenContextKey).(int64)
+	return id, ok
+}
+
+// bearerToken достаёт токен из заголовка Authorization: Bearer <token>.
+func bearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	token = strings.TrimSpace(token)
+	return token, ok && token != ""
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/oidc"
+	"url-shorter/internal/service"
+	"url-shorter/internal/store"
+)
+
+// oidcCookieName — куки с state/nonce/PKCE verifier между уходом к провайдеру и возвратом на callback.
+const oidcCookieName = "oidc_login"
+
+// OIDCProvider — внешний провайдер OpenID Connect (см. oidc.Provider).
+type OIDCProvider interface {
+	AuthCodeURL(state, nonce, verifier string) string
+	Exchange(ctx context.Context, code, verifier, nonce string) (oidc.Identity, error)
+}
+
+// SetOIDCProvider включает вход через провайдера; name показывается на кнопке на странице входа.
+// Вызывать нужно до Start.
+func (s *Server) SetOIDCProvider(name string, p OIDCProvider) {
+	s.oidc = p
+	s.oidcName = name
+}
+
+// GET /login/oidc — отправляем пользователя на страницу входа провайдера.
+func (s *Server) handleOIDCLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.oidc == nil {
+			http.NotFound(w, r)
+			return
+		}
+		login, token, err := s.userService.BeginOIDCLogin()
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to begin oidc login", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		http.SetCookie(w, s.newCookie(oidcCookieName, token, "/login/oidc", time.Now().Add(10*time.Minute)))
+		http.Redirect(w, r, s.oidc.AuthCodeURL(login.State, login.Nonce, login.Verifier), http.StatusFound)
+	}
+}
+
+// GET /login/oidc/callback — провайдер вернул пользователя с кодом авторизации.
+func (s *Server) handleOIDCCallback() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.oidc == nil {
+			http.NotFound(w, r)
+			return
+		}
+		log := logging.FromContext(r.Context())
+		query := r.URL.Query()
+
+		cookie, err := r.Cookie(oidcCookieName)
+		if err != nil {
+			s.renderLogin(w, r, http.StatusBadRequest, pageData{Errors: []string{"Время на вход истекло, попробуйте ещё раз"}})
+			return
+		}
+		s.clearCookie(w, oidcCookieName, "/login/oidc")
+
+		login, err := s.userService.ParseOIDCLogin(cookie.Value)
+		if err != nil || query.Get("state") != login.State {
+			log.Warn("oidc callback rejected: bad state", "error", err)
+			s.renderLogin(w, r, http.StatusBadRequest, pageData{Errors: []string{"Время на вход истекло, попробуйте ещё раз"}})
+			return
+		}
+		if e := query.Get("error"); e != "" {
+			log.Info("oidc provider returned error", "error", e, "description", query.Get("error_description"))
+			s.renderLogin(w, r, http.StatusUnauthorized, pageData{Errors: []string{"Вход через " + s.oidcName + " не выполнен"}})
+			return
+		}
+
+		identity, err := s.oidc.Exchange(r.Context(), query.Get("code"), login.Verifier, login.Nonce)
+		if err != nil {
+			log.Warn("oidc code exchange failed", "error", err)
+			s.renderLogin(w, r, http.StatusUnauthorized, pageData{Errors: []string{"Вход через " + s.oidcName + " не выполнен"}})
+			return
+		}
+
+		userID, mail, err := s.userService.LoginWithOIDC(r.Context(), identity)
+		if err != nil {
+			var msg string
+			switch {
+			case errors.Is(err, service.ErrOIDCEmailNotVerified):
+				msg = "Провайдер не подтвердил ваш email"
+			case errors.Is(err, service.ErrOIDCSignupDisabled):
+				msg = "Аккаунт не найден. Обратитесь к администратору"
+			case errors.Is(err, store.ErrUserExists):
+				msg = "Не удалось создать аккаунт, попробуйте ещё раз"
+			default:
+				log.Error("oidc login failed", "error", err)
+				http.Error(w, "Server error", http.StatusInternalServerError)
+				return
+			}
+			log.Info("oidc login rejected", "issuer", identity.Issuer, "error", err)
+			s.renderLogin(w, r, http.StatusForbidden, pageData{Errors: []string{msg}})
+			return
+		}
+
+		// заблокированный после перебора паролей аккаунт не должен открываться и через провайдера
+		if s.rejectBlockedLogin(w, r, mail, clientIP(r)) {
+			return
+		}
+		s.continueLogin(w, r, userID, mail, false)
+	}
+}
@@ -0,0 +1,366 @@
+package server
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	"url-shorter/internal/mail"
+	"url-shorter/internal/oidc"
+	"url-shorter/internal/store"
+)
+
+const (
+	testClientID     = "url-shorter"
+	testClientSecret = "client-secret"
+	testRedirectURL  = "http://short.test/login/oidc/callback"
+)
+
+// fakeProvider — провайдер OpenID Connect на httptest: discovery, JWKS и token endpoint.
+// Страницу входа провайдера заменяет authorize: он принимает адрес, на который нас отправил
+// сервер, и выдаёт код авторизации, как после успешного входа пользователя.
+type fakeProvider struct {
+	t   *testing.T
+	srv *httptest.Server
+	key *rsa.PrivateKey
+
+	mu            sync.Mutex
+	codes         map[string]authRequest
+	tokenRequests int
+	nonceOverride string // непустое — подставить в ID-токен этот nonce вместо присланного
+}
+
+// authRequest — то, что провайдер запомнил о запросе на вход до обмена кода.
+type authRequest struct {
+	challenge string
+	nonce     string
+	subject   string
+	email     string
+	verified  bool
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{t: t, key: key, codes: make(map[string]authRequest)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.handleDiscovery)
+	mux.HandleFunc("GET /keys", p.handleKeys)
+	mux.HandleFunc("POST /token", p.handleToken)
+	p.srv = httptest.NewServer(mux)
+	t.Cleanup(p.srv.Close)
+	return p
+}
+
+func (p *fakeProvider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.srv.URL,
+		"authorization_endpoint":                p.srv.URL + "/authorize",
+		"token_endpoint":                        p.srv.URL + "/token",
+		"jwks_uri":                              p.srv.URL + "/keys",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *fakeProvider) handleKeys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "test",
+		"alg": "RS256",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+	}}})
+}
+
+// handleToken обменивает код на ID-токен. Код одноразовый, а code_verifier должен соответствовать
+// code_challenge из запроса на вход (PKCE, S256).
+func (p *fakeProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tokenRequests++
+
+	if id, secret, ok := r.BasicAuth(); !ok || id != testClientID || secret != testClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	req, ok := p.codes[r.PostFormValue("code")]
+	delete(p.codes, r.PostFormValue("code"))
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != testRedirectURL {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != req.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	nonce := req.nonce
+	if p.nonceOverride != "" {
+		nonce = p.nonceOverride
+	}
+	now := time.Now()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token": p.sign(map[string]any{
+			"iss":            p.srv.URL,
+			"sub":            req.subject,
+			"aud":            testClientID,
+			"iat":            now.Unix(),
+			"exp":            now.Add(time.Hour).Unix(),
+			"nonce":          nonce,
+			"email":          req.email,
+			"email_verified": req.verified,
+		}),
+	})
+}
+
+// sign собирает JWT с подписью RS256.
+func (p *fakeProvider) sign(claims map[string]any) string {
+	enc := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			p.t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signingInput := enc(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"}) + "." + enc(claims)
+	sum := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, sum[:])
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// authorize проверяет запрос на вход (куда нас отправил сервер) и выдаёт код для пользователя
+// subject с адресом email, как если бы тот вошёл у провайдера.
+func (p *fakeProvider) authorize(authURL *url.URL, subject, email string) string {
+	p.t.Helper()
+	q := authURL.Query()
+	if got := authURL.Scheme + "://" + authURL.Host + authURL.Path; got != p.srv.URL+"/authorize" {
+		p.t.Fatalf("вход отправлен не на страницу провайдера: %s", got)
+	}
+	if q.Get("client_id") != testClientID || q.Get("redirect_uri") != testRedirectURL || q.Get("response_type") != "code" {
+		p.t.Fatalf("неверные параметры запроса на вход: %s", authURL)
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		p.t.Fatalf("запрос на вход без PKCE: %s", authURL)
+	}
+	if q.Get("state") == "" || q.Get("nonce") == "" {
+		p.t.Fatalf("запрос на вход без state или nonce: %s", authURL)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	code := "code-" + strconv.Itoa(len(p.codes)+1) + "-" + subject
+	p.codes[code] = authRequest{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), subject: subject, email: email, verified: true}
+	return code
+}
+
+func (p *fakeProvider) tokenRequestCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.tokenRequests
+}
+
+// newOIDCTestServer поднимает сервер с входом через фейкового провайдера.
+func newOIDCTestServer(t *testing.T, users *memUserStorage) (*Server, *fakeProvider) {
+	t.Helper()
+	p := newFakeProvider(t)
+	provider, err := oidc.NewProvider(t.Context(), oidc.Config{
+		Issuer:       p.srv.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+		Scopes:       []string{"email"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t, users, mail.LogMailer{})
+	srv.SetOIDCProvider("Test SSO", provider)
+	return srv, p
+}
+
+// beginOIDCLogin открывает /login/oidc и возвращает адрес, куда сервер отправил пользователя, и куку входа.
+func beginOIDCLogin(t *testing.T, srv *Server) (*url.URL, *http.Cookie) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login/oidc", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("GET /login/oidc: код %d", w.Code)
+	}
+	authURL, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookie := responseCookie(w, oidcCookieName)
+	if cookie == nil {
+		t.Fatal("GET /login/oidc не выставил куку входа")
+	}
+	return authURL, cookie
+}
+
+// oidcCallback возвращает браузер на /login/oidc/callback с кодом и state.
+func oidcCallback(t *testing.T, srv *Server, cookie *http.Cookie, state, code string) *httptest.ResponseRecorder {
+	t.Helper()
+	q := url.Values{"state": {state}, "code": {code}}
+	r := httptest.NewRequest(http.MethodGet, "/login/oidc/callback?"+q.Encode(), nil)
+	r.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	return w
+}
+
+func addUser(t *testing.T, users *memUserStorage, mailAddr, password string, verified bool) int64 {
+	t.Helper()
+	hash, err := HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := users.SaveUser(t.Context(), mailAddr, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified {
+		if err := users.MarkEmailVerified(t.Context(), id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return id
+}
+
+func TestOIDCLoginLinksVerifiedAccount(t *testing.T) {
+	users := newMemUserStorage()
+	id := addUser(t, users, "user@example.com", testPassword, true)
+	srv, p := newOIDCTestServer(t, users)
+
+	authURL, cookie := beginOIDCLogin(t, srv)
+	// провайдер отдаёт адрес в другом регистре — это тот же пользователь
+	code := p.authorize(authURL, "sub-1", "User@Example.COM")
+	w := oidcCallback(t, srv, cookie, authURL.Query().Get("state"), code)
+	if responseCookie(w, "session_token") == nil {
+		t.Fatalf("вход через провайдера не выдал сессию: код %d, тело %q", w.Code, w.Body.String())
+	}
+	if got, _ := users.GetUserIDByOIDCIdentity(t.Context(), p.srv.URL, "sub-1"); got != id {
+		t.Fatalf("учётная запись провайдера привязана к пользователю %d, ожидался %d", got, id)
+	}
+
+	// подтверждённый аккаунт остаётся за владельцем вместе с паролем
+	w = postForm(t, srv, "/login", url.Values{"mail": {"user@example.com"}, "password": {testPassword}})
+	if responseCookie(w, "session_token") == nil {
+		t.Fatalf("после привязки не работает вход по паролю: код %d", w.Code)
+	}
+}
+
+func TestOIDCLoginClaimsUnverifiedAccount(t *testing.T) {
+	users := newMemUserStorage()
+	// кто-то зарегистрировался на чужой адрес, не подтвердив его, и вошёл
+	const squatterPassword = "Squatter-Password-2024"
+	id := addUser(t, users, "victim@example.com", squatterPassword, false)
+	if _, err := users.CreateSession(t.Context(), store.Session{UserID: id}); err != nil {
+		t.Fatal(err)
+	}
+	srv, p := newOIDCTestServer(t, users)
+
+	authURL, cookie := beginOIDCLogin(t, srv)
+	code := p.authorize(authURL, "victim-sub", "victim@example.com")
+	w := oidcCallback(t, srv, cookie, authURL.Query().Get("state"), code)
+	session := responseCookie(w, "session_token")
+	if session == nil {
+		t.Fatalf("владелец адреса не смог войти через провайдера: код %d, тело %q", w.Code, w.Body.String())
+	}
+
+	user, _ := users.GetUser(t.Context(), id)
+	if user.VerifiedAt.IsZero() {
+		t.Error("email не отмечен подтверждённым после входа через провайдера")
+	}
+	for token, s := range users.sessions {
+		if s.UserID == id && token != session.Value {
+			t.Errorf("сессия прежнего регистранта %q осталась действующей", token)
+		}
+	}
+	w = postForm(t, srv, "/login", url.Values{"mail": {"victim@example.com"}, "password": {squatterPassword}})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("пароль прежнего регистранта всё ещё подходит: код %d", w.Code)
+	}
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	srv, p := newOIDCTestServer(t, newMemUserStorage())
+
+	authURL, cookie := beginOIDCLogin(t, srv)
+	code := p.authorize(authURL, "sub-1", "user@example.com")
+	w := oidcCallback(t, srv, cookie, "forged-state", code)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("callback с чужим state: код %d, ожидался 400", w.Code)
+	}
+	if responseCookie(w, "session_token") != nil {
+		t.Fatal("callback с чужим state выдал сессию")
+	}
+	if n := p.tokenRequestCount(); n != 0 {
+		t.Fatalf("при чужом state код всё равно обменяли у провайдера (%d запросов)", n)
+	}
+}
+
+func TestOIDCCallbackRejectsNonceMismatch(t *testing.T) {
+	users := newMemUserStorage()
+	addUser(t, users, "user@example.com", testPassword, true)
+	srv, p := newOIDCTestServer(t, users)
+	// ID-токен выдан для другого входа (например, перехвачен и подставлен)
+	p.nonceOverride = "nonce-from-another-login"
+
+	authURL, cookie := beginOIDCLogin(t, srv)
+	code := p.authorize(authURL, "sub-1", "user@example.com")
+	w := oidcCallback(t, srv, cookie, authURL.Query().Get("state"), code)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("ID-токен с чужим nonce: код %d, ожидался 401", w.Code)
+	}
+	if responseCookie(w, "session_token") != nil {
+		t.Fatal("ID-токен с чужим nonce выдал сессию")
+	}
+}
+
+func TestOIDCCallbackRejectsCodeFromAnotherLogin(t *testing.T) {
+	users := newMemUserStorage()
+	addUser(t, users, "user@example.com", testPassword, true)
+	srv, p := newOIDCTestServer(t, users)
+
+	// код, выданный на другой вход (с другим code_challenge), подставлен в наш callback:
+	// state совпадает, но PKCE verifier из нашей куки к этому коду не подходит
+	victimURL, victimCookie := beginOIDCLogin(t, srv)
+	attackerURL, _ := beginOIDCLogin(t, srv)
+	code := p.authorize(attackerURL, "attacker-sub", "user@example.com")
+
+	w := oidcCallback(t, srv, victimCookie, victimURL.Query().Get("state"), code)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("код от другого входа: код %d, ожидался 401", w.Code)
+	}
+	if responseCookie(w, "session_token") != nil {
+		t.Fatal("код от другого входа выдал сессию")
+	}
+	// отказ должен прийти от провайдера при проверке PKCE, а не раньше
+	if p.tokenRequestCount() == 0 {
+		t.Fatal("код не дошёл до провайдера")
+	}
+}
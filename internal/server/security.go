@@ -0,0 +1,86 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/store"
+)
+
+// securityData — данные страницы "Безопасность" со списком активных сессий.
+type securityData struct {
+	Sessions  []store.Session
+	CurrentID int64 // сессия, из которой открыта страница
+	Errors    []string
+	Success   string
+}
+
+func (s *Server) renderSecurity(w http.ResponseWriter, r *http.Request, status int, data securityData) {
+	userID, _ := getUserIDFromContext(r.Context())
+	sessions, err := s.userService.ListSessions(r.Context(), userID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to list sessions", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	data.Sessions = sessions
+	data.CurrentID, _ = getSessionID(r.Context())
+	render(w, r, status, "security.html", data)
+}
+
+func (s *Server) handleSecurityPage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireSession(w, r) {
+			return
+		}
+		s.renderSecurity(w, r, http.StatusOK, securityData{})
+	}
+}
+
+func (s *Server) handleRevokeSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireSession(w, r) {
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if err := s.userService.RevokeSession(r.Context(), userID, id); err != nil {
+			if errors.Is(err, store.ErrSessionNotFound) {
+				http.NotFound(w, r)
+				return
+			}
+			logging.FromContext(r.Context()).Error("failed to revoke session", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		// завершили текущую сессию — это тот же выход
+		if current, _ := getSessionID(r.Context()); current == id {
+			s.clearSessionCookie(w)
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		s.renderSecurity(w, r, http.StatusOK, securityData{Success: "Сессия завершена"})
+	}
+}
+
+func (s *Server) handleRevokeOtherSessions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireSession(w, r) {
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		current, _ := getSessionID(r.Context())
+		n, err := s.userService.RevokeOtherSessions(r.Context(), userID, current)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to revoke other sessions", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		s.renderSecurity(w, r, http.StatusOK, securityData{Success: "Завершено сессий: " + strconv.FormatInt(n, 10)})
+	}
+}
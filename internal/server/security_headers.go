@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"url-shorter/internal/logging"
+)
+
+const cspNonceContextKey = contextKey("cspNonce")
+
+// SecurityHeaders — настраиваемая часть заголовков безопасности.
+type SecurityHeaders struct {
+	HSTSMaxAge            int // секунды; 0 — не отправлять Strict-Transport-Security (без HTTPS он вреден)
+	HSTSIncludeSubdomains bool
+	ReferrerPolicy        string
+	PermissionsPolicy     string
+	CSPReportURI          string // куда браузер шлёт отчёты о нарушениях CSP; пусто — никуда
+}
+
+// DefaultSecurityHeaders используются, если в конфиге ничего не задано.
+var DefaultSecurityHeaders = SecurityHeaders{
+	ReferrerPolicy:    "strict-origin-when-cross-origin",
+	PermissionsPolicy: "camera=(), microphone=(), geolocation=(), payment=(), usb=()",
+}
+
+// SetSecurityHeaders задаёт заголовки безопасности. Вызывать нужно до Start.
+func (s *Server) SetSecurityHeaders(h SecurityHeaders) {
+	if h.ReferrerPolicy == "" {
+		h.ReferrerPolicy = DefaultSecurityHeaders.ReferrerPolicy
+	}
+	if h.PermissionsPolicy == "" {
+		h.PermissionsPolicy = DefaultSecurityHeaders.PermissionsPolicy
+	}
+	s.securityHeaders = h
+}
+
+// SecurityHeadersMiddleware добавляет заголовки безопасности ко всем ответам.
+// Content-Security-Policy выбирается по ответу: для HTML-страниц разрешены только свои ресурсы
+// и встроенные скрипты/стили с одноразовым nonce, остальным ответам (JSON, редиректы, файлы) не разрешено ничего.
+func (s *Server) SecurityHeadersMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			logging.FromContext(r.Context()).Error("failed to generate csp nonce", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		nonce := base64.RawURLEncoding.EncodeToString(b)
+
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", s.securityHeaders.ReferrerPolicy)
+		h.Set("Permissions-Policy", s.securityHeaders.PermissionsPolicy)
+		if s.securityHeaders.HSTSMaxAge > 0 {
+			hsts := "max-age=" + strconv.Itoa(s.securityHeaders.HSTSMaxAge)
+			if s.securityHeaders.HSTSIncludeSubdomains {
+				hsts += "; includeSubDomains"
+			}
+			h.Set("Strict-Transport-Security", hsts)
+		}
+
+		cw := &cspWriter{ResponseWriter: w, server: s, nonce: nonce}
+		next.ServeHTTP(cw, r.WithContext(context.WithValue(r.Context(), cspNonceContextKey, nonce)))
+	})
+}
+
+// contentSecurityPolicy возвращает политику для ответа с кодом status и типом contentType.
+func (s *Server) contentSecurityPolicy(status int, contentType, nonce string) string {
+	var directives []string
+	switch {
+	case status >= 300 && status < 400:
+		// у редиректа нет содержимого
+		directives = []string{"default-src 'none'", "frame-ancestors 'none'"}
+	case strings.HasPrefix(contentType, "text/html"):
+		directives = []string{
+			"default-src 'self'",
+			"script-src 'nonce-" + nonce + "'",
+			"style-src 'nonce-" + nonce + "'",
+			"img-src 'self' data:", // QR-код 2FA встраивается как data: URL
+			"form-action 'self'",
+			"frame-ancestors 'none'",
+			"base-uri 'none'",
+			"object-src 'none'",
+		}
+	default:
+		// JSON API, текстовые ошибки, статика: браузеру нечего исполнять
+		directives = []string{"default-src 'none'", "frame-ancestors 'none'", "sandbox"}
+	}
+	if s.securityHeaders.CSPReportURI != "" {
+		directives = append(directives, "report-uri "+s.securityHeaders.CSPReportURI)
+	}
+	return strings.Join(directives, "; ")
+}
+
+// cspWriter ставит Content-Security-Policy в момент отправки заголовков, когда уже известны код и тип ответа.
+type cspWriter struct {
+	http.ResponseWriter
+	server      *Server
+	nonce       string
+	wroteHeader bool
+}
+
+func (w *cspWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		h := w.Header()
+		h.Set("Content-Security-Policy", w.server.contentSecurityPolicy(status, h.Get("Content-Type"), w.nonce))
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cspWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *cspWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// cspNonce — nonce текущего запроса для встроенных <script> и <style>, в шаблонах — {{ cspNonce }}.
+func cspNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(cspNonceContextKey).(string)
+	return nonce
+}
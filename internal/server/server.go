@@ -7,100 +7,396 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"url-shorter/internal/importer"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/oidc"
+	"url-shorter/internal/ratelimit"
+	"url-shorter/internal/service"
 	"url-shorter/internal/store"
 )
 
 // URLShortener описывает сервис для работы с URL.
 type URLShortener interface {
-	CreateShortURL(originalURL string) (string, error)
-	GetOriginalURL(alias string) (string, error)
+	CreateShortURL(ctx context.Context, owner store.Owner, originalURL string) (string, string, error)
+	GetOriginalURL(ctx context.Context, alias string) (string, error)
+	Resolve(ctx context.Context, alias string) (store.Redirect, error)
+	ListLinks(ctx context.Context, owner store.Owner, filter store.LinkFilter) ([]store.Link, error)
+	LinkStats(ctx context.Context, owner store.Owner, filter store.LinkFilter) (store.LinkStats, error)
+	GetLink(ctx context.Context, userID int64, alias string) (store.Link, bool, error)
+	LinkHistory(ctx context.Context, userID int64, alias string) ([]store.LinkVersion, error)
+	UpdateLink(ctx context.Context, userID int64, alias string, edit store.LinkEdit) (store.Link, error)
+	RollbackLink(ctx context.Context, userID int64, alias string, versionID int64) (store.Link, error)
+	DeleteLink(ctx context.Context, userID int64, alias string) error
+	RestoreLink(ctx context.Context, userID int64, alias string) (store.Link, error)
+	Trash(ctx context.Context, owner store.Owner) ([]store.Link, error)
+	PurgeAt(deletedAt time.Time) time.Time
+	Tags(ctx context.Context, owner store.Owner) ([]store.Tag, error)
+	SetLinkTags(ctx context.Context, userID int64, alias string, tags []string) (store.Link, error)
+	BulkTagLinks(ctx context.Context, userID int64, aliases, add, remove []string) (int, error)
+	Folders(ctx context.Context, owner store.Owner) ([]store.Folder, error)
+	CreateFolder(ctx context.Context, userID, workspaceID int64, name string) (store.Folder, error)
+	DeleteFolder(ctx context.Context, userID, workspaceID, folderID int64) error
+	MoveLink(ctx context.Context, userID int64, alias string, folderID int64) (store.Link, error)
+	ShortenBulk(ctx context.Context, owner store.Owner, links []store.NewLink, atomic bool) ([]service.BulkResult, error)
+	ImportLinks(ctx context.Context, owner store.Owner, records []importer.Record, opts service.ImportOptions) ([]service.ImportResult, error)
+	RecordClick(linkID int64)
 }
 
 type UserService interface {
-	RegisterUser(ctx context.Context, mail, hash string) error
+	RegisterUser(ctx context.Context, mail, hash string) (int64, error)
 	DeleteSession(ctx context.Context, sessionID string) error
-	CreateSession(ctx context.Context, userID int64) (string, error)
+	CreateSession(ctx context.Context, userID int64, ip, userAgent string, remember bool) (string, time.Time, error)
 	GetUserByEmail(ctx context.Context, mail string) (int64, string, error)
-	GetUserIDBySessionToken(ctx context.Context, token string) (int64, error)
+	GetUserByID(ctx context.Context, id int64) (string, string, error)
+	GetUser(ctx context.Context, id int64) (store.User, error)
+	AuthenticateSession(ctx context.Context, token string) (store.Session, error)
+	ListSessions(ctx context.Context, userID int64) ([]store.Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID int64) error
+	RevokeOtherSessions(ctx context.Context, userID, currentID int64) (int64, error)
+
+	CheckLoginAllowed(ctx context.Context, mail, ip string) error
+	LoginFailed(ctx context.Context, userID int64, mail, ip string) error
+	LoginSucceeded(ctx context.Context, userID int64, mail, ip string) error
+
+	ValidatePassword(mail, password string) error
+	UpdatePassword(ctx context.Context, id int64, hash string) error
+
+	SendVerificationEmail(ctx context.Context, userID int64, mail, verifyURL string) error
+	VerifyEmail(ctx context.Context, token string) (int64, error)
+	IsEmailVerified(ctx context.Context, userID int64) (bool, error)
+
+	TwoFactorRequired() bool
+	TwoFactorEnabled(ctx context.Context, userID int64) (bool, error)
+	BeginTOTPEnrollment(ctx context.Context, userID int64) (service.TOTPEnrollment, error)
+	PendingTOTPEnrollment(ctx context.Context, userID int64) (service.TOTPEnrollment, error)
+	ConfirmTOTPEnrollment(ctx context.Context, userID int64, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, userID int64, code string) error
+	VerifySecondFactor(ctx context.Context, userID int64, code string) error
+	NewLoginChallenge(userID int64, remember bool) string
+	ParseLoginChallenge(token string) (int64, bool, error)
+
+	CreateAPIToken(ctx context.Context, userID int64, name, scope string, expiresAt time.Time) (string, error)
+	ListAPITokens(ctx context.Context, userID int64) ([]store.APIToken, error)
+	RevokeAPIToken(ctx context.Context, userID, tokenID int64) error
+	AuthenticateAPIToken(ctx context.Context, token string) (store.APIToken, error)
+
+	BeginOIDCLogin() (service.OIDCLogin, string, error)
+	ParseOIDCLogin(token string) (service.OIDCLogin, error)
+	LoginWithOIDC(ctx context.Context, id oidc.Identity) (int64, string, error)
+
+	RequestPasswordReset(ctx context.Context, mail, resetURL string) error
+	GetPasswordResetUser(ctx context.Context, token string) (int64, string, error)
+	ResetPassword(ctx context.Context, token, hash string) (int64, error)
 }
 
 // Server - наш HTTP-сервер.
 type Server struct {
-	router      *http.ServeMux
-	urlService  URLShortener
-	userService UserService
-	server      *http.Server
+	router       *http.ServeMux
+	handler      http.Handler // router, обёрнутый в общие middleware
+	urlService   URLShortener
+	userService  UserService
+	adminService AdminService
+	// workspaceService — рабочие пространства и их ссылки
+	workspaceService WorkspaceService
+	server           *http.Server
+
+	readinessChecks []readinessCheck
+	shuttingDown    atomic.Bool   // выставляется в Shutdown, после этого /readyz отвечает 503
+	drainDelay      time.Duration // сколько Shutdown ждёт после перехода в «не готов», прежде чем закрыть listener
+
+	limiter    ratelimit.Limiter
+	rateLimits map[string]ratelimit.Policy // политики по группам маршрутов
+
+	oidc     OIDCProvider // nil, если вход через провайдера выключен
+	oidcName string
+
+	secureCookies   bool // ставить куки с атрибутом Secure (только по HTTPS)
+	securityHeaders SecurityHeaders
 }
 
 // New создает и настраивает экземпляр нашего сервера.
-func New(addr string, urls URLShortener, usrs UserService) *Server {
+func New(addr string, urls URLShortener, usrs UserService, admin AdminService, workspaces WorkspaceService) *Server {
 	srv := &Server{
-		router:      http.NewServeMux(),
-		urlService:  urls,
-		userService: usrs,
+		router:           http.NewServeMux(),
+		urlService:       urls,
+		userService:      usrs,
+		adminService:     admin,
+		workspaceService: workspaces,
+		securityHeaders:  DefaultSecurityHeaders,
 	}
 	srv.server = &http.Server{
 		Addr:    addr,
 		Handler: srv, // Используем srv как обработчик для логирования
 	}
+	templates()
 	srv.routes() // заполняем router (маршрутизатор)
+	// Цепочка применяется ко всем запросам: снаружи — request ID, затем access-лог,
+	// заголовки безопасности и проверка CSRF
+	srv.handler = srv.RequestIDMiddleware(srv.AccessLogMiddleware(srv.SecurityHeadersMiddleware(srv.CSRFMiddleware(srv.router))))
 	return srv
 }
 
-// ServeHTTP добавляет логирование ко всем запросам.
+// ServeHTTP пропускает все запросы через цепочку middleware.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	slog.Info("request received", "method", r.Method, "path", r.URL.Path)
-	s.router.ServeHTTP(w, r)
+	s.handler.ServeHTTP(w, r)
 }
 
 func (s *Server) routes() {
+	// --- Служебные маршруты для оркестратора, без аутентификации ---
+	s.router.HandleFunc("GET /healthz", s.handleHealthz())
+	s.router.HandleFunc("GET /readyz", s.handleReadyz())
+
 	// --- Публичные маршруты, доступные всем ---
 	s.router.Handle("GET /static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
 	s.router.HandleFunc("GET /register", s.handleRegisterPage())
-	s.router.HandleFunc("POST /register", s.handleRegister())
+	s.router.Handle("POST /register", s.RateLimit(rateLimitLogin, s.handleRegister()))
 	s.router.HandleFunc("GET /login", s.handleLoginPage())
-	s.router.HandleFunc("POST /login", s.handleLogin())
-	s.router.HandleFunc("GET /{alias}", s.handleRedirect()) // Редирект тоже публичный
+	s.router.Handle("POST /login", s.RateLimit(rateLimitLogin, s.handleLogin()))
+	s.router.HandleFunc("GET /login/2fa", s.handleLoginTwoFactorPage())
+	s.router.Handle("POST /login/2fa", s.RateLimit(rateLimitLogin, s.handleLoginTwoFactor()))
+	s.router.Handle("GET /login/oidc", s.RateLimit(rateLimitLogin, s.handleOIDCLogin()))
+	s.router.Handle("GET /login/oidc/callback", s.RateLimit(rateLimitLogin, s.handleOIDCCallback()))
+	s.router.HandleFunc("GET /verify", s.handleVerifyEmail())
+	s.router.HandleFunc("GET /forgot", s.handleForgotPage())
+	s.router.Handle("POST /forgot", s.RateLimit(rateLimitLogin, s.handleForgotPassword()))
+	s.router.HandleFunc("GET /reset", s.handleResetPage())
+	s.router.Handle("POST /reset", s.RateLimit(rateLimitLogin, s.handleResetPassword()))
+	s.router.Handle("GET /{alias}", s.RateLimit(rateLimitRedirect, s.handleRedirect())) // Редирект тоже публичный
 
 	// --- Защищенные маршруты, требующие входа ---
 	authHandler := http.NewServeMux()
 	authHandler.HandleFunc("GET /{$}", s.handleHome()) // Главная страница теперь защищена
-	authHandler.HandleFunc("POST /shorten", s.handleShortenURL())
+	authHandler.Handle("POST /shorten", s.RateLimit(rateLimitShorten, s.handleShortenURL()))
+	authHandler.HandleFunc("GET /bulk", s.handleBulkPage())
+	authHandler.Handle("POST /bulk", s.RateLimit(rateLimitShorten, s.handleBulkShorten()))
+	authHandler.HandleFunc("GET /import", s.handleImportPage())
+	authHandler.Handle("POST /import", s.RateLimit(rateLimitShorten, s.handleImport()))
 	authHandler.HandleFunc("POST /logout", s.handleLogout()) // Метод POST более корректен для выхода
+	authHandler.HandleFunc("GET /password", s.handlePasswordPage())
+	authHandler.HandleFunc("POST /password", s.handleChangePassword())
+	authHandler.Handle("POST /verify/resend", s.RateLimit(rateLimitLogin, s.handleResendVerification()))
+	authHandler.HandleFunc("GET /2fa", s.handleTwoFactorPage())
+	authHandler.HandleFunc("POST /2fa/setup", s.handleTwoFactorSetup())
+	authHandler.HandleFunc("POST /2fa/enable", s.handleTwoFactorEnable())
+	authHandler.HandleFunc("POST /2fa/disable", s.handleTwoFactorDisable())
+	authHandler.HandleFunc("GET /security", s.handleSecurityPage())
+	authHandler.HandleFunc("POST /security/sessions/{id}/revoke", s.handleRevokeSession())
+	authHandler.HandleFunc("POST /security/sessions/revoke-others", s.handleRevokeOtherSessions())
+	authHandler.HandleFunc("GET /tokens", s.handleTokensPage())
+	authHandler.HandleFunc("POST /tokens", s.handleCreateToken())
+	authHandler.HandleFunc("POST /tokens/{id}/revoke", s.handleRevokeToken())
+	authHandler.HandleFunc("GET /links/{alias}", s.handleLinkPage())
+	authHandler.HandleFunc("POST /links/{alias}", s.handleUpdateLink())
+	authHandler.HandleFunc("POST /links/{alias}/rollback/{version}", s.handleRollbackLink())
+	authHandler.HandleFunc("POST /links/{alias}/delete", s.handleDeleteLink())
+	authHandler.HandleFunc("GET /trash", s.handleTrashPage())
+	authHandler.HandleFunc("POST /trash/{alias}/restore", s.handleRestoreLink())
+	authHandler.HandleFunc("POST /links/{alias}/tags", s.handleSetLinkTags())
+	authHandler.HandleFunc("POST /tags/bulk", s.handleBulkTags())
+	authHandler.HandleFunc("GET /links.csv", s.handleExportLinks())
+	authHandler.HandleFunc("POST /folders", s.handleCreateFolder())
+	authHandler.HandleFunc("POST /folders/{id}/delete", s.handleDeleteFolder())
+	authHandler.HandleFunc("GET /workspaces", s.handleWorkspacesPage())
+	authHandler.HandleFunc("POST /workspaces", s.handleCreateWorkspace())
+	authHandler.HandleFunc("POST /workspaces/switch", s.handleSwitchWorkspace())
+	authHandler.HandleFunc("GET /workspaces/join", s.handleJoinWorkspacePage())
+	authHandler.HandleFunc("POST /workspaces/join", s.handleJoinWorkspace())
+	authHandler.HandleFunc("GET /workspaces/{id}", s.handleWorkspacePage())
+	authHandler.HandleFunc("POST /workspaces/{id}/invite", s.handleInviteToWorkspace())
+	authHandler.HandleFunc("POST /workspaces/{id}/members/{user}/role", s.handleSetMemberRole())
+	authHandler.HandleFunc("POST /workspaces/{id}/members/{user}/remove", s.handleRemoveMember())
+	authHandler.HandleFunc("POST /workspaces/{id}/invites/{invite}/revoke", s.handleRevokeInvite())
+	authHandler.Handle("/admin/", s.RequireAdminMiddleware(s.adminRoutes()))
+
+	// JSON API: сюда же пускают запросы с Authorization: Bearer <API-токен>
+	authHandler.HandleFunc("GET /api/me", s.handleAPIMe())
+	authHandler.HandleFunc("GET /api/workspaces", s.handleAPIWorkspaces())
+	authHandler.HandleFunc("GET /api/links", s.handleAPIListLinks())
+	authHandler.Handle("POST /api/shorten", s.RateLimit(rateLimitShorten, s.handleAPIShorten()))
+	authHandler.Handle("POST /api/shorten/bulk", s.RateLimit(rateLimitShorten, s.handleAPIShortenBulk()))
+	authHandler.HandleFunc("GET /api/links/{alias}", s.handleAPIGetLink())
+	authHandler.HandleFunc("PATCH /api/links/{alias}", s.handleAPIUpdateLink())
+	authHandler.HandleFunc("GET /api/links/{alias}/history", s.handleAPILinkHistory())
+	authHandler.HandleFunc("POST /api/links/{alias}/rollback/{version}", s.handleAPIRollbackLink())
+	authHandler.HandleFunc("DELETE /api/links/{alias}", s.handleAPIDeleteLink())
+	authHandler.HandleFunc("GET /api/trash", s.handleAPITrash())
+	authHandler.HandleFunc("POST /api/trash/{alias}/restore", s.handleAPIRestoreLink())
+	authHandler.HandleFunc("GET /api/tags", s.handleAPITags())
+	authHandler.HandleFunc("GET /api/stats", s.handleAPIStats())
+	authHandler.HandleFunc("POST /api/tags/bulk", s.handleAPIBulkTags())
+	authHandler.HandleFunc("GET /api/folders", s.handleAPIFolders())
+	authHandler.HandleFunc("POST /api/folders", s.handleAPICreateFolder())
 
 	// Оборачиваем этот обработчик в middleware и регистрируем на главном роутере
 	// Все запросы, начинающиеся с "/", которые не совпали с публичными маршрутами выше,
 	// будут направлены сюда и пройдут через проверку аутентификации.
-	s.router.Handle("/", s.AuthMiddleware(authHandler))
+	s.router.Handle("/", s.AuthMiddleware(s.Require2FAMiddleware(authHandler)))
 }
 
 // Start запускает сервер.
 func (s *Server) Start() error {
 	slog.Info("server starting", "address", s.server.Addr)
-	return s.server.ListenAndServe()
+	err := s.server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// SetDrainDelay задаёт паузу между переходом в состояние "не готов" и закрытием listener:
+// за это время оркестратор успевает увидеть 503 на /readyz и перестать слать трафик.
+func (s *Server) SetDrainDelay(d time.Duration) {
+	s.drainDelay = d
+}
+
+// Shutdown переводит сервер в состояние "не готов", ждёт drainDelay (или отмены ctx),
+// затем перестаёт принимать соединения и дожидается завершения активных запросов.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shuttingDown.Store(true)
+	if s.drainDelay > 0 {
+		slog.Info("server draining", "delay", s.drainDelay)
+		timer := time.NewTimer(s.drainDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+	slog.Info("server shutting down")
+	return s.server.Shutdown(ctx)
 }
 
 // ----- Хендлеры для html страниц регистрации и входа -----
 
-var tmpl = template.Must(template.ParseGlob("templates/*.html")) // загрузили все html
+// templateFuncs — функции, зависящие от запроса. Здесь заглушки, настоящие подставляет render.
+var templateFuncs = template.FuncMap{
+	"csrfField": func() template.HTML { return "" },
+	"cspNonce":  func() string { return "" },
+}
+
+// templates загружает все html из каталога templates относительно рабочего каталога при первом вызове.
+// New вызывает её сразу, чтобы сервер с битыми шаблонами падал при старте, а не на первом запросе.
+var templates = sync.OnceValue(func() *template.Template {
+	return template.Must(template.New("").Funcs(templateFuncs).ParseGlob("templates/*.html"))
+})
+
+// pageData — данные для страниц с формами: введённый email (чтобы не набирать заново),
+// ошибки и сообщение об успехе.
+type pageData struct {
+	Mail    string
+	Errors  []string
+	Success string
+	Token   string // токен из ссылки в письме (страница сброса пароля)
+	SSOName string // название OIDC-провайдера для кнопки на странице входа; пусто — кнопки нет
+}
+
+// render отрисовывает шаблон name с кодом ответа status.
+// Шаблоны клонируются на каждый запрос, чтобы подставить в них CSRF-токен и CSP nonce этого запроса.
+func render(w http.ResponseWriter, r *http.Request, status int, name string, data any) {
+	t, err := templates().Clone()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to clone templates", "error", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+	t.Funcs(template.FuncMap{
+		"csrfField": func() template.HTML { return csrfField(r) },
+		"cspNonce":  func() string { return cspNonce(r) },
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := t.ExecuteTemplate(w, name, data); err != nil {
+		logging.FromContext(r.Context()).Error("failed to execute template", "template", name, "error", err)
+	}
+}
+
+// renderLogin отрисовывает страницу входа, добавляя кнопку входа через провайдера, если он настроен.
+func (s *Server) renderLogin(w http.ResponseWriter, r *http.Request, status int, data pageData) {
+	if s.oidc != nil {
+		data.SSOName = s.oidcName
+	}
+	render(w, r, status, "login.html", data)
+}
 
 func (s *Server) handleRegisterPage() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		tmpl.ExecuteTemplate(w, "register.html", nil)
+		render(w, r, http.StatusOK, "register.html", pageData{})
 	}
 }
 
 func (s *Server) handleLoginPage() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		tmpl.ExecuteTemplate(w, "login.html", nil)
+		data := pageData{}
+		if r.URL.Query().Get("registered") != "" {
+			data.Success = "Регистрация прошла успешно. Мы отправили письмо со ссылкой для подтверждения email."
+		}
+		s.renderLogin(w, r, http.StatusOK, data)
 	}
 }
 
-// homePage html handler
-var homeTmpl = template.Must(template.ParseFiles("templates/home.html"))
+func (s *Server) handlePasswordPage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render(w, r, http.StatusOK, "password.html", pageData{})
+	}
+}
 
 type homeData struct {
 	ShortURL string
+	Verified bool // пока email не подтверждён, создавать ссылки нельзя
+	Resent   bool
+	IsAdmin  bool
+
+	Workspace  store.Membership   // где сейчас создаются ссылки
+	Workspaces []store.Membership // куда можно переключиться
+	Links      []store.Link       // последние ссылки текущего пространства, отобранные по Filter
+	Filter     store.LinkFilter
+	Stats      store.LinkStats // все ссылки под Filter и переходы по ним, а не только показанные
+	Tags       []store.Tag
+	Folders    []store.Folder
+	Errors     []string
+	Success    string
+}
+
+func (s *Server) renderHome(w http.ResponseWriter, r *http.Request, status int, data homeData) {
+	userID, _ := getUserIDFromContext(r.Context())
+	user, err := s.userService.GetUser(r.Context(), userID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to get user", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	data.Verified = !user.VerifiedAt.IsZero()
+	data.IsAdmin = user.IsAdmin()
+	data.Filter = linkFilter(r)
+	data.Workspace, err = s.currentWorkspace(r)
+	if err == nil {
+		data.Workspaces, err = s.workspaceService.List(r.Context(), userID)
+	}
+	owner := store.Owner{UserID: userID, WorkspaceID: data.Workspace.WorkspaceID}
+	if err == nil {
+		data.Links, err = s.urlService.ListLinks(r.Context(), owner, data.Filter)
+	}
+	if err == nil {
+		data.Stats, err = s.urlService.LinkStats(r.Context(), owner, data.Filter)
+	}
+	if err == nil {
+		data.Tags, err = s.urlService.Tags(r.Context(), owner)
+	}
+	if err == nil {
+		data.Folders, err = s.urlService.Folders(r.Context(), owner)
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to load links", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	render(w, r, status, "home.html", data)
 }
 
 func (s *Server) handleHome() http.HandlerFunc {
@@ -111,15 +407,14 @@ func (s *Server) handleHome() http.HandlerFunc {
 			return
 		}
 
-		short := r.URL.Query().Get("short")
-
-		data := homeData{ShortURL: short}
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		err := homeTmpl.Execute(w, data)
-		if err != nil {
-			slog.Error("failed to execute template", "error", err)
-			http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		data := homeData{
+			ShortURL: r.URL.Query().Get("short"),
+			Resent:   r.URL.Query().Get("resent") != "",
 		}
+		if n := r.URL.Query().Get("tagged"); n != "" {
+			data.Success = "Теги обновлены у ссылок: " + n
+		}
+		s.renderHome(w, r, http.StatusOK, data)
 	}
 }
 
@@ -128,21 +423,49 @@ func (s *Server) handleHome() http.HandlerFunc {
 // запрос на сокращение ссылки
 func (s *Server) handleShortenURL() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context())
 		if err := r.ParseForm(); err != nil {
-			slog.Error("failed to parse form", "error", err)
+			log.Error("failed to parse form", "error", err)
 			http.Error(w, "Invalid form data", http.StatusBadRequest)
 			return
 		}
 
+		userID, _ := getUserIDFromContext(r.Context())
+		verified, err := s.userService.IsEmailVerified(r.Context(), userID)
+		if err != nil {
+			log.Error("failed to check email verification", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		if !verified {
+			http.Error(w, "Confirm your email before creating links", http.StatusForbidden)
+			return
+		}
+
 		longURL := r.FormValue("url")
 		if longURL == "" {
 			http.Error(w, "URL is required", http.StatusBadRequest)
 			return
 		}
 
-		alias, err := s.urlService.CreateShortURL(longURL)
+		workspace, err := s.currentWorkspace(r)
 		if err != nil {
-			slog.Error("failed to create short url", "error", err)
+			log.Error("failed to get current workspace", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		if !workspace.CanEdit() {
+			http.Error(w, "Viewers cannot create links in this workspace", http.StatusForbidden)
+			return
+		}
+
+		alias, _, err := s.urlService.CreateShortURL(r.Context(), store.Owner{UserID: userID, WorkspaceID: workspace.WorkspaceID}, longURL)
+		if errors.Is(err, service.ErrInvalidLinkURL) {
+			s.renderHome(w, r, http.StatusBadRequest, homeData{Errors: []string{linkURLMessage(err)}})
+			return
+		}
+		if err != nil {
+			log.Error("failed to create short url", "error", err)
 			http.Error(w, "Failed to create short URL", http.StatusInternalServerError)
 			return
 		}
@@ -162,14 +485,27 @@ func (s *Server) handleRedirect() http.HandlerFunc {
 			return
 		}
 
-		originalURL, err := s.urlService.GetOriginalURL(alias)
+		target, err := s.urlService.Resolve(r.Context(), alias)
+		if errors.Is(err, store.ErrShortURLTakenDown) {
+			http.Error(w, "This link has been disabled by the administrator", http.StatusGone)
+			return
+		}
+		if errors.Is(err, store.ErrShortURLDeleted) {
+			http.Error(w, "This link has been deleted", http.StatusGone)
+			return
+		}
+		if errors.Is(err, store.ErrShortURLExpired) {
+			http.Error(w, "This link has expired", http.StatusGone)
+			return
+		}
 		if err != nil {
-			slog.Warn("alias not found", "alias", alias, "error", err)
+			logging.FromContext(r.Context()).Warn("alias not found", "alias", alias, "error", err)
 			http.NotFound(w, r)
 			return
 		}
 
-		http.Redirect(w, r, originalURL, http.StatusFound)
+		s.urlService.RecordClick(target.LinkID)
+		http.Redirect(w, r, target.URL, http.StatusFound)
 	}
 }
 
@@ -178,23 +514,37 @@ func (s *Server) handleRegister() http.HandlerFunc {
 		mail := r.FormValue("mail")
 		pass := r.FormValue("password")
 
-		// TODO: Добавить валидацию пароля
+		if err := s.userService.ValidatePassword(mail, pass); err != nil {
+			var policyErr *service.PasswordPolicyError
+			if errors.As(err, &policyErr) {
+				render(w, r, http.StatusUnprocessableEntity, "register.html", pageData{Mail: mail, Errors: policyErr.Problems})
+				return
+			}
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
 		hash, err := HashPassword(pass)
 		if err != nil {
 			http.Error(w, "Server error", http.StatusInternalServerError)
 			return
 		}
-		err = s.userService.RegisterUser(r.Context(), mail, hash)
+		id, err := s.userService.RegisterUser(r.Context(), mail, hash)
 		if err != nil {
 			if errors.Is(err, store.ErrUserExists) {
-				http.Error(w, "User already exists", http.StatusBadRequest)
+				render(w, r, http.StatusBadRequest, "register.html", pageData{Mail: mail, Errors: []string{"Пользователь с таким email уже существует"}})
 				return
 			}
 			http.Error(w, "Server error", http.StatusInternalServerError)
 			return
 		}
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		slog.Info("user registered", "mail", mail)
+		log := logging.FromContext(r.Context())
+		// не смогли отправить письмо — не страшно, его можно запросить повторно после входа
+		if err := s.userService.SendVerificationEmail(r.Context(), id, mail, absoluteURL(r, "/verify")); err != nil {
+			log.Error("failed to send verification email", "error", err)
+		}
+		http.Redirect(w, r, "/login?registered=1", http.StatusSeeOther)
+		log.Info("user registered", "mail", mail)
 	}
 }
 
@@ -202,24 +552,280 @@ func (s *Server) handleLogin() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		mail := r.FormValue("mail")
 		password := r.FormValue("password")
-		slog.Info("начинаем логинить пользователя", "mail", mail, "password", password)
+		ip := clientIP(r)
+		log := logging.FromContext(r.Context())
+		log.Info("начинаем логинить пользователя", "mail", mail)
+
+		if s.rejectBlockedLogin(w, r, mail, ip) {
+			return
+		}
 
 		id, hash, err := s.userService.GetUserByEmail(r.Context(), mail)
-		slog.Info("получили пользователя из БД GetUserByEmail", "id", id, "hash", hash, "error", err)
 		if err != nil || !CheckPasswordHash(password, hash) {
+			log.Info("неудачная попытка входа", "mail", mail, "error", err)
+			if err := s.userService.LoginFailed(r.Context(), id, mail, ip); err != nil {
+				log.Error("failed to record login failure", "error", err)
+			}
 			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 			return
 		}
 
-		token, err := s.userService.CreateSession(r.Context(), id)
+		s.continueLogin(w, r, id, mail, r.FormValue("remember") != "")
+	}
+}
+
+// continueLogin вызывается после первого фактора (пароль или вход через провайдера):
+// если у пользователя включена 2FA, отправляет на ввод кода, иначе сразу завершает вход.
+func (s *Server) continueLogin(w http.ResponseWriter, r *http.Request, userID int64, mail string, remember bool) {
+	user, err := s.userService.GetUser(r.Context(), userID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to get user", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if user.Disabled() {
+		logging.FromContext(r.Context()).Warn("вход в заблокированный аккаунт", "user_id", userID)
+		s.renderLogin(w, r, http.StatusForbidden, pageData{Mail: mail, Errors: []string{"Аккаунт заблокирован администратором"}})
+		return
+	}
+
+	twoFactor, err := s.userService.TwoFactorEnabled(r.Context(), userID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to check two-factor status", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if twoFactor {
+		// сессию выдаём только после второго шага, пока что — подписанный "вызов" на несколько минут
+		s.setChallengeCookie(w, s.userService.NewLoginChallenge(userID, remember))
+		http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	s.completeLogin(w, r, userID, mail, remember)
+}
+
+// rejectBlockedLogin отвечает 429, если вход для mail/ip сейчас заблокирован. Возвращает true, если ответ уже отправлен.
+func (s *Server) rejectBlockedLogin(w http.ResponseWriter, r *http.Request, mail, ip string) bool {
+	err := s.userService.CheckLoginAllowed(r.Context(), mail, ip)
+	if err == nil {
+		return false
+	}
+	log := logging.FromContext(r.Context())
+	var blocked *service.LoginBlockedError
+	if errors.As(err, &blocked) {
+		log.Warn("попытка входа отклонена", "mail", mail, "error", err)
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(blocked.RetryAfter)))
+		http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+		return true
+	}
+	log.Error("failed to check login throttle", "error", err)
+	http.Error(w, "Server error", http.StatusInternalServerError)
+	return true
+}
+
+// completeLogin вызывается, когда все факторы проверены: сбрасывает счётчик неудач и выдаёт сессию.
+// remember — выдать долгую сессию ("запомнить меня") с постоянной кукой.
+func (s *Server) completeLogin(w http.ResponseWriter, r *http.Request, userID int64, mail string, remember bool) {
+	log := logging.FromContext(r.Context())
+	if err := s.userService.LoginSucceeded(r.Context(), userID, mail, clientIP(r)); err != nil {
+		log.Error("failed to record login success", "error", err)
+	}
+
+	token, maxExpiry, err := s.userService.CreateSession(r.Context(), userID, clientIP(r), r.UserAgent(), remember)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	s.setSessionCookie(w, token, remember, maxExpiry)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// переход по ссылке из письма подтверждения
+func (s *Server) handleVerifyEmail() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context())
+		userID, err := s.userService.VerifyEmail(r.Context(), r.URL.Query().Get("token"))
+		if err != nil {
+			log.Warn("email verification failed", "error", err)
+			msg := "Ссылка для подтверждения недействительна"
+			if errors.Is(err, service.ErrExpiredToken) {
+				msg = "Срок действия ссылки истёк. Войдите и запросите новое письмо"
+			}
+			s.renderLogin(w, r, http.StatusBadRequest, pageData{Errors: []string{msg}})
+			return
+		}
+		log.Info("email verified", "user_id", userID)
+		s.renderLogin(w, r, http.StatusOK, pageData{Success: "Email подтверждён"})
+	}
+}
+
+// повторная отправка письма подтверждения
+func (s *Server) handleResendVerification() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context())
+		userID, ok := getUserIDFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		mail, _, err := s.userService.GetUserByID(r.Context(), userID)
 		if err != nil {
+			log.Error("failed to get user", "error", err)
 			http.Error(w, "Server error", http.StatusInternalServerError)
 			return
 		}
+		if err := s.userService.SendVerificationEmail(r.Context(), userID, mail, absoluteURL(r, "/verify")); err != nil {
+			log.Error("failed to send verification email", "error", err)
+			http.Error(w, "Failed to send email", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/?resent=1", http.StatusSeeOther)
+	}
+}
+
+// absoluteURL строит абсолютную ссылку на наш сервер — так же, как короткие ссылки в handleShortenURL.
+func absoluteURL(r *http.Request, path string) string {
+	return "http://" + r.Host + path
+}
+
+// смена пароля авторизованным пользователем
+func (s *Server) handleChangePassword() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context())
+		userID, ok := getUserIDFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		current := r.FormValue("current_password")
+		next := r.FormValue("new_password")
+
+		mail, hash, err := s.userService.GetUserByID(r.Context(), userID)
+		if err != nil {
+			log.Error("failed to get user", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		if !CheckPasswordHash(current, hash) {
+			render(w, r, http.StatusUnprocessableEntity, "password.html", pageData{Errors: []string{"Текущий пароль указан неверно"}})
+			return
+		}
+		if err := s.userService.ValidatePassword(mail, next); err != nil {
+			var policyErr *service.PasswordPolicyError
+			if errors.As(err, &policyErr) {
+				render(w, r, http.StatusUnprocessableEntity, "password.html", pageData{Errors: policyErr.Problems})
+				return
+			}
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		newHash, err := HashPassword(next)
+		if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		// UpdatePassword завершает все сессии, включая текущую, поэтому выдаём новую
+		if err := s.userService.UpdatePassword(r.Context(), userID, newHash); err != nil {
+			log.Error("failed to update password", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		session, _ := getSession(r.Context())
+		token, maxExpiry, err := s.userService.CreateSession(r.Context(), userID, clientIP(r), r.UserAgent(), session.Remember)
+		if err != nil {
+			log.Error("failed to create session", "error", err)
+			s.clearSessionCookie(w)
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		s.setSessionCookie(w, token, session.Remember, maxExpiry)
+		log.Info("password changed")
+		render(w, r, http.StatusOK, "password.html", pageData{Success: "Пароль изменён. Сессии на других устройствах завершены, API-токены отозваны"})
+	}
+}
+
+func (s *Server) handleForgotPage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render(w, r, http.StatusOK, "forgot.html", pageData{})
+	}
+}
+
+// запрос письма для сброса пароля; ответ одинаковый, есть такой пользователь или нет
+func (s *Server) handleForgotPassword() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mail := r.FormValue("mail")
+		if err := s.userService.RequestPasswordReset(r.Context(), mail, absoluteURL(r, "/reset")); err != nil {
+			logging.FromContext(r.Context()).Error("failed to request password reset", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		render(w, r, http.StatusOK, "forgot.html", pageData{
+			Success: "Если такой аккаунт существует, мы отправили на него письмо со ссылкой для сброса пароля.",
+		})
+	}
+}
+
+func (s *Server) handleResetPage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if _, _, err := s.userService.GetPasswordResetUser(r.Context(), token); err != nil {
+			s.renderResetError(w, r, err)
+			return
+		}
+		render(w, r, http.StatusOK, "reset.html", pageData{Token: token})
+	}
+}
+
+// установка нового пароля по ссылке из письма
+func (s *Server) handleResetPassword() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context())
+		token := r.FormValue("token")
+		pass := r.FormValue("password")
+
+		_, mail, err := s.userService.GetPasswordResetUser(r.Context(), token)
+		if err != nil {
+			s.renderResetError(w, r, err)
+			return
+		}
+		if err := s.userService.ValidatePassword(mail, pass); err != nil {
+			var policyErr *service.PasswordPolicyError
+			if errors.As(err, &policyErr) {
+				render(w, r, http.StatusUnprocessableEntity, "reset.html", pageData{Token: token, Errors: policyErr.Problems})
+				return
+			}
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		hash, err := HashPassword(pass)
+		if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		userID, err := s.userService.ResetPassword(r.Context(), token, hash)
+		if err != nil {
+			s.renderResetError(w, r, err)
+			return
+		}
+		log.Info("password reset", "user_id", userID)
+		s.renderLogin(w, r, http.StatusOK, pageData{Mail: mail, Success: "Пароль изменён, войдите с новым паролем"})
+	}
+}
 
-		setSessionCookie(w, token)
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+func (s *Server) renderResetError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, store.ErrResetTokenNotFound) {
+		render(w, r, http.StatusBadRequest, "reset.html", pageData{
+			Errors: []string{"Ссылка для сброса пароля недействительна, устарела или уже использована"},
+		})
+		return
 	}
+	logging.FromContext(r.Context()).Error("failed to reset password", "error", err)
+	http.Error(w, "Server error", http.StatusInternalServerError)
 }
 
 func (s *Server) handleLogout() http.HandlerFunc {
@@ -228,7 +834,7 @@ func (s *Server) handleLogout() http.HandlerFunc {
 		if err == nil {
 			s.userService.DeleteSession(r.Context(), cookie.Value)
 		}
-		clearSessionCookie(w)
+		s.clearSessionCookie(w)
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 	}
 }
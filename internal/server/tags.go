@@ -0,0 +1,309 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/service"
+	"url-shorter/internal/store"
+)
+
+type tagResponse struct {
+	Name   string `json:"name"`
+	Links  int64  `json:"links"`
+	Clicks int64  `json:"clicks"`
+}
+
+// statsResponse — ответ GET /api/stats.
+type statsResponse struct {
+	Tag    string `json:"tag,omitempty"`
+	Folder int64  `json:"folder_id,omitempty"`
+	Links  int64  `json:"links"`
+	Clicks int64  `json:"clicks"`
+}
+
+type folderResponse struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Links int64  `json:"links"`
+}
+
+// bulkTagsRequest — тело POST /api/tags/bulk.
+type bulkTagsRequest struct {
+	Aliases []string `json:"aliases"`
+	Add     []string `json:"add"`
+	Remove  []string `json:"remove"`
+}
+
+type createFolderRequest struct {
+	Name string `json:"name"`
+}
+
+// splitTags разбирает теги, введённые в форме через запятую.
+func splitTags(s string) []string {
+	return strings.Split(s, ",")
+}
+
+// linkFilter читает отбор списка ссылок из параметров ?tag= и ?folder=.
+func linkFilter(r *http.Request) store.LinkFilter {
+	folderID, _ := strconv.ParseInt(r.URL.Query().Get("folder"), 10, 64)
+	return store.LinkFilter{Tag: r.URL.Query().Get("tag"), FolderID: folderID}
+}
+
+// tagsMessage переводит ошибку тегов и папок в сообщение для формы; пустая строка — ошибка не из формы.
+func tagsMessage(err error) string {
+	switch {
+	case errors.Is(err, service.ErrInvalidTag):
+		return "Тег — до 50 символов, теги разделяются запятыми"
+	case errors.Is(err, service.ErrTooManyTags):
+		return "У ссылки может быть не больше 20 тегов"
+	case errors.Is(err, service.ErrTooManyLinks):
+		return "За раз можно изменить не больше 500 ссылок"
+	case errors.Is(err, service.ErrInvalidFolderName):
+		return "Название папки — от 1 до 100 символов"
+	case errors.Is(err, store.ErrFolderExists):
+		return "Папка с таким названием уже есть"
+	case errors.Is(err, store.ErrFolderNotFound):
+		return "Такой папки нет"
+	}
+	return ""
+}
+
+// POST /links/{alias}/tags — сменить теги и папку ссылки.
+func (s *Server) handleSetLinkTags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		alias := r.PathValue("alias")
+		folderID, err := strconv.ParseInt(r.FormValue("folder_id"), 10, 64)
+		if err != nil {
+			folderID = 0
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		_, err = s.urlService.SetLinkTags(r.Context(), userID, alias, splitTags(r.FormValue("tags")))
+		if err == nil {
+			_, err = s.urlService.MoveLink(r.Context(), userID, alias, folderID)
+		}
+		if err != nil {
+			if msg := tagsMessage(err); msg != "" {
+				s.renderLink(w, r, http.StatusBadRequest, alias, linkData{TagsForm: r.FormValue("tags"), Errors: []string{msg}})
+				return
+			}
+			s.handleLinkError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/links/"+url.PathEscape(alias)+"?saved=1", http.StatusSeeOther)
+	}
+}
+
+// POST /tags/bulk — добавить и снять теги у отмеченных ссылок на главной.
+func (s *Server) handleBulkTags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		n, err := s.urlService.BulkTagLinks(r.Context(), userID, r.PostForm["alias"],
+			splitTags(r.PostFormValue("add")), splitTags(r.PostFormValue("remove")))
+		if err != nil {
+			if msg := tagsMessage(err); msg != "" {
+				s.renderHome(w, r, http.StatusBadRequest, homeData{Errors: []string{msg}})
+				return
+			}
+			s.handleLinkError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/?tagged="+strconv.Itoa(n), http.StatusSeeOther)
+	}
+}
+
+// POST /folders — создать папку в текущем пространстве.
+func (s *Server) handleCreateFolder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspace, err := s.currentWorkspace(r)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to get current workspace", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		folder, err := s.urlService.CreateFolder(r.Context(), userID, workspace.WorkspaceID, r.FormValue("name"))
+		if err != nil {
+			if msg := tagsMessage(err); msg != "" {
+				s.renderHome(w, r, http.StatusBadRequest, homeData{Errors: []string{msg}})
+				return
+			}
+			s.handleLinkError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/?folder="+strconv.FormatInt(folder.ID, 10), http.StatusSeeOther)
+	}
+}
+
+// POST /folders/{id}/delete — удалить папку текущего пространства; ссылки из неё остаются.
+func (s *Server) handleDeleteFolder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		folderID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		workspace, err := s.currentWorkspace(r)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to get current workspace", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		if err := s.urlService.DeleteFolder(r.Context(), userID, workspace.WorkspaceID, folderID); err != nil {
+			if errors.Is(err, store.ErrFolderNotFound) {
+				http.NotFound(w, r)
+				return
+			}
+			s.handleLinkError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// GET /links.csv?tag=&folder= — выгрузка ссылок текущего пространства с тем же отбором, что на главной.
+func (s *Server) handleExportLinks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context())
+		workspace, err := s.currentWorkspace(r)
+		if err != nil {
+			log.Error("failed to get current workspace", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		links, err := s.urlService.ListLinks(r.Context(), store.Owner{UserID: userID, WorkspaceID: workspace.WorkspaceID}, linkFilter(r))
+		if err != nil {
+			log.Error("failed to list links", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="links.csv"`)
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"alias", "short_url", "url", "title", "folder", "tags", "created_at"})
+		for _, l := range links {
+			cw.Write([]string{l.Alias, absoluteURL(r, "/"+l.Alias), l.URL, l.Title, l.FolderName,
+				strings.Join(l.Tags, ", "), l.CreatedAt.Format(time.RFC3339)})
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			log.Error("failed to write links csv", "error", err)
+		}
+	}
+}
+
+// GET /api/tags — теги пространства из X-Workspace-ID (без заголовка — личные)
+func (s *Server) handleAPITags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspace, ok := s.apiWorkspace(w, r)
+		if !ok {
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		tags, err := s.urlService.Tags(r.Context(), store.Owner{UserID: userID, WorkspaceID: workspace.WorkspaceID})
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to list tags", "error", err)
+			writeJSONError(w, http.StatusInternalServerError, "server error")
+			return
+		}
+		resp := make([]tagResponse, 0, len(tags))
+		for _, t := range tags {
+			resp = append(resp, tagResponse{Name: t.Name, Links: t.Links, Clicks: t.Clicks})
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// POST /api/tags/bulk {"aliases": [...], "add": [...], "remove": [...]} — добавить и снять теги у нескольких ссылок
+func (s *Server) handleAPIBulkTags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req bulkTagsRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid json body")
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		n, err := s.urlService.BulkTagLinks(r.Context(), userID, req.Aliases, req.Add, req.Remove)
+		if err != nil {
+			writeLinkAPIError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"updated": n})
+	}
+}
+
+// GET /api/stats?tag=&folder= — число ссылок пространства из X-Workspace-ID и переходов по ним, с отбором по тегу и папке
+func (s *Server) handleAPIStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspace, ok := s.apiWorkspace(w, r)
+		if !ok {
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		filter := linkFilter(r)
+		stats, err := s.urlService.LinkStats(r.Context(), store.Owner{UserID: userID, WorkspaceID: workspace.WorkspaceID}, filter)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to count link stats", "error", err)
+			writeJSONError(w, http.StatusInternalServerError, "server error")
+			return
+		}
+		writeJSON(w, http.StatusOK, statsResponse{Tag: filter.Tag, Folder: filter.FolderID, Links: stats.Links, Clicks: stats.Clicks})
+	}
+}
+
+// GET /api/folders — папки пространства из X-Workspace-ID (без заголовка — личные)
+func (s *Server) handleAPIFolders() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspace, ok := s.apiWorkspace(w, r)
+		if !ok {
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		folders, err := s.urlService.Folders(r.Context(), store.Owner{UserID: userID, WorkspaceID: workspace.WorkspaceID})
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to list folders", "error", err)
+			writeJSONError(w, http.StatusInternalServerError, "server error")
+			return
+		}
+		resp := make([]folderResponse, 0, len(folders))
+		for _, f := range folders {
+			resp = append(resp, folderResponse{ID: f.ID, Name: f.Name, Links: f.Links})
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// POST /api/folders {"name": "..."} — создать папку в пространстве из X-Workspace-ID
+func (s *Server) handleAPICreateFolder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req createFolderRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid json body")
+			return
+		}
+		workspace, ok := s.apiWorkspace(w, r)
+		if !ok {
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		folder, err := s.urlService.CreateFolder(r.Context(), userID, workspace.WorkspaceID, req.Name)
+		if err != nil {
+			writeLinkAPIError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, folderResponse{ID: folder.ID, Name: folder.Name})
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/service"
+	"url-shorter/internal/store"
+)
+
+// trashItem — ссылка в корзине и момент, когда её сотрут навсегда.
+type trashItem struct {
+	store.Link
+	PurgeAt time.Time
+}
+
+// trashData — данные страницы корзины.
+type trashData struct {
+	Workspace store.Membership
+	Items     []trashItem
+	Errors    []string
+	Success   string
+}
+
+type trashItemResponse struct {
+	Alias     string    `json:"alias"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// trash возвращает корзину пространства workspace.
+func (s *Server) trash(r *http.Request, workspace store.Membership) ([]trashItem, error) {
+	userID, _ := getUserIDFromContext(r.Context())
+	links, err := s.urlService.Trash(r.Context(), store.Owner{UserID: userID, WorkspaceID: workspace.WorkspaceID})
+	if err != nil {
+		return nil, err
+	}
+	items := make([]trashItem, 0, len(links))
+	for _, l := range links {
+		items = append(items, trashItem{Link: l, PurgeAt: s.urlService.PurgeAt(l.DeletedAt)})
+	}
+	return items, nil
+}
+
+func (s *Server) renderTrash(w http.ResponseWriter, r *http.Request, status int, data trashData) {
+	workspace, err := s.currentWorkspace(r)
+	if err == nil {
+		data.Workspace = workspace
+		data.Items, err = s.trash(r, workspace)
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to list trash", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	render(w, r, status, "trash.html", data)
+}
+
+// GET /trash — удалённые ссылки текущего пространства, которые ещё можно восстановить.
+func (s *Server) handleTrashPage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data trashData
+		if r.URL.Query().Has("deleted") {
+			data.Success = "Ссылка перемещена в корзину"
+		}
+		s.renderTrash(w, r, http.StatusOK, data)
+	}
+}
+
+// POST /links/{alias}/delete — переместить ссылку в корзину.
+func (s *Server) handleDeleteLink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := getUserIDFromContext(r.Context())
+		if err := s.urlService.DeleteLink(r.Context(), userID, r.PathValue("alias")); err != nil {
+			s.handleLinkError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/trash?deleted=1", http.StatusSeeOther)
+	}
+}
+
+// POST /trash/{alias}/restore — достать ссылку из корзины.
+func (s *Server) handleRestoreLink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := getUserIDFromContext(r.Context())
+		link, err := s.urlService.RestoreLink(r.Context(), userID, r.PathValue("alias"))
+		if err != nil {
+			if errors.Is(err, service.ErrTrashExpired) {
+				s.renderTrash(w, r, http.StatusGone, trashData{Errors: []string{"Срок хранения ссылки в корзине истёк, восстановить её нельзя"}})
+				return
+			}
+			s.handleLinkError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/links/"+url.PathEscape(link.Alias)+"?restored=1", http.StatusSeeOther)
+	}
+}
+
+// DELETE /api/links/{alias} — переместить ссылку в корзину
+func (s *Server) handleAPIDeleteLink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := getUserIDFromContext(r.Context())
+		if err := s.urlService.DeleteLink(r.Context(), userID, r.PathValue("alias")); err != nil {
+			writeLinkAPIError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GET /api/trash — корзина пространства из X-Workspace-ID (без заголовка — личная)
+func (s *Server) handleAPITrash() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspace, ok := s.apiWorkspace(w, r)
+		if !ok {
+			return
+		}
+		items, err := s.trash(r, workspace)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to list trash", "error", err)
+			writeJSONError(w, http.StatusInternalServerError, "server error")
+			return
+		}
+		resp := make([]trashItemResponse, 0, len(items))
+		for _, it := range items {
+			resp = append(resp, trashItemResponse{
+				Alias:     it.Alias,
+				URL:       it.URL,
+				Title:     it.Title,
+				DeletedAt: it.DeletedAt,
+				PurgeAt:   it.PurgeAt,
+			})
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// POST /api/trash/{alias}/restore — достать ссылку из корзины
+func (s *Server) handleAPIRestoreLink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := getUserIDFromContext(r.Context())
+		link, err := s.urlService.RestoreLink(r.Context(), userID, r.PathValue("alias"))
+		if err != nil {
+			writeLinkAPIError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, linkDetails(r, link))
+	}
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/service"
+
+	"rsc.io/qr"
+)
+
+// twoFactorData — данные страницы настройки 2FA.
+type twoFactorData struct {
+	Enabled       bool
+	Required      bool
+	Enrollment    *service.TOTPEnrollment
+	QRCode        template.URL // data: URL с PNG, сгенерированным из Enrollment.URI
+	RecoveryCodes []string
+	Errors        []string
+	Success       string
+}
+
+// Require2FAMiddleware не пускает пользователей без 2FA никуда, кроме её настройки и выхода,
+// если 2FA обязательна. Должен стоять после AuthMiddleware.
+func (s *Server) Require2FAMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.userService.TwoFactorRequired() || r.URL.Path == "/logout" || strings.HasPrefix(r.URL.Path, "/2fa") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		enabled, err := s.userService.TwoFactorEnabled(r.Context(), userID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to check two-factor status", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		if !enabled {
+			if getAuthMethod(r.Context()) == authMethodAPIToken {
+				writeJSONError(w, http.StatusForbidden, "two-factor authentication must be enabled for this account")
+				return
+			}
+			http.Redirect(w, r, "/2fa", http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// renderTwoFactor дополняет data общими полями и отрисовывает страницу настройки 2FA.
+func (s *Server) renderTwoFactor(w http.ResponseWriter, r *http.Request, status int, data twoFactorData) {
+	userID, _ := getUserIDFromContext(r.Context())
+	enabled, err := s.userService.TwoFactorEnabled(r.Context(), userID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to check two-factor status", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	data.Enabled = enabled
+	data.Required = s.userService.TwoFactorRequired()
+	if data.Enrollment != nil {
+		code, err := qr.Encode(data.Enrollment.URI, qr.M)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to encode qr code", "error", err)
+		} else {
+			data.QRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(code.PNG()))
+		}
+	}
+	render(w, r, status, "twofactor.html", data)
+}
+
+func (s *Server) handleTwoFactorPage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.renderTwoFactor(w, r, http.StatusOK, twoFactorData{})
+	}
+}
+
+// выдача секрета и QR-кода для приложения-аутентификатора
+func (s *Server) handleTwoFactorSetup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := getUserIDFromContext(r.Context())
+		enrollment, err := s.userService.BeginTOTPEnrollment(r.Context(), userID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to begin totp enrollment", "error", err)
+			s.renderTwoFactor(w, r, http.StatusBadRequest, twoFactorData{Errors: []string{"Не удалось начать настройку 2FA"}})
+			return
+		}
+		s.renderTwoFactor(w, r, http.StatusOK, twoFactorData{Enrollment: &enrollment})
+	}
+}
+
+// подтверждение первым кодом из приложения
+func (s *Server) handleTwoFactorEnable() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context())
+		userID, _ := getUserIDFromContext(r.Context())
+		codes, err := s.userService.ConfirmTOTPEnrollment(r.Context(), userID, r.FormValue("code"))
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidTOTPCode) {
+				data := twoFactorData{Errors: []string{"Неверный код, попробуйте ещё раз"}}
+				if enrollment, err := s.userService.PendingTOTPEnrollment(r.Context(), userID); err == nil {
+					data.Enrollment = &enrollment
+				}
+				s.renderTwoFactor(w, r, http.StatusUnprocessableEntity, data)
+				return
+			}
+			log.Error("failed to enable totp", "error", err)
+			s.renderTwoFactor(w, r, http.StatusBadRequest, twoFactorData{Errors: []string{"Не удалось включить 2FA, начните настройку заново"}})
+			return
+		}
+		s.renderTwoFactor(w, r, http.StatusOK, twoFactorData{
+			RecoveryCodes: codes,
+			Success:       "Двухфакторная аутентификация включена",
+		})
+	}
+}
+
+func (s *Server) handleTwoFactorDisable() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := getUserIDFromContext(r.Context())
+		if err := s.userService.DisableTOTP(r.Context(), userID, r.FormValue("code")); err != nil {
+			logging.FromContext(r.Context()).Warn("failed to disable totp", "error", err)
+			s.renderTwoFactor(w, r, http.StatusUnprocessableEntity, twoFactorData{Errors: []string{"Не удалось отключить 2FA: неверный код"}})
+			return
+		}
+		s.renderTwoFactor(w, r, http.StatusOK, twoFactorData{Success: "Двухфакторная аутентификация отключена"})
+	}
+}
+
+// второй шаг входа: пароль уже проверен в handleLogin, ждём код
+func (s *Server) handleLoginTwoFactorPage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(challengeCookieName)
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if _, _, err := s.userService.ParseLoginChallenge(cookie.Value); err != nil {
+			s.clearChallengeCookie(w)
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		render(w, r, http.StatusOK, "login_2fa.html", pageData{})
+	}
+}
+
+func (s *Server) handleLoginTwoFactor() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logging.FromContext(r.Context())
+		ip := clientIP(r)
+
+		cookie, err := r.Cookie(challengeCookieName)
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		userID, remember, err := s.userService.ParseLoginChallenge(cookie.Value)
+		if err != nil {
+			s.clearChallengeCookie(w)
+			s.renderLogin(w, r, http.StatusUnauthorized, pageData{Errors: []string{"Время на ввод кода истекло, войдите заново"}})
+			return
+		}
+		mail, _, err := s.userService.GetUserByID(r.Context(), userID)
+		if err != nil {
+			log.Error("failed to get user", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		// перебор 6-значных кодов ограничиваем так же, как перебор паролей
+		if s.rejectBlockedLogin(w, r, mail, ip) {
+			return
+		}
+		if err := s.userService.VerifySecondFactor(r.Context(), userID, r.FormValue("code")); err != nil {
+			log.Info("неверный код второго фактора", "user_id", userID, "error", err)
+			if err := s.userService.LoginFailed(r.Context(), userID, mail, ip); err != nil {
+				log.Error("failed to record login failure", "error", err)
+			}
+			render(w, r, http.StatusUnauthorized, "login_2fa.html", pageData{Errors: []string{"Неверный код"}})
+			return
+		}
+
+		s.clearChallengeCookie(w)
+		s.completeLogin(w, r, userID, mail, remember)
+	}
+}
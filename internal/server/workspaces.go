@@ -0,0 +1,373 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/service"
+	"url-shorter/internal/store"
+)
+
+// workspaceHeader — заголовок, которым API-клиент выбирает рабочее пространство.
+// Без него запросы API работают с личными ссылками.
+const workspaceHeader = "X-Workspace-ID"
+
+// WorkspaceService определяет контракт сервиса рабочих пространств.
+type WorkspaceService interface {
+	Create(ctx context.Context, userID int64, name string) (int64, error)
+	Membership(ctx context.Context, workspaceID, userID int64) (store.Membership, error)
+	List(ctx context.Context, userID int64) ([]store.Membership, error)
+	Members(ctx context.Context, workspaceID, userID int64) ([]store.Member, error)
+	Switch(ctx context.Context, sessionID, userID, workspaceID int64) error
+	Invite(ctx context.Context, actorID, workspaceID int64, mail, role, joinURL string) error
+	ParseInvite(ctx context.Context, token string) (service.Invite, error)
+	AcceptInvite(ctx context.Context, userID int64, token string) (int64, error)
+	SetRole(ctx context.Context, actorID, workspaceID, userID int64, role string) error
+	RemoveMember(ctx context.Context, actorID, workspaceID, userID int64) error
+	Invites(ctx context.Context, actorID, workspaceID int64) ([]store.WorkspaceInvite, error)
+	RevokeInvite(ctx context.Context, actorID, workspaceID, inviteID int64) error
+}
+
+// currentWorkspace возвращает пространство, в котором выполняется запрос: в браузере — выбранное в сессии,
+// в API — из заголовка X-Workspace-ID. Нулевой Membership — личные ссылки пользователя.
+func (s *Server) currentWorkspace(r *http.Request) (store.Membership, error) {
+	userID, _ := getUserIDFromContext(r.Context())
+
+	if session, ok := getSession(r.Context()); ok && r.Header.Get(workspaceHeader) == "" {
+		m, err := s.workspaceService.Membership(r.Context(), session.WorkspaceID, userID)
+		// пользователя исключили из выбранного пространства — молча возвращаем его к личным ссылкам
+		if errors.Is(err, store.ErrNotWorkspaceMember) {
+			return store.Membership{}, s.workspaceService.Switch(r.Context(), session.ID, userID, 0)
+		}
+		return m, err
+	}
+
+	header := r.Header.Get(workspaceHeader)
+	if header == "" {
+		return store.Membership{}, nil
+	}
+	id, err := strconv.ParseInt(header, 10, 64)
+	if err != nil {
+		return store.Membership{}, store.ErrNotWorkspaceMember
+	}
+	return s.workspaceService.Membership(r.Context(), id, userID)
+}
+
+// workspacesData — данные страницы со списком пространств.
+type workspacesData struct {
+	Workspaces  []store.Membership
+	CurrentID   int64
+	Invite      *service.Invite // приглашение, которое пользователь открыл из письма
+	InviteToken string
+	Errors      []string
+}
+
+// workspaceData — данные страницы одного пространства.
+type workspaceData struct {
+	Workspace store.Membership
+	Members   []store.Member
+	Invites   []store.WorkspaceInvite // неиспользованные приглашения, видны только владельцу
+	Links     []store.Link
+	UserID    int64
+	Roles     []string
+	Errors    []string
+	Success   string
+}
+
+var workspaceRoles = []string{store.WorkspaceOwner, store.WorkspaceEditor, store.WorkspaceViewer}
+
+func (s *Server) renderWorkspaces(w http.ResponseWriter, r *http.Request, status int, data workspacesData) {
+	userID, _ := getUserIDFromContext(r.Context())
+	list, err := s.workspaceService.List(r.Context(), userID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to list workspaces", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	current, err := s.currentWorkspace(r)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to get current workspace", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	data.Workspaces = list
+	data.CurrentID = current.WorkspaceID
+	render(w, r, status, "workspaces.html", data)
+}
+
+// GET /workspaces — пространства пользователя, создание и переключение.
+func (s *Server) handleWorkspacesPage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireSession(w, r) {
+			return
+		}
+		s.renderWorkspaces(w, r, http.StatusOK, workspacesData{})
+	}
+}
+
+// POST /workspaces — создать пространство.
+func (s *Server) handleCreateWorkspace() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireSession(w, r) {
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		id, err := s.workspaceService.Create(r.Context(), userID, r.FormValue("name"))
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidWorkspaceName) {
+				s.renderWorkspaces(w, r, http.StatusBadRequest, workspacesData{Errors: []string{"Введите название пространства (до 100 символов)"}})
+				return
+			}
+			logging.FromContext(r.Context()).Error("failed to create workspace", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/workspaces/"+strconv.FormatInt(id, 10), http.StatusSeeOther)
+	}
+}
+
+// POST /workspaces/switch — выбрать пространство для этой сессии (workspace_id=0 — личные ссылки).
+func (s *Server) handleSwitchWorkspace() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireSession(w, r) {
+			return
+		}
+		id, err := strconv.ParseInt(r.FormValue("workspace_id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid workspace", http.StatusBadRequest)
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		session, _ := getSession(r.Context())
+		if err := s.workspaceService.Switch(r.Context(), session.ID, userID, id); err != nil {
+			if errors.Is(err, store.ErrNotWorkspaceMember) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			logging.FromContext(r.Context()).Error("failed to switch workspace", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+func (s *Server) renderWorkspace(w http.ResponseWriter, r *http.Request, status int, workspaceID int64, data workspaceData) {
+	ctx := r.Context()
+	userID, _ := getUserIDFromContext(ctx)
+	m, err := s.workspaceService.Membership(ctx, workspaceID, userID)
+	if err == nil {
+		data.Members, err = s.workspaceService.Members(ctx, workspaceID, userID)
+	}
+	if err == nil && m.CanManage() {
+		data.Invites, err = s.workspaceService.Invites(ctx, userID, workspaceID)
+	}
+	if err == nil {
+		data.Links, err = s.urlService.ListLinks(ctx, store.Owner{UserID: userID, WorkspaceID: workspaceID}, store.LinkFilter{})
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrNotWorkspaceMember) {
+			http.NotFound(w, r)
+			return
+		}
+		logging.FromContext(ctx).Error("failed to load workspace", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	data.Workspace = m
+	data.UserID = userID
+	data.Roles = workspaceRoles
+	render(w, r, status, "workspace.html", data)
+}
+
+// workspaceID достаёт ID пространства из пути; 0 — не ID.
+func workspaceID(r *http.Request) int64 {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0
+	}
+	return id
+}
+
+// GET /workspaces/{id} — участники и ссылки пространства.
+func (s *Server) handleWorkspacePage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireSession(w, r) {
+			return
+		}
+		id := workspaceID(r)
+		if id == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		s.renderWorkspace(w, r, http.StatusOK, id, workspaceData{})
+	}
+}
+
+// workspaceError показывает ошибку действия над пространством на его странице.
+func (s *Server) workspaceError(w http.ResponseWriter, r *http.Request, id int64, err error) {
+	var msg string
+	switch {
+	case errors.Is(err, store.ErrNotWorkspaceMember):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, service.ErrWorkspaceForbidden):
+		msg = "Это может сделать только владелец пространства"
+	case errors.Is(err, service.ErrInvalidWorkspaceRole):
+		msg = "Неизвестная роль"
+	case errors.Is(err, service.ErrInvalidInviteEmail):
+		msg = "Введите корректный email"
+	case errors.Is(err, service.ErrLastWorkspaceOwner):
+		msg = "В пространстве должен остаться хотя бы один владелец"
+	case errors.Is(err, store.ErrInviteNotFound):
+		msg = "Приглашение уже принято, отозвано или истекло"
+	default:
+		logging.FromContext(r.Context()).Error("workspace action failed", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	s.renderWorkspace(w, r, http.StatusForbidden, id, workspaceData{Errors: []string{msg}})
+}
+
+// POST /workspaces/{id}/invite — пригласить по email.
+func (s *Server) handleInviteToWorkspace() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireSession(w, r) {
+			return
+		}
+		id := workspaceID(r)
+		if id == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		mail := r.FormValue("mail")
+		userID, _ := getUserIDFromContext(r.Context())
+		err := s.workspaceService.Invite(r.Context(), userID, id, mail, r.FormValue("role"), absoluteURL(r, "/workspaces/join"))
+		if err != nil {
+			s.workspaceError(w, r, id, err)
+			return
+		}
+		s.renderWorkspace(w, r, http.StatusOK, id, workspaceData{Success: "Приглашение отправлено на " + mail})
+	}
+}
+
+// POST /workspaces/{id}/members/{user}/role — сменить роль участника.
+func (s *Server) handleSetMemberRole() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireSession(w, r) {
+			return
+		}
+		id := workspaceID(r)
+		memberID, err := strconv.ParseInt(r.PathValue("user"), 10, 64)
+		if id == 0 || err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		if err := s.workspaceService.SetRole(r.Context(), userID, id, memberID, r.FormValue("role")); err != nil {
+			s.workspaceError(w, r, id, err)
+			return
+		}
+		s.renderWorkspace(w, r, http.StatusOK, id, workspaceData{Success: "Роль изменена"})
+	}
+}
+
+// POST /workspaces/{id}/members/{user}/remove — исключить участника или выйти самому.
+func (s *Server) handleRemoveMember() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireSession(w, r) {
+			return
+		}
+		id := workspaceID(r)
+		memberID, err := strconv.ParseInt(r.PathValue("user"), 10, 64)
+		if id == 0 || err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		if err := s.workspaceService.RemoveMember(r.Context(), userID, id, memberID); err != nil {
+			s.workspaceError(w, r, id, err)
+			return
+		}
+		if memberID == userID {
+			http.Redirect(w, r, "/workspaces", http.StatusSeeOther)
+			return
+		}
+		s.renderWorkspace(w, r, http.StatusOK, id, workspaceData{Success: "Участник исключён"})
+	}
+}
+
+// POST /workspaces/{id}/invites/{invite}/revoke — отозвать неиспользованное приглашение.
+func (s *Server) handleRevokeInvite() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireSession(w, r) {
+			return
+		}
+		id := workspaceID(r)
+		inviteID, err := strconv.ParseInt(r.PathValue("invite"), 10, 64)
+		if id == 0 || err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		if err := s.workspaceService.RevokeInvite(r.Context(), userID, id, inviteID); err != nil {
+			s.workspaceError(w, r, id, err)
+			return
+		}
+		s.renderWorkspace(w, r, http.StatusOK, id, workspaceData{Success: "Приглашение отозвано"})
+	}
+}
+
+// GET /workspaces/join?token=... — ссылка из письма с приглашением: показываем, куда зовут, и просим подтвердить.
+func (s *Server) handleJoinWorkspacePage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireSession(w, r) {
+			return
+		}
+		token := r.URL.Query().Get("token")
+		invite, err := s.workspaceService.ParseInvite(r.Context(), token)
+		if err != nil {
+			s.renderWorkspaces(w, r, http.StatusBadRequest, workspacesData{Errors: []string{inviteErrorMessage(err)}})
+			return
+		}
+		s.renderWorkspaces(w, r, http.StatusOK, workspacesData{Invite: &invite, InviteToken: token})
+	}
+}
+
+// POST /workspaces/join — принять приглашение и сразу переключиться в пространство.
+func (s *Server) handleJoinWorkspace() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireSession(w, r) {
+			return
+		}
+		userID, _ := getUserIDFromContext(r.Context())
+		id, err := s.workspaceService.AcceptInvite(r.Context(), userID, r.FormValue("token"))
+		if err != nil {
+			if errors.Is(err, store.ErrInviteNotFound) || errors.Is(err, service.ErrInviteWrongUser) {
+				s.renderWorkspaces(w, r, http.StatusBadRequest, workspacesData{Errors: []string{inviteErrorMessage(err)}})
+				return
+			}
+			logging.FromContext(r.Context()).Error("failed to accept workspace invite", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		session, _ := getSession(r.Context())
+		if err := s.workspaceService.Switch(r.Context(), session.ID, userID, id); err != nil {
+			logging.FromContext(r.Context()).Error("failed to switch workspace", "error", err)
+		}
+		http.Redirect(w, r, "/workspaces/"+strconv.FormatInt(id, 10), http.StatusSeeOther)
+	}
+}
+
+func inviteErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, service.ErrInviteWrongUser):
+		return "Приглашение отправлено на другой email. Войдите в аккаунт с этим адресом"
+	case errors.Is(err, store.ErrInviteNotFound):
+		return "Приглашение уже принято, отозвано или истекло. Попросите прислать новое"
+	default:
+		return "Ссылка приглашения недействительна"
+	}
+}
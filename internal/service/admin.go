@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/store"
+)
+
+// adminSearchLimit — сколько строк показываем в результатах поиска админки.
+const adminSearchLimit = 100
+
+// maxAuditEvents — сколько записей журнала аудита отдаём за раз (в том числе при выгрузке).
+const maxAuditEvents = 10000
+
+// loginReviewLimit — сколько попыток входа показываем на странице разбора.
+const loginReviewLimit = 200
+
+// suspiciousLoginEvents — события, которые показываются при разборе по умолчанию: всё, кроме успешных входов.
+var suspiciousLoginEvents = []string{store.LoginEventFailure, store.LoginEventBlocked, store.LoginEventLocked}
+
+var ErrCannotDisableSelf = errors.New("administrators cannot disable their own account")
+
+// AdminStorage определяет контракт хранилища для админки.
+type AdminStorage interface {
+	SearchUsers(ctx context.Context, query string, limit int) ([]store.User, error)
+	SetUserDisabled(ctx context.Context, id int64, disabled bool) error
+	SearchLinks(ctx context.Context, query string, limit int) ([]store.Link, error)
+	TakeDownLink(ctx context.Context, id int64, reason string) (string, error)
+	RestoreLink(ctx context.Context, id int64) (string, error)
+	GetStats(ctx context.Context) (store.Stats, error)
+	ListAuditEvents(ctx context.Context, f store.AuditFilter) ([]store.AuditEvent, error)
+	ListLoginEvents(ctx context.Context, f store.LoginEventFilter) ([]store.LoginEvent, error)
+	ListLoginLocks(ctx context.Context) ([]store.LoginLock, error)
+}
+
+// AdminService — действия администратора: модерация пользователей и ссылок, статистика.
+type AdminService struct {
+	storage AdminStorage
+	links   *ShortenerService // чтобы снятая ссылка сразу пропала из кэша редиректов
+	audit   *AuditLog
+}
+
+func NewAdminService(s AdminStorage, links *ShortenerService, audit *AuditLog) *AdminService {
+	return &AdminService{storage: s, links: links, audit: audit}
+}
+
+// SearchUsers ищет пользователей по части email.
+func (as *AdminService) SearchUsers(ctx context.Context, query string) ([]store.User, error) {
+	return as.storage.SearchUsers(ctx, strings.TrimSpace(query), adminSearchLimit)
+}
+
+// DisableUser блокирует аккаунт и завершает его сессии. actorID — администратор, выполняющий действие.
+func (as *AdminService) DisableUser(ctx context.Context, actorID, userID int64) error {
+	if actorID == userID {
+		return ErrCannotDisableSelf
+	}
+	if err := as.storage.SetUserDisabled(ctx, userID, true); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Warn("user disabled", "target_user_id", userID)
+	as.audit.Record(ctx, AuditEntry{Action: AuditAdminUserDisable, TargetType: AuditTargetUser, TargetID: auditID(userID)})
+	return nil
+}
+
+// EnableUser снимает блокировку аккаунта.
+func (as *AdminService) EnableUser(ctx context.Context, userID int64) error {
+	if err := as.storage.SetUserDisabled(ctx, userID, false); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("user enabled", "target_user_id", userID)
+	as.audit.Record(ctx, AuditEntry{Action: AuditAdminUserEnable, TargetType: AuditTargetUser, TargetID: auditID(userID)})
+	return nil
+}
+
+// SearchLinks ищет ссылки по alias, исходному URL или email автора.
+func (as *AdminService) SearchLinks(ctx context.Context, query string) ([]store.Link, error) {
+	return as.storage.SearchLinks(ctx, strings.TrimSpace(query), adminSearchLimit)
+}
+
+// TakeDownLink снимает ссылку: дальше редирект по ней отвечает 410.
+func (as *AdminService) TakeDownLink(ctx context.Context, linkID int64, reason string) error {
+	alias, err := as.storage.TakeDownLink(ctx, linkID, strings.TrimSpace(reason))
+	if err != nil {
+		return err
+	}
+	as.links.forget(linkID)
+	logging.FromContext(ctx).Warn("link taken down", "alias", alias, "reason", reason)
+	as.audit.Record(ctx, AuditEntry{Action: AuditAdminLinkTakedown, TargetType: AuditTargetLink, TargetID: alias,
+		After: map[string]string{"reason": reason}})
+	return nil
+}
+
+// RestoreLink возвращает снятую ссылку.
+func (as *AdminService) RestoreLink(ctx context.Context, linkID int64) error {
+	alias, err := as.storage.RestoreLink(ctx, linkID)
+	if err != nil {
+		return err
+	}
+	as.links.forget(linkID)
+	logging.FromContext(ctx).Info("link restored", "alias", alias)
+	as.audit.Record(ctx, AuditEntry{Action: AuditAdminLinkRestore, TargetType: AuditTargetLink, TargetID: alias})
+	return nil
+}
+
+// Stats возвращает сводку по системе.
+func (as *AdminService) Stats(ctx context.Context) (store.Stats, error) {
+	return as.storage.GetStats(ctx)
+}
+
+// AuditEvents возвращает записи журнала аудита по фильтру. Limit ограничен maxAuditEvents.
+func (as *AdminService) AuditEvents(ctx context.Context, f store.AuditFilter) ([]store.AuditEvent, error) {
+	if f.Limit <= 0 || f.Limit > maxAuditEvents {
+		f.Limit = maxAuditEvents
+	}
+	return as.storage.ListAuditEvents(ctx, f)
+}
+
+// LoginEvents возвращает попытки входа по фильтру для разбора. Без фильтра по типу показываются
+// неудачные, отклонённые и заблокированные попытки.
+func (as *AdminService) LoginEvents(ctx context.Context, f store.LoginEventFilter) ([]store.LoginEvent, error) {
+	f.Mail = strings.TrimSpace(f.Mail)
+	f.IP = strings.TrimSpace(f.IP)
+	if len(f.Events) == 0 {
+		f.Events = suspiciousLoginEvents
+	}
+	f.Limit = loginReviewLimit
+	return as.storage.ListLoginEvents(ctx, f)
+}
+
+// LoginLocks возвращает аккаунты и IP, вход для которых сейчас заблокирован.
+func (as *AdminService) LoginLocks(ctx context.Context) ([]store.LoginLock, error) {
+	return as.storage.ListLoginLocks(ctx)
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/store"
+)
+
+// apiTokenPrefix помогает узнать токен в конфиге или логах и найти его сканерами секретов.
+const apiTokenPrefix = "us_"
+
+var ErrInvalidAPIToken = errors.New("invalid api token")
+
+// CreateAPIToken выпускает токен. Открытое значение возвращается один раз, в БД хранится только хеш.
+// Нулевой expiresAt — бессрочный токен.
+func (us *UserService) CreateAPIToken(ctx context.Context, userID int64, name, scope string, expiresAt time.Time) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return "", fmt.Errorf("%w: name must be 1..100 characters", store.ErrInvalidData)
+	}
+	if scope != store.ScopeRead && scope != store.ScopeWrite {
+		return "", fmt.Errorf("%w: unknown scope %q", store.ErrInvalidData, scope)
+	}
+	if !expiresAt.IsZero() && !expiresAt.After(us.now()) {
+		return "", fmt.Errorf("%w: expiry must be in the future", store.ErrInvalidData)
+	}
+
+	random, err := randomToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate api token: %w", err)
+	}
+	token := apiTokenPrefix + random
+	t := store.APIToken{UserID: userID, Name: name, Scope: scope, ExpiresAt: expiresAt}
+	id, err := us.storage.SaveAPIToken(ctx, t, hashToken(token))
+	if err != nil {
+		return "", err
+	}
+	logging.FromContext(ctx).Info("api token created", "token_id", id, "scope", scope)
+	return token, nil
+}
+
+// ListAPITokens возвращает токены пользователя (без открытых значений).
+func (us *UserService) ListAPITokens(ctx context.Context, userID int64) ([]store.APIToken, error) {
+	return us.storage.ListAPITokens(ctx, userID)
+}
+
+// RevokeAPIToken удаляет токен пользователя.
+func (us *UserService) RevokeAPIToken(ctx context.Context, userID, tokenID int64) error {
+	if err := us.storage.DeleteAPIToken(ctx, userID, tokenID); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("api token revoked", "token_id", tokenID)
+	return nil
+}
+
+// AuthenticateAPIToken проверяет токен из заголовка Authorization и возвращает его запись:
+// ID токена, владельца и область действия.
+func (us *UserService) AuthenticateAPIToken(ctx context.Context, token string) (store.APIToken, error) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return store.APIToken{}, ErrInvalidAPIToken
+	}
+	t, err := us.storage.UseAPIToken(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, store.ErrAPITokenNotFound) {
+			return store.APIToken{}, ErrInvalidAPIToken
+		}
+		return store.APIToken{}, err
+	}
+	return t, nil
+}
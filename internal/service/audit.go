@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"url-shorter/internal/audit"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/store"
+)
+
+// Действия, которые пишутся в журнал аудита.
+const (
+	AuditUserRegister       = "user.register"
+	AuditUserLogin          = "user.login"
+	AuditUserLoginFailed    = "user.login_failed"
+	AuditUserPasswordChange = "user.password_change"
+	AuditUserPasswordReset  = "user.password_reset"
+	AuditUserOIDCLink       = "user.oidc_link"
+	AuditSessionRevoke      = "session.revoke"
+	AuditSessionRevokeOther = "session.revoke_others"
+
+	AuditLinkCreate   = "link.create"
+	AuditLinkUpdate   = "link.update"
+	AuditLinkRollback = "link.rollback"
+	AuditLinkDelete   = "link.delete"
+	AuditLinkRestore  = "link.restore"
+	AuditLinkTags     = "link.tags"
+	AuditLinkMove     = "link.move"
+	AuditLinkImport   = "link.import"
+
+	AuditFolderCreate = "folder.create"
+	AuditFolderDelete = "folder.delete"
+
+	AuditWorkspaceCreate       = "workspace.create"
+	AuditWorkspaceInvite       = "workspace.invite"
+	AuditWorkspaceInviteRevoke = "workspace.invite_revoke"
+	AuditWorkspaceJoin         = "workspace.join"
+	AuditWorkspaceMemberRole   = "workspace.member_role"
+	AuditWorkspaceMemberRemove = "workspace.member_remove"
+
+	AuditAdminUserDisable  = "admin.user_disable"
+	AuditAdminUserEnable   = "admin.user_enable"
+	AuditAdminLinkTakedown = "admin.link_takedown"
+	AuditAdminLinkRestore  = "admin.link_restore"
+)
+
+// Типы объектов, над которыми выполняется действие.
+const (
+	AuditTargetUser      = "user"
+	AuditTargetSession   = "session"
+	AuditTargetLink      = "link" // target_id — alias
+	AuditTargetWorkspace = "workspace"
+	AuditTargetFolder    = "folder"
+)
+
+// AuditStorage определяет контракт хранилища журнала аудита.
+type AuditStorage interface {
+	SaveAuditEvent(ctx context.Context, e store.AuditEvent) error
+}
+
+// AuditEntry — событие для журнала. Кто и откуда его выполнил, берётся из контекста (audit.Actor).
+type AuditEntry struct {
+	Action     string
+	TargetType string
+	TargetID   string
+	ActorID    int64 // если задан, заменяет пользователя из контекста (например, при входе)
+	Before     any   // состояние до изменения, сериализуется в JSON
+	After      any   // состояние после изменения
+}
+
+// AuditLog пишет журнал аудита. Нулевой *AuditLog ничего не пишет, поэтому сервисам без журнала
+// (например, в утилитах) его можно не передавать.
+type AuditLog struct {
+	storage AuditStorage
+}
+
+func NewAuditLog(s AuditStorage) *AuditLog {
+	return &AuditLog{storage: s}
+}
+
+// Record добавляет событие в журнал. Ошибка записи не должна ломать само действие, поэтому только логируется.
+func (a *AuditLog) Record(ctx context.Context, e AuditEntry) {
+	if a == nil {
+		return
+	}
+	actor := audit.ActorFromContext(ctx)
+	if e.ActorID != 0 {
+		actor.UserID = e.ActorID
+	}
+	event := store.AuditEvent{
+		ActorID:    actor.UserID,
+		IP:         actor.IP,
+		RequestID:  actor.RequestID,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		Before:     auditJSON(ctx, e.Before),
+		After:      auditJSON(ctx, e.After),
+	}
+	if err := a.storage.SaveAuditEvent(ctx, event); err != nil {
+		logging.FromContext(ctx).Error("failed to save audit event", "action", e.Action, "error", err)
+	}
+}
+
+func auditJSON(ctx context.Context, v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to encode audit value", "error", err)
+		return nil
+	}
+	return b
+}
+
+// auditID — ID объекта в журнале; 0 — объект неизвестен.
+func auditID(id int64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatInt(id, 10)
+}
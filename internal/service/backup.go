@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"io"
+	"url-shorter/internal/backup"
+	"url-shorter/internal/store"
+)
+
+// BackupStorage — хранилище, которое умеет отдать всё содержимое снимком и восстановиться из снимка.
+// RestoreSnapshot должен писать снимок целиком или не писать ничего и отказывать, если хранилище не пустое.
+type BackupStorage interface {
+	ExportSnapshot(ctx context.Context, withPasswords bool) (store.Snapshot, error)
+	RestoreSnapshot(ctx context.Context, s store.Snapshot) error
+}
+
+// BackupService выгружает и восстанавливает резервные копии в переносимом формате (пакет backup).
+type BackupService struct {
+	storage BackupStorage
+}
+
+func NewBackupService(s BackupStorage) *BackupService {
+	return &BackupService{storage: s}
+}
+
+// Export пишет резервную копию хранилища в w. Хеши паролей попадают в архив, только если withPasswords.
+func (b *BackupService) Export(ctx context.Context, w io.Writer, withPasswords bool) (backup.Stats, error) {
+	snap, err := b.storage.ExportSnapshot(ctx, withPasswords)
+	if err != nil {
+		return backup.Stats{}, err
+	}
+	a := archiveFromSnapshot(snap)
+	a.Header.PasswordHashes = withPasswords
+	return backup.Write(w, a)
+}
+
+// Restore читает и проверяет архив из r и, если не dryRun, записывает его в хранилище.
+// Хранилище должно быть пустым (store.ErrStorageNotEmpty). Пользователи из архива без хешей
+// войти по паролю не смогут, пока не сбросят его.
+func (b *BackupService) Restore(ctx context.Context, r io.Reader, dryRun bool) (backup.Header, backup.Stats, error) {
+	a, err := backup.Read(r)
+	if err != nil {
+		return backup.Header{}, backup.Stats{}, err
+	}
+	if !dryRun {
+		if err := b.storage.RestoreSnapshot(ctx, snapshotFromArchive(a)); err != nil {
+			return a.Header, backup.Stats{}, err
+		}
+	}
+	return a.Header, a.Stats(), nil
+}
+
+func archiveFromSnapshot(s store.Snapshot) *backup.Archive {
+	a := &backup.Archive{
+		Users:          make([]backup.User, len(s.Users)),
+		Workspaces:     make([]backup.Workspace, len(s.Workspaces)),
+		Members:        make([]backup.Member, len(s.Members)),
+		Folders:        make([]backup.Folder, len(s.Folders)),
+		Links:          make([]backup.Link, len(s.Links)),
+		RetiredAliases: make([]backup.RetiredAlias, len(s.RetiredAliases)),
+	}
+	for i, u := range s.Users {
+		a.Users[i] = archiveUser(u)
+	}
+	for i, w := range s.Workspaces {
+		a.Workspaces[i] = backup.Workspace(w)
+	}
+	for i, m := range s.Members {
+		a.Members[i] = backup.Member(m)
+	}
+	for i, f := range s.Folders {
+		a.Folders[i] = backup.Folder(f)
+	}
+	for i, l := range s.Links {
+		a.Links[i] = backup.Link(l)
+	}
+	for i, r := range s.RetiredAliases {
+		a.RetiredAliases[i] = backup.RetiredAlias(r)
+	}
+	return a
+}
+
+func snapshotFromArchive(a *backup.Archive) store.Snapshot {
+	s := store.Snapshot{
+		Users:          make([]store.SnapshotUser, len(a.Users)),
+		Workspaces:     make([]store.SnapshotWorkspace, len(a.Workspaces)),
+		Members:        make([]store.SnapshotMember, len(a.Members)),
+		Folders:        make([]store.SnapshotFolder, len(a.Folders)),
+		Links:          make([]store.SnapshotLink, len(a.Links)),
+		RetiredAliases: make([]store.RetiredAlias, len(a.RetiredAliases)),
+	}
+	for i, u := range a.Users {
+		s.Users[i] = snapshotUser(u)
+	}
+	for i, w := range a.Workspaces {
+		s.Workspaces[i] = store.SnapshotWorkspace(w)
+	}
+	for i, m := range a.Members {
+		s.Members[i] = store.SnapshotMember(m)
+	}
+	for i, f := range a.Folders {
+		s.Folders[i] = store.SnapshotFolder(f)
+	}
+	for i, l := range a.Links {
+		s.Links[i] = store.SnapshotLink(l)
+	}
+	for i, r := range a.RetiredAliases {
+		s.RetiredAliases[i] = store.RetiredAlias(r)
+	}
+	return s
+}
+
+func archiveUser(u store.SnapshotUser) backup.User {
+	out := backup.User{
+		ID: u.ID, Mail: u.Mail, PasswordHash: u.PasswordHash, Role: u.Role,
+		CreatedAt: u.CreatedAt, VerifiedAt: u.VerifiedAt, DisabledAt: u.DisabledAt,
+		TOTPSecret: u.TOTPSecret, TOTPEnabledAt: u.TOTPEnabledAt, TOTPLastStep: u.TOTPLastStep, RecoveryCodes: u.RecoveryCodes,
+	}
+	for _, o := range u.OIDCIdentities {
+		out.OIDCIdentities = append(out.OIDCIdentities, backup.OIDCIdentity(o))
+	}
+	return out
+}
+
+func snapshotUser(u backup.User) store.SnapshotUser {
+	out := store.SnapshotUser{
+		ID: u.ID, Mail: u.Mail, PasswordHash: u.PasswordHash, Role: u.Role,
+		CreatedAt: u.CreatedAt, VerifiedAt: u.VerifiedAt, DisabledAt: u.DisabledAt,
+		TOTPSecret: u.TOTPSecret, TOTPEnabledAt: u.TOTPEnabledAt, TOTPLastStep: u.TOTPLastStep, RecoveryCodes: u.RecoveryCodes,
+	}
+	for _, o := range u.OIDCIdentities {
+		out.OIDCIdentities = append(out.OIDCIdentities, store.SnapshotOIDCIdentity(o))
+	}
+	return out
+}
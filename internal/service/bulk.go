@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/store"
+)
+
+// maxBulkRows — сколько ссылок можно создать одним пакетом.
+const maxBulkRows = 1000
+
+// bulkCheckWorkers — сколько строк пакета проверяется одновременно: проверка адреса может ждать ответа DNS.
+const bulkCheckWorkers = 16
+
+var (
+	ErrBulkEmpty     = errors.New("no links to shorten")
+	ErrBulkRejected  = errors.New("batch rejected, no links were created")
+	ErrInvalidExpiry = errors.New("expiry must be in the future")
+)
+
+// BulkResult — итог по одной строке пакета.
+type BulkResult struct {
+	Row   int // номер строки во входных данных, с 1
+	URL   string
+	Alias string // пустой — ссылка не создана
+	Err   error
+}
+
+// ShortenBulk создаёт пакет ссылок владельца owner и возвращает итог по каждой строке.
+// Пустой alias — сгенерировать. Если atomic, ссылки создаются в одной транзакции: при ошибке в любой строке
+// не создаётся ни одна и возвращается ErrBulkRejected (итоги строк при этом тоже возвращаются).
+// Иначе каждая строка создаётся сама по себе, и ошибки строк не мешают остальным.
+func (s *ShortenerService) ShortenBulk(ctx context.Context, owner store.Owner, links []store.NewLink, atomic bool) ([]BulkResult, error) {
+	if len(links) == 0 {
+		return nil, ErrBulkEmpty
+	}
+	if len(links) > maxBulkRows {
+		return nil, ErrTooManyLinks
+	}
+
+	results := make([]BulkResult, len(links))
+	valid := make([]bool, len(links))
+	aliases := make(map[string]bool, len(links))
+	failed := false
+	s.checkNewLinks(ctx, links, results)
+	for i := range links {
+		results[i].Row, results[i].URL = i+1, links[i].URL
+		if results[i].Err == nil && links[i].Alias != "" {
+			if key := strings.ToLower(links[i].Alias); aliases[key] {
+				results[i].Err = store.ErrShortURLExists
+			} else {
+				aliases[key] = true
+			}
+		}
+		valid[i] = results[i].Err == nil
+		failed = failed || !valid[i]
+	}
+
+	if atomic {
+		if failed {
+			return results, ErrBulkRejected
+		}
+		created, err := s.createBatch(ctx, owner, links)
+		var batchErr *store.LinkBatchError
+		if errors.As(err, &batchErr) && errors.Is(err, store.ErrShortURLExists) {
+			results[batchErr.Index].Err = store.ErrShortURLExists
+			return results, ErrBulkRejected
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i := range results {
+			results[i].Alias = created[i].Alias
+		}
+	} else {
+		for i, l := range links {
+			if !valid[i] {
+				continue
+			}
+			created, err := s.createBatch(ctx, owner, []store.NewLink{l})
+			if err != nil {
+				if !errors.Is(err, store.ErrShortURLExists) {
+					logging.FromContext(ctx).Error("failed to create link from batch", "row", i+1, "error", err)
+				}
+				results[i].Err = err
+				continue
+			}
+			results[i].Alias = created[0].Alias
+		}
+	}
+
+	n := 0
+	for _, r := range results {
+		if r.Alias == "" {
+			continue
+		}
+		n++
+		s.audit.Record(ctx, AuditEntry{Action: AuditLinkCreate, TargetType: AuditTargetLink, TargetID: r.Alias,
+			After: linkState{URL: r.URL, WorkspaceID: owner.WorkspaceID}})
+	}
+	logging.FromContext(ctx).Info("links shortened in bulk", "rows", len(links), "created", n, "atomic", atomic)
+	return results, nil
+}
+
+// checkNewLinks проверяет строки пакета параллельно, не больше bulkCheckWorkers сразу.
+// Приведённые строки записываются в links, ошибки — в results.
+func (s *ShortenerService) checkNewLinks(ctx context.Context, links []store.NewLink, results []BulkResult) {
+	sem := make(chan struct{}, bulkCheckWorkers)
+	var wg sync.WaitGroup
+	for i := range links {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			links[i], results[i].Err = s.checkNewLink(ctx, links[i])
+		}()
+	}
+	wg.Wait()
+}
+
+// checkNewLink приводит строку пакета к виду для сохранения и проверяет её.
+func (s *ShortenerService) checkNewLink(ctx context.Context, l store.NewLink) (store.NewLink, error) {
+	l.Alias = strings.TrimSpace(l.Alias)
+	normalized, err := s.urlPolicy.Normalize(ctx, l.URL)
+	if err != nil {
+		return l, err
+	}
+	l.URL = normalized
+	if l.Alias != "" {
+		if err := validateAlias(l.Alias); err != nil {
+			return l, err
+		}
+	}
+	tags, err := NormalizeTags(l.Tags)
+	if err != nil {
+		return l, err
+	}
+	if len(tags) > maxTagsPerLink {
+		return l, ErrTooManyTags
+	}
+	l.Tags = tags
+	if !l.ExpiresAt.IsZero() && !l.ExpiresAt.After(s.now()) {
+		return l, ErrInvalidExpiry
+	}
+	return l, nil
+}
+
+// createBatch сохраняет ссылки одной транзакцией, генерируя alias там, где он не задан.
+// Если сгенерированный alias оказался занят, пробует другой — как generateUniqueAlias.
+func (s *ShortenerService) createBatch(ctx context.Context, owner store.Owner, links []store.NewLink) ([]store.NewLink, error) {
+	const maxAttempts = 5
+	batch := make([]store.NewLink, len(links))
+	generated := make([]bool, len(links))
+	for i, l := range links {
+		batch[i] = l
+		if l.Alias == "" {
+			batch[i].Alias, generated[i] = randomString(5), true
+		}
+	}
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		_, err := s.storage.CreateLinks(ctx, owner, batch)
+		var batchErr *store.LinkBatchError
+		if errors.As(err, &batchErr) && errors.Is(err, store.ErrShortURLExists) && generated[batchErr.Index] {
+			logging.FromContext(ctx).Debug("сгенерировали не уникальный алиас", "alias", batch[batchErr.Index].Alias)
+			batch[batchErr.Index].Alias = randomString(5)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return batch, nil
+	}
+	return nil, fmt.Errorf("could not generate unique aliases after %d attempts", maxAttempts)
+}
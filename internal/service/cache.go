@@ -0,0 +1,62 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+	"url-shorter/internal/store"
+)
+
+var ErrCacheNotWarmed = errors.New("url cache is not warmed yet")
+
+// urlCache — потокобезопасный кэш alias -> ссылка для редиректов.
+// Ссылка со сроком действия отдаётся из кэша только до его истечения.
+// Когда кэш заполнен, вытесняется произвольная запись (итерация по map в Go случайна),
+// для нашей нагрузки этого достаточно.
+type urlCache struct {
+	mu       sync.RWMutex
+	items    map[string]store.Redirect
+	capacity int
+	warmed   atomic.Bool
+}
+
+func newURLCache(capacity int) *urlCache {
+	return &urlCache{
+		items:    make(map[string]store.Redirect, capacity),
+		capacity: capacity,
+	}
+}
+
+func (c *urlCache) get(alias string) (store.Redirect, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.items[alias]
+	if !ok || (!e.ExpiresAt.IsZero() && !e.ExpiresAt.After(time.Now())) {
+		return store.Redirect{}, false
+	}
+	return e, true
+}
+
+func (c *urlCache) put(alias string, r store.Redirect) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.items[alias]; !ok && len(c.items) >= c.capacity {
+		for k := range c.items {
+			delete(c.items, k)
+			break
+		}
+	}
+	c.items[alias] = r
+}
+
+// deleteLink убирает все записи ссылки linkID: и по текущему alias, и по прежним.
+func (c *urlCache) deleteLink(linkID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for alias, e := range c.items {
+		if e.LinkID == linkID {
+			delete(c.items, alias)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+// clickCounter копит переходы в памяти, чтобы редирект из кэша не ходил в БД.
+// Накопленное периодически сбрасывается в БД (FlushClicks).
+type clickCounter struct {
+	mu     sync.Mutex
+	counts map[int64]int64 // ID ссылки -> переходы: alias может смениться до сброса
+}
+
+func newClickCounter() *clickCounter {
+	return &clickCounter{counts: make(map[int64]int64)}
+}
+
+func (c *clickCounter) add(linkID, n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[linkID] += n
+}
+
+// take забирает накопленное и обнуляет счётчик.
+func (c *clickCounter) take() map[int64]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := c.counts
+	c.counts = make(map[int64]int64)
+	return counts
+}
+
+// RecordClick учитывает переход по ссылке linkID.
+func (s *ShortenerService) RecordClick(linkID int64) {
+	s.clicks.add(linkID, 1)
+}
+
+// FlushClicks сохраняет накопленные переходы в БД. Вызывается периодически из main и при остановке.
+// Если сохранить не удалось, переходы возвращаются в счётчик до следующей попытки.
+func (s *ShortenerService) FlushClicks(ctx context.Context) error {
+	counts := s.clicks.take()
+	if len(counts) == 0 {
+		return nil
+	}
+	if err := s.storage.AddClicks(ctx, counts); err != nil {
+		for id, n := range counts {
+			s.clicks.add(id, n)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"url-shorter/internal/importer"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/store"
+)
+
+// maxImportRows — сколько ссылок можно импортировать за раз.
+const maxImportRows = 50000
+
+// importChunkSize — сколько ссылок импорта сохраняется одной транзакцией.
+const importChunkSize = 500
+
+// Итог импорта строки.
+const (
+	ImportCreated = "created"
+	ImportRenamed = "renamed" // alias из выгрузки занят или недопустим, ссылка создана под новым
+	ImportSkipped = "skipped"
+)
+
+// ImportOptions — как импортировать выгрузку.
+type ImportOptions struct {
+	DryRun          bool // только проверить выгрузку, ничего не сохраняя
+	RenameConflicts bool // занятый или недопустимый alias заменить сгенерированным, а не пропускать ссылку
+}
+
+// ImportResult — итог по одной ссылке выгрузки.
+type ImportResult struct {
+	Line        int
+	SourceAlias string
+	Alias       string // под каким alias ссылка создана; пустой — пропущена или, при DryRun, получит новый alias
+	URL         string
+	Status      string
+	Err         error // почему ссылка пропущена или переименована
+}
+
+// importPending — ссылка, прошедшая проверку, и номер её итога в results.
+type importPending struct {
+	link store.NewLink
+	row  int
+}
+
+// importState — то, что пишем об импорте в журнал аудита.
+type importState struct {
+	Created     int   `json:"created"`
+	Renamed     int   `json:"renamed"`
+	Skipped     int   `json:"skipped"`
+	WorkspaceID int64 `json:"workspace_id,omitempty"`
+}
+
+// ImportLinks создаёт ссылки владельца owner из выгрузки другого сокращателя, сохраняя alias, дату создания
+// и число переходов. Если alias уже занят (ErrShortURLExists) или не подходит под наши правила (ErrInvalidAlias),
+// ссылка пропускается либо, с RenameConflicts, создаётся под сгенерированным alias. Записи, которые
+// не удалось разобрать (rec.Err), пропускаются.
+// Ссылки сохраняются частями по importChunkSize в одной транзакции каждая; ссылка, alias которой заняли
+// между проверкой и сохранением, пропускается, остальные ссылки её части сохраняются.
+func (s *ShortenerService) ImportLinks(ctx context.Context, owner store.Owner, records []importer.Record, opts ImportOptions) ([]ImportResult, error) {
+	if len(records) == 0 {
+		return nil, ErrBulkEmpty
+	}
+	if len(records) > maxImportRows {
+		return nil, ErrTooManyLinks
+	}
+
+	aliases := make([]string, 0, len(records))
+	for _, rec := range records {
+		aliases = append(aliases, rec.Alias)
+	}
+	taken, err := s.storage.TakenAliases(ctx, aliases)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ImportResult, len(records))
+	pending := make([]importPending, 0, len(records))
+	for i, rec := range records {
+		res := &results[i]
+		*res = ImportResult{Line: rec.Line, SourceAlias: rec.Alias, URL: rec.URL, Status: ImportCreated}
+		if rec.Err != nil {
+			res.Status, res.Err = ImportSkipped, rec.Err
+			continue
+		}
+		link, err := s.importedLink(ctx, rec)
+		if err != nil {
+			res.Status, res.Err = ImportSkipped, err
+			continue
+		}
+
+		var aliasErr error
+		if err := validateAlias(link.Alias); err != nil {
+			aliasErr = err
+		} else if taken[link.Alias] {
+			aliasErr = store.ErrShortURLExists
+		}
+		if aliasErr != nil {
+			if !opts.RenameConflicts {
+				res.Status, res.Err = ImportSkipped, aliasErr
+				continue
+			}
+			link.Alias = ""
+			res.Status, res.Err = ImportRenamed, aliasErr
+		}
+		taken[link.Alias] = true
+		res.Alias = link.Alias
+		pending = append(pending, importPending{link: link, row: i})
+	}
+
+	if !opts.DryRun {
+		for start := 0; start < len(pending); start += importChunkSize {
+			chunk := pending[start:min(start+importChunkSize, len(pending))]
+			if err := s.importChunk(ctx, owner, chunk, results); err != nil {
+				return results[:chunk[0].row], err
+			}
+		}
+	}
+
+	var state importState
+	for _, res := range results {
+		switch res.Status {
+		case ImportCreated:
+			state.Created++
+		case ImportRenamed:
+			state.Renamed++
+		default:
+			state.Skipped++
+		}
+	}
+	logging.FromContext(ctx).Info("links imported", "rows", len(records), "created", state.Created,
+		"renamed", state.Renamed, "skipped", state.Skipped, "dry_run", opts.DryRun)
+	if !opts.DryRun {
+		state.WorkspaceID = owner.WorkspaceID
+		s.audit.Record(ctx, AuditEntry{Action: AuditLinkImport, TargetType: AuditTargetLink, After: state})
+	}
+	return results, nil
+}
+
+// importChunk сохраняет часть импорта одной транзакцией и записывает полученные alias в results.
+// Если alias заняли между проверкой и сохранением, эта ссылка помечается пропущенной,
+// а часть сохраняется заново без неё.
+func (s *ShortenerService) importChunk(ctx context.Context, owner store.Owner, chunk []importPending, results []ImportResult) error {
+	for len(chunk) > 0 {
+		links := make([]store.NewLink, len(chunk))
+		for j, p := range chunk {
+			links[j] = p.link
+		}
+		created, err := s.createBatch(ctx, owner, links)
+		var batchErr *store.LinkBatchError
+		if errors.As(err, &batchErr) && errors.Is(err, store.ErrShortURLExists) {
+			res := &results[chunk[batchErr.Index].row]
+			res.Status, res.Alias, res.Err = ImportSkipped, "", store.ErrShortURLExists
+			chunk = slices.Delete(chunk, batchErr.Index, batchErr.Index+1)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for j, p := range chunk {
+			results[p.row].Alias = created[j].Alias
+		}
+		return nil
+	}
+	return nil
+}
+
+// importedLink переводит запись выгрузки в ссылку и проверяет всё, кроме alias.
+// Слишком длинный заголовок обрезается: в чужих выгрузках это обычное дело и не повод терять ссылку.
+// Имя хоста не резолвится: у старых ссылок домен часто уже не существует, а переносить нужно все.
+// Схема, длина и запись адреса (localhost, частные сети) проверяются как обычно.
+func (s *ShortenerService) importedLink(ctx context.Context, rec importer.Record) (store.NewLink, error) {
+	link := store.NewLink{Alias: rec.Alias, URL: rec.URL, Title: rec.Title, CreatedAt: rec.CreatedAt, Clicks: rec.Clicks}
+	policy := s.urlPolicy
+	policy.ResolveHosts = false
+	normalized, err := policy.Normalize(ctx, link.URL)
+	if err != nil {
+		return link, err
+	}
+	link.URL = normalized
+	if title := []rune(link.Title); len(title) > maxLinkTitleLength {
+		link.Title = string(title[:maxLinkTitleLength])
+	}
+	tags, err := NormalizeTags(rec.Tags)
+	if err != nil {
+		return link, err
+	}
+	if len(tags) > maxTagsPerLink {
+		return link, ErrTooManyTags
+	}
+	link.Tags = tags
+	if link.CreatedAt.IsZero() || link.CreatedAt.After(s.now()) {
+		link.CreatedAt = s.now()
+	}
+	return link, nil
+}
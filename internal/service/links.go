@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/store"
+)
+
+const (
+	maxAliasLength     = 64
+	maxLinkTitleLength = 200
+	maxLinkNotesLength = 2000
+	linkHistoryLimit   = 50
+)
+
+var (
+	ErrLinkForbidden    = errors.New("not enough rights to edit the link")
+	ErrInvalidAlias     = errors.New("invalid alias")
+	ErrInvalidLinkURL   = errors.New("invalid link url")
+	ErrLinkFieldTooLong = errors.New("link title or notes are too long")
+)
+
+// reservedAliases — первые сегменты путей, занятые страницами сервиса: ссылка с таким alias не открылась бы.
+var reservedAliases = map[string]bool{
+	"admin": true, "api": true, "static": true, "healthz": true, "readyz": true,
+	"register": true, "login": true, "logout": true, "verify": true, "forgot": true, "reset": true,
+	"password": true, "2fa": true, "security": true, "tokens": true, "workspaces": true,
+	"shorten": true, "links": true, "trash": true, "tags": true, "folders": true, "bulk": true, "import": true,
+}
+
+// linkEditState — то, что пишем о правке ссылки в журнал аудита.
+type linkEditState struct {
+	Alias string `json:"alias"`
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+	Notes string `json:"notes,omitempty"`
+}
+
+func editState(e store.LinkEdit) linkEditState {
+	return linkEditState{Alias: e.Alias, URL: e.URL, Title: e.Title, Notes: e.Notes}
+}
+
+func linkEditOf(l store.Link) store.LinkEdit {
+	return store.LinkEdit{Alias: l.Alias, URL: l.URL, Title: l.Title, Notes: l.Notes}
+}
+
+// GetLink возвращает ссылку alias и сообщает, может ли userID её менять.
+// Личную ссылку видит только автор, ссылку пространства — его участники; остальным — ErrShortURLNotFound,
+// чтобы не раскрывать чужие ссылки. Для ссылки из корзины — ErrShortURLDeleted.
+func (s *ShortenerService) GetLink(ctx context.Context, userID int64, alias string) (store.Link, bool, error) {
+	link, canEdit, err := s.accessibleLink(ctx, userID, alias)
+	if err != nil {
+		return store.Link{}, false, err
+	}
+	if link.Deleted() {
+		return store.Link{}, false, store.ErrShortURLDeleted
+	}
+	return link, canEdit, nil
+}
+
+// accessibleLink — как GetLink, но отдаёт и ссылки из корзины.
+func (s *ShortenerService) accessibleLink(ctx context.Context, userID int64, alias string) (store.Link, bool, error) {
+	link, err := s.storage.GetLink(ctx, alias)
+	if err != nil {
+		return store.Link{}, false, err
+	}
+	if link.WorkspaceID == 0 {
+		if link.UserID != userID {
+			return store.Link{}, false, store.ErrShortURLNotFound
+		}
+		return link, true, nil
+	}
+	member, err := s.storage.GetMembership(ctx, link.WorkspaceID, userID)
+	if errors.Is(err, store.ErrNotWorkspaceMember) {
+		return store.Link{}, false, store.ErrShortURLNotFound
+	}
+	if err != nil {
+		return store.Link{}, false, err
+	}
+	return link, member.CanEdit(), nil
+}
+
+// editableLink возвращает ссылку, если userID может её менять, иначе ErrLinkForbidden.
+func (s *ShortenerService) editableLink(ctx context.Context, userID int64, alias string) (store.Link, error) {
+	link, canEdit, err := s.GetLink(ctx, userID, alias)
+	if err != nil {
+		return store.Link{}, err
+	}
+	if !canEdit {
+		return store.Link{}, ErrLinkForbidden
+	}
+	return link, nil
+}
+
+// LinkHistory возвращает прежние версии ссылки alias, начиная с последней.
+func (s *ShortenerService) LinkHistory(ctx context.Context, userID int64, alias string) ([]store.LinkVersion, error) {
+	link, _, err := s.GetLink(ctx, userID, alias)
+	if err != nil {
+		return nil, err
+	}
+	return s.storage.ListLinkHistory(ctx, link.ID, linkHistoryLimit)
+}
+
+// UpdateLink меняет адрес назначения, alias, заголовок и заметки ссылки alias.
+// Прежняя версия остаётся в истории, старый и новый alias убираются из кэша.
+func (s *ShortenerService) UpdateLink(ctx context.Context, userID int64, alias string, edit store.LinkEdit) (store.Link, error) {
+	link, err := s.editableLink(ctx, userID, alias)
+	if err != nil {
+		return store.Link{}, err
+	}
+	edit.Alias = strings.TrimSpace(edit.Alias)
+	edit.URL = strings.TrimSpace(edit.URL)
+	edit.Title = strings.TrimSpace(edit.Title)
+	edit.Notes = strings.TrimSpace(edit.Notes)
+	if edit.Alias != link.Alias {
+		if err := validateAlias(edit.Alias); err != nil {
+			return store.Link{}, err
+		}
+	}
+	// адреса, сохранённые до ужесточения правил, не мешают править заголовок и заметки
+	if edit.URL != link.URL {
+		normalized, err := s.urlPolicy.Normalize(ctx, edit.URL)
+		if err != nil {
+			return store.Link{}, err
+		}
+		edit.URL = normalized
+	}
+	if utf8.RuneCountInString(edit.Title) > maxLinkTitleLength || utf8.RuneCountInString(edit.Notes) > maxLinkNotesLength {
+		return store.Link{}, ErrLinkFieldTooLong
+	}
+	return s.saveLinkEdit(ctx, userID, link, edit, AuditLinkUpdate)
+}
+
+// RollbackLink возвращает ссылке alias адрес назначения из версии versionID.
+// Alias, заголовок и заметки не меняются; сам откат тоже попадает в историю.
+func (s *ShortenerService) RollbackLink(ctx context.Context, userID int64, alias string, versionID int64) (store.Link, error) {
+	link, err := s.editableLink(ctx, userID, alias)
+	if err != nil {
+		return store.Link{}, err
+	}
+	version, err := s.storage.GetLinkVersion(ctx, link.ID, versionID)
+	if err != nil {
+		return store.Link{}, err
+	}
+	edit := linkEditOf(link)
+	// прежний адрес мог быть сохранён до ужесточения правил, поэтому проверяется заново
+	edit.URL, err = s.urlPolicy.Normalize(ctx, version.URL)
+	if err != nil {
+		return store.Link{}, err
+	}
+	return s.saveLinkEdit(ctx, userID, link, edit, AuditLinkRollback)
+}
+
+func (s *ShortenerService) saveLinkEdit(ctx context.Context, userID int64, link store.Link, edit store.LinkEdit, action string) (store.Link, error) {
+	before := linkEditOf(link)
+	if edit == before {
+		return link, nil
+	}
+	if err := s.storage.UpdateLink(ctx, link.ID, edit, userID); err != nil {
+		return store.Link{}, err
+	}
+	s.forget(link.ID)
+	logging.FromContext(ctx).Info("link updated", "link_id", link.ID, "alias", edit.Alias)
+	s.audit.Record(ctx, AuditEntry{Action: action, TargetType: AuditTargetLink, TargetID: link.Alias,
+		Before: editState(before), After: editState(edit)})
+
+	link.Alias, link.URL, link.Title, link.Notes = edit.Alias, edit.URL, edit.Title, edit.Notes
+	return link, nil
+}
+
+// validateAlias проверяет alias, выбранный пользователем: латиница, цифры, «-» и «_», не длиннее maxAliasLength
+// и не совпадает со страницами сервиса.
+func validateAlias(alias string) error {
+	if alias == "" || len(alias) > maxAliasLength || reservedAliases[strings.ToLower(alias)] {
+		return ErrInvalidAlias
+	}
+	for _, c := range alias {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return ErrInvalidAlias
+		}
+	}
+	return nil
+}
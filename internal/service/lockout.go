@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/store"
+)
+
+// LockoutPolicy — правила прогрессивной задержки и блокировки после неудачных входов.
+type LockoutPolicy struct {
+	FreeAttempts     int           // сколько неудач подряд прощаем без задержки
+	BaseDelay        time.Duration // задержка после первой "платной" неудачи, дальше удваивается
+	MaxDelay         time.Duration
+	AccountThreshold int // после стольких неудач аккаунт блокируется
+	IPThreshold      int // после стольких неудач блокируется IP
+	LockoutDuration  time.Duration
+	Window           time.Duration // неудачи старше окна не учитываются
+}
+
+// DefaultLockoutPolicy используется, если в конфиге ничего не задано.
+var DefaultLockoutPolicy = LockoutPolicy{
+	FreeAttempts:     3,
+	BaseDelay:        time.Second,
+	MaxDelay:         time.Minute,
+	AccountThreshold: 10,
+	IPThreshold:      50,
+	LockoutDuration:  15 * time.Minute,
+	Window:           time.Hour,
+}
+
+// LoginBlockedError возвращается, если попытку входа нельзя даже проверять.
+type LoginBlockedError struct {
+	Locked     bool          // true — блокировка по порогу, false — прогрессивная задержка
+	RetryAfter time.Duration // через сколько можно пробовать снова
+}
+
+func (e *LoginBlockedError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("login is locked, retry after %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many failed login attempts, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+// delay возвращает задержку, которая должна пройти после failures неудач.
+func (p LockoutPolicy) delay(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxDelay)
+}
+
+// CheckLoginAllowed проверяет, можно ли сейчас проверять пароль для mail с адреса ip.
+// Если нельзя — возвращает *LoginBlockedError и записывает событие.
+func (us *UserService) CheckLoginAllowed(ctx context.Context, mail, ip string) error {
+	mail = NormalizeEmail(mail)
+	now := time.Now()
+	var retryAfter time.Duration
+	locked := false
+
+	for _, sk := range [][2]string{{store.ThrottleScopeAccount, mail}, {store.ThrottleScopeIP, ip}} {
+		t, err := us.storage.GetLoginThrottle(ctx, sk[0], sk[1])
+		if err != nil {
+			return err
+		}
+		if wait := t.LockedUntil.Sub(now); wait > 0 {
+			locked = true
+			retryAfter = max(retryAfter, wait)
+		}
+		if t.LastFailure.Sub(now) > -us.lockout.Window {
+			if wait := t.LastFailure.Add(us.lockout.delay(t.Failures)).Sub(now); wait > 0 {
+				retryAfter = max(retryAfter, wait)
+			}
+		}
+	}
+
+	if retryAfter <= 0 {
+		return nil
+	}
+	us.saveLoginEvent(ctx, 0, mail, ip, store.LoginEventBlocked)
+	return &LoginBlockedError{Locked: locked, RetryAfter: retryAfter}
+}
+
+// LoginFailed учитывает неудачную попытку входа. userID равен 0, если такого пользователя нет.
+// При превышении порога блокирует аккаунт или IP и обнуляет счётчик. Владельцу аккаунта пишем
+// не чаще раза за Window: иначе перебор, повторяющийся после каждой блокировки, заваливал бы его письмами.
+func (us *UserService) LoginFailed(ctx context.Context, userID int64, mail, ip string) error {
+	mail = NormalizeEmail(mail)
+	us.saveLoginEvent(ctx, userID, mail, ip, store.LoginEventFailure)
+	us.audit.Record(ctx, AuditEntry{Action: AuditUserLoginFailed, TargetType: AuditTargetUser, TargetID: auditID(userID),
+		After: map[string]string{"mail": mail}})
+	log := logging.FromContext(ctx)
+
+	account, err := us.storage.RecordLoginFailure(ctx, store.ThrottleScopeAccount, mail, us.lockout.Window)
+	if err != nil {
+		return err
+	}
+	byIP, err := us.storage.RecordLoginFailure(ctx, store.ThrottleScopeIP, ip, us.lockout.Window)
+	if err != nil {
+		return err
+	}
+
+	until := time.Now().Add(us.lockout.LockoutDuration)
+	if account.Failures >= us.lockout.AccountThreshold {
+		notify, err := us.storage.LockLogin(ctx, store.ThrottleScopeAccount, mail, until, us.lockout.Window)
+		if err != nil {
+			return err
+		}
+		us.saveLoginEvent(ctx, userID, mail, ip, store.LoginEventLocked)
+		log.Warn("account locked after failed logins", "mail", mail, "failures", account.Failures, "until", until)
+		// уведомляем только существующих пользователей, иначе это спам на произвольные адреса
+		if userID != 0 && notify {
+			if err := us.notifier.NotifyAccountLocked(ctx, mail, until); err != nil {
+				log.Error("failed to notify user about lockout", "mail", mail, "error", err)
+			}
+		}
+	}
+	if byIP.Failures >= us.lockout.IPThreshold {
+		if _, err := us.storage.LockLogin(ctx, store.ThrottleScopeIP, ip, until, us.lockout.Window); err != nil {
+			return err
+		}
+		us.saveLoginEvent(ctx, userID, mail, ip, store.LoginEventLocked)
+		log.Warn("ip locked after failed logins", "client_ip", ip, "failures", byIP.Failures, "until", until)
+	}
+	return nil
+}
+
+// LoginSucceeded сбрасывает счётчик аккаунта. Счётчик IP не сбрасывается:
+// иначе перебор можно было бы обнулять, периодически входя в свой аккаунт.
+func (us *UserService) LoginSucceeded(ctx context.Context, userID int64, mail, ip string) error {
+	mail = NormalizeEmail(mail)
+	us.saveLoginEvent(ctx, userID, mail, ip, store.LoginEventSuccess)
+	us.audit.Record(ctx, AuditEntry{Action: AuditUserLogin, ActorID: userID, TargetType: AuditTargetUser, TargetID: auditID(userID)})
+	return us.storage.ResetLoginThrottle(ctx, store.ThrottleScopeAccount, mail)
+}
+
+// saveLoginEvent пишет событие; ошибка записи не должна ломать вход, поэтому только логируется.
+func (us *UserService) saveLoginEvent(ctx context.Context, userID int64, mail, ip, event string) {
+	e := store.LoginEvent{UserID: userID, Mail: mail, IP: ip, Event: event}
+	if err := us.storage.SaveLoginEvent(ctx, e); err != nil {
+		logging.FromContext(ctx).Error("failed to save login event", "event", event, "error", err)
+	}
+}
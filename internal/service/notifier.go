@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/mail"
+)
+
+// Notifier отправляет пользователю уведомления о событиях безопасности.
+type Notifier interface {
+	NotifyAccountLocked(ctx context.Context, mail string, until time.Time) error
+}
+
+// LogNotifier только пишет уведомления в лог. Используется, пока не настроена отправка писем.
+type LogNotifier struct{}
+
+func (LogNotifier) NotifyAccountLocked(ctx context.Context, mail string, until time.Time) error {
+	logging.FromContext(ctx).Info("notification: account locked", "mail", mail, "until", until)
+	return nil
+}
+
+// MailNotifier отправляет уведомления письмами.
+type MailNotifier struct {
+	Mailer mail.Mailer
+}
+
+func (n MailNotifier) NotifyAccountLocked(ctx context.Context, to string, until time.Time) error {
+	return n.Mailer.Send(ctx, mail.Message{
+		To:      to,
+		Subject: "Вход в аккаунт временно заблокирован",
+		Body: fmt.Sprintf("Здравствуйте!\n\nИз-за нескольких неудачных попыток входа вход в ваш аккаунт URL-Shortener "+
+			"заблокирован до %s.\n\nЕсли это были не вы, рекомендуем сменить пароль после разблокировки.\n",
+			until.Format("02.01.2006 15:04 MST")),
+	})
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/oidc"
+	"url-shorter/internal/store"
+)
+
+const (
+	purposeOIDCLogin = "oidc-login"
+	oidcLoginTTL     = 10 * time.Minute
+)
+
+var (
+	ErrOIDCEmailNotVerified = errors.New("identity provider did not confirm the email")
+	ErrOIDCSignupDisabled   = errors.New("no account for this identity and sign-up via identity provider is disabled")
+)
+
+// OIDCLogin — одноразовые значения одного входа через провайдера.
+// Хранятся у браузера в подписанной cookie до возврата на callback.
+type OIDCLogin struct {
+	State    string // защищает callback от CSRF
+	Nonce    string // связывает ID-токен с этим входом
+	Verifier string // PKCE code verifier
+}
+
+// BeginOIDCLogin генерирует state, nonce и PKCE verifier и возвращает их вместе с подписанным токеном для cookie.
+func (us *UserService) BeginOIDCLogin() (OIDCLogin, string, error) {
+	state, err := oidc.RandomString()
+	if err != nil {
+		return OIDCLogin{}, "", fmt.Errorf("failed to generate state: %w", err)
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return OIDCLogin{}, "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	l := OIDCLogin{State: state, Nonce: nonce, Verifier: oidc.NewVerifier()}
+	token := signToken(us.secret, purposeOIDCLogin, us.now().Add(oidcLoginTTL), l.State, l.Nonce, l.Verifier)
+	return l, token, nil
+}
+
+// ParseOIDCLogin проверяет токен из BeginOIDCLogin.
+func (us *UserService) ParseOIDCLogin(token string) (OIDCLogin, error) {
+	fields, err := verifyToken(us.secret, purposeOIDCLogin, token)
+	if err != nil {
+		return OIDCLogin{}, err
+	}
+	if len(fields) != 3 {
+		return OIDCLogin{}, ErrInvalidToken
+	}
+	return OIDCLogin{State: fields[0], Nonce: fields[1], Verifier: fields[2]}, nil
+}
+
+// LoginWithOIDC находит пользователя по учётной записи провайдера и возвращает его ID и email.
+// Если записи ещё нет, она привязывается к пользователю с тем же email — только если провайдер
+// подтвердил email, иначе чужой аккаунт можно было бы захватить, указав у провайдера его адрес.
+// Аккаунт с неподтверждённым email при этом переходит к владельцу адреса: пароль и сессии того,
+// кто его зарегистрировал, удаляются (см. store.LinkOIDCIdentity).
+// Если пользователя с таким email нет, он создаётся (JIT), когда это разрешено настройками.
+func (us *UserService) LoginWithOIDC(ctx context.Context, id oidc.Identity) (int64, string, error) {
+	log := logging.FromContext(ctx)
+
+	userID, err := us.storage.GetUserIDByOIDCIdentity(ctx, id.Issuer, id.Subject)
+	if err == nil {
+		mail, _, err := us.storage.GetUserByID(ctx, userID)
+		return userID, mail, err
+	}
+	if !errors.Is(err, store.ErrOIDCIdentityNotFound) {
+		return 0, "", err
+	}
+
+	if !id.EmailVerified || id.Email == "" {
+		return 0, "", ErrOIDCEmailNotVerified
+	}
+	mail := NormalizeEmail(id.Email)
+
+	userID, _, err = us.storage.GetUserByEmail(ctx, mail)
+	switch {
+	case err == nil:
+		claimed, err := us.storage.LinkOIDCIdentity(ctx, userID, id.Issuer, id.Subject)
+		if err != nil {
+			return 0, "", err
+		}
+		if claimed {
+			log.Warn("unverified account claimed via oidc, local credentials revoked", "user_id", userID, "issuer", id.Issuer)
+		} else {
+			log.Info("oidc identity linked", "user_id", userID, "issuer", id.Issuer)
+		}
+		us.audit.Record(ctx, AuditEntry{Action: AuditUserOIDCLink, ActorID: userID, TargetType: AuditTargetUser, TargetID: auditID(userID),
+			After: map[string]string{"issuer": id.Issuer, "claimed": strconv.FormatBool(claimed)}})
+		return userID, mail, nil
+	case !errors.Is(err, store.ErrUserNotFound):
+		return 0, "", err
+	}
+
+	if !us.oidcSignup {
+		return 0, "", ErrOIDCSignupDisabled
+	}
+	userID, err = us.storage.CreateOIDCUser(ctx, mail, id.Issuer, id.Subject)
+	if err != nil {
+		return 0, "", err
+	}
+	log.Info("user provisioned via oidc", "user_id", userID, "issuer", id.Issuer)
+	us.audit.Record(ctx, AuditEntry{Action: AuditUserRegister, ActorID: userID, TargetType: AuditTargetUser, TargetID: auditID(userID),
+		After: map[string]string{"mail": mail, "issuer": id.Issuer}})
+	return userID, mail, nil
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordPolicy — требования к паролю при регистрации и смене пароля.
+type PasswordPolicy struct {
+	MinLength       int
+	MaxLength       int  // bcrypt всё равно учитывает только первые 72 байта
+	MinCharClasses  int  // сколько разных классов символов нужно: строчные, заглавные, цифры, прочие
+	DenyCommon      bool // запрещать пароли из встроенного списка распространённых
+	DenyEmailAlike  bool // запрещать пароли, похожие на email
+	MaxEmailSimilar float64
+}
+
+// DefaultPasswordPolicy используется, если в конфиге ничего не задано.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:       8,
+	MaxLength:       72,
+	MinCharClasses:  2,
+	DenyCommon:      true,
+	DenyEmailAlike:  true,
+	MaxEmailSimilar: 0.7,
+}
+
+// PasswordPolicyError перечисляет все нарушенные требования, чтобы показать их пользователю разом.
+type PasswordPolicyError struct {
+	Problems []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password does not satisfy policy: " + strings.Join(e.Problems, "; ")
+}
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+var commonPasswords = parseCommonPasswords(commonPasswordsFile)
+
+func parseCommonPasswords(data string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		set[strings.ToLower(line)] = struct{}{}
+	}
+	return set
+}
+
+// ValidatePassword проверяет пароль по политике. mail нужен для проверки похожести на email.
+// Возвращает *PasswordPolicyError со всеми нарушениями или nil.
+func (p PasswordPolicy) ValidatePassword(mail, password string) error {
+	var problems []string
+	length := utf8.RuneCountInString(password)
+
+	if length < p.MinLength {
+		problems = append(problems, fmt.Sprintf("Пароль должен быть не короче %d символов", p.MinLength))
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		problems = append(problems, fmt.Sprintf("Пароль должен быть не длиннее %d байт", p.MaxLength))
+	}
+	if classes := charClasses(password); classes < p.MinCharClasses {
+		problems = append(problems, fmt.Sprintf(
+			"Пароль должен содержать символы хотя бы %d разных типов: строчные и заглавные буквы, цифры, прочие символы",
+			p.MinCharClasses))
+	}
+
+	lower := strings.ToLower(password)
+	if p.DenyCommon {
+		if _, ok := commonPasswords[lower]; ok {
+			problems = append(problems, "Этот пароль слишком распространён, выберите другой")
+		}
+	}
+	if p.DenyEmailAlike && similarToEmail(lower, strings.ToLower(mail), p.MaxEmailSimilar) {
+		problems = append(problems, "Пароль не должен совпадать с email или быть на него похожим")
+	}
+
+	if len(problems) > 0 {
+		return &PasswordPolicyError{Problems: problems}
+	}
+	return nil
+}
+
+func charClasses(s string) int {
+	var lower, upper, digit, other bool
+	for _, r := range s {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	n := 0
+	for _, ok := range []bool{lower, upper, digit, other} {
+		if ok {
+			n++
+		}
+	}
+	return n
+}
+
+// similarToEmail сравнивает пароль с email целиком и с его локальной частью (до @).
+// Похожими считаются строки, одна из которых содержит другую,
+// или у которых доля совпадения по расстоянию Левенштейна больше threshold.
+func similarToEmail(password, mail string, threshold float64) bool {
+	if mail == "" {
+		return false
+	}
+	candidates := []string{mail}
+	if local, _, ok := strings.Cut(mail, "@"); ok && local != "" {
+		candidates = append(candidates, local)
+	}
+	for _, c := range candidates {
+		// очень короткие локальные части ("a@x.ru") дают ложные срабатывания на contains
+		if len(c) >= 3 && len(password) >= 3 && (strings.Contains(password, c) || strings.Contains(c, password)) {
+			return true
+		}
+		if similarity(password, c) > threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// similarity возвращает 1 - levenshtein(a, b) / max(len(a), len(b)).
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/mail"
+	"url-shorter/internal/store"
+)
+
+// RequestPasswordReset отправляет на mail ссылку для сброса пароля.
+// Если пользователя нет, ничего не делает и не возвращает ошибку,
+// чтобы по ответу нельзя было проверить, зарегистрирован ли адрес.
+func (us *UserService) RequestPasswordReset(ctx context.Context, mailAddr, resetURL string) error {
+	log := logging.FromContext(ctx)
+	mailAddr = NormalizeEmail(mailAddr)
+	userID, _, err := us.storage.GetUserByEmail(ctx, mailAddr)
+	if err != nil {
+		if errors.Is(err, store.ErrUserNotFound) {
+			log.Info("password reset requested for unknown email")
+			return nil
+		}
+		return err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate reset token: %w", err)
+	}
+	if err := us.storage.SavePasswordReset(ctx, userID, hashToken(token), us.now().Add(us.resetTTL)); err != nil {
+		return err
+	}
+
+	link := resetURL + "?token=" + url.QueryEscape(token)
+	msg := mail.Message{
+		To:      mailAddr,
+		Subject: "Сброс пароля в URL-Shortener",
+		Body: fmt.Sprintf("Здравствуйте!\n\nЧтобы задать новый пароль, перейдите по ссылке:\n%s\n\n"+
+			"Ссылка одноразовая и действует %s. Если вы не запрашивали сброс пароля, просто проигнорируйте это письмо.\n",
+			link, us.resetTTL),
+	}
+	if err := us.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send password reset email: %w", err)
+	}
+	log.Info("password reset email sent", "user_id", userID)
+	return nil
+}
+
+// GetPasswordResetUser возвращает ID и email пользователя, которому выдан действующий токен сброса.
+func (us *UserService) GetPasswordResetUser(ctx context.Context, token string) (int64, string, error) {
+	userID, err := us.storage.GetPasswordResetUser(ctx, hashToken(token))
+	if err != nil {
+		return 0, "", err
+	}
+	mailAddr, _, err := us.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return 0, "", err
+	}
+	return userID, mailAddr, nil
+}
+
+// ResetPassword гасит токен, сохраняет новый хеш пароля, завершает все сессии пользователя и отзывает
+// его API-токены.
+// Пароль должен быть заранее проверен ValidatePassword.
+func (us *UserService) ResetPassword(ctx context.Context, token, hash string) (int64, error) {
+	userID, err := us.storage.ResetPassword(ctx, hashToken(token), hash)
+	if err != nil {
+		return 0, err
+	}
+	us.audit.Record(ctx, AuditEntry{Action: AuditUserPasswordReset, ActorID: userID, TargetType: AuditTargetUser, TargetID: auditID(userID)})
+	// владелец только что доказал доступ к почте — снимаем блокировку входа, если она была
+	mailAddr, _, err := us.storage.GetUserByID(ctx, userID)
+	if err == nil {
+		err = us.storage.ResetLoginThrottle(ctx, store.ThrottleScopeAccount, mailAddr)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to reset login throttle after password reset", "error", err)
+	}
+	return userID, nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/store"
+)
+
+const maxUserAgentLength = 512
+
+// SessionPolicy — сроки жизни сессий.
+type SessionPolicy struct {
+	Lifetime         time.Duration // сессия истекает после стольких часов бездействия
+	RememberLifetime time.Duration // то же для входа с "запомнить меня"
+	MaxLifetime      time.Duration // абсолютный предел с момента входа, активность его не продлевает
+	// RenewInterval — не чаще какого интервала продлеваем сессию,
+	// чтобы не писать в БД на каждый запрос.
+	RenewInterval time.Duration
+}
+
+// DefaultSessionPolicy используется, если в конфиге ничего не задано.
+var DefaultSessionPolicy = SessionPolicy{
+	Lifetime:         24 * time.Hour,
+	RememberLifetime: 30 * 24 * time.Hour,
+	MaxLifetime:      90 * 24 * time.Hour,
+	RenewInterval:    5 * time.Minute,
+}
+
+func (p SessionPolicy) lifetime(remember bool) time.Duration {
+	if remember {
+		return p.RememberLifetime
+	}
+	return p.Lifetime
+}
+
+// CreateSession создаёт сессию для пользователя и возвращает токен и момент, после которого
+// сессия не будет действительна ни при какой активности (для срока жизни куки).
+func (us *UserService) CreateSession(ctx context.Context, userID int64, ip, userAgent string, remember bool) (string, time.Time, error) {
+	userAgent = truncateUTF8(userAgent, maxUserAgentLength)
+	now := us.now()
+	s := store.Session{
+		UserID:            userID,
+		ExpiresAt:         now.Add(us.sessions.lifetime(remember)),
+		AbsoluteExpiresAt: now.Add(us.sessions.MaxLifetime),
+		Remember:          remember,
+		IP:                ip,
+		UserAgent:         userAgent,
+	}
+	if s.ExpiresAt.After(s.AbsoluteExpiresAt) {
+		s.ExpiresAt = s.AbsoluteExpiresAt
+	}
+	token, err := us.storage.CreateSession(ctx, s)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, s.AbsoluteExpiresAt, nil
+}
+
+// AuthenticateSession возвращает действующую сессию по токену из куки, отмечает её использование
+// и продлевает срок (скользящее истечение). В БД пишем не чаще RenewInterval.
+func (us *UserService) AuthenticateSession(ctx context.Context, token string) (store.Session, error) {
+	s, err := us.storage.GetSession(ctx, token)
+	if err != nil {
+		return store.Session{}, err
+	}
+	now := us.now()
+	if now.Sub(s.LastSeenAt) >= us.sessions.RenewInterval {
+		if err := us.storage.TouchSession(ctx, s.ID, now.Add(us.sessions.lifetime(s.Remember))); err != nil {
+			// запрос из-за этого не отклоняем: сессия действительна
+			logging.FromContext(ctx).Warn("failed to touch session", "error", err)
+		}
+	}
+	return s, nil
+}
+
+// ListSessions возвращает действующие сессии пользователя.
+func (us *UserService) ListSessions(ctx context.Context, userID int64) ([]store.Session, error) {
+	return us.storage.ListSessions(ctx, userID)
+}
+
+// RevokeSession завершает одну из сессий пользователя.
+func (us *UserService) RevokeSession(ctx context.Context, userID, sessionID int64) error {
+	if err := us.storage.DeleteUserSession(ctx, userID, sessionID); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("session revoked", "session_id", sessionID)
+	us.audit.Record(ctx, AuditEntry{Action: AuditSessionRevoke, TargetType: AuditTargetSession, TargetID: auditID(sessionID)})
+	return nil
+}
+
+// RevokeOtherSessions завершает все сессии пользователя, кроме текущей.
+func (us *UserService) RevokeOtherSessions(ctx context.Context, userID, currentID int64) (int64, error) {
+	n, err := us.storage.DeleteOtherSessions(ctx, userID, currentID)
+	if err != nil {
+		return 0, err
+	}
+	logging.FromContext(ctx).Info("other sessions revoked", "count", n)
+	us.audit.Record(ctx, AuditEntry{Action: AuditSessionRevokeOther, TargetType: AuditTargetUser, TargetID: auditID(userID),
+		After: map[string]int64{"revoked": n, "kept_session_id": currentID}})
+	return n, nil
+}
+
+// DeleteExpiredSessions удаляет истёкшие сессии. Вызывается периодически из main.
+func (us *UserService) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	return us.storage.DeleteExpiredSessions(ctx)
+}
+
+// truncateUTF8 обрезает s до n байт, не разрезая символ посередине. Битые последовательности
+// заменяются на U+FFFD: заголовок User-Agent присылает клиент, а PostgreSQL не примет невалидный UTF-8.
+func truncateUTF8(s string, n int) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -7,66 +7,185 @@ import (
 	"fmt"
 	"log/slog"
 	"math/big"
+	"strings"
+	"time"
+	"url-shorter/internal/logging"
 	"url-shorter/internal/store"
 )
 
 type StoreUrl interface {
-	SaveUrl(ctx context.Context, shortCode, longUrl string) (int64, error)
-	GetUrl(ctx context.Context, alias string) (string, error)
-}
+	SaveUrl(ctx context.Context, owner store.Owner, shortCode, longUrl string) (int64, error)
+	GetUrl(ctx context.Context, alias string) (store.Redirect, error)
+	ListRecentUrls(ctx context.Context, limit int) (map[string]store.Redirect, error)
+	ListLinks(ctx context.Context, owner store.Owner, filter store.LinkFilter, limit int) ([]store.Link, error)
+	GetLinkStats(ctx context.Context, owner store.Owner, filter store.LinkFilter) (store.LinkStats, error)
+
+	GetLink(ctx context.Context, alias string) (store.Link, error)
+	UpdateLink(ctx context.Context, id int64, edit store.LinkEdit, changedBy int64) error
+	ListLinkHistory(ctx context.Context, linkID int64, limit int) ([]store.LinkVersion, error)
+	GetLinkVersion(ctx context.Context, linkID, versionID int64) (store.LinkVersion, error)
+	GetMembership(ctx context.Context, workspaceID, userID int64) (store.Membership, error)
+
+	DeleteLink(ctx context.Context, id int64) error
+	UndeleteLink(ctx context.Context, id int64, since time.Time) error
+	ListDeletedLinks(ctx context.Context, owner store.Owner, since time.Time, limit int) ([]store.Link, error)
+	PurgeDeletedLinks(ctx context.Context, before time.Time) (int64, error)
 
-type StoreUser interface {
-	SaveUser(ctx context.Context, mail, pass string) error
+	ListTags(ctx context.Context, owner store.Owner) ([]store.Tag, error)
+	SetLinkTags(ctx context.Context, owner store.Owner, linkID int64, names []string) error
+	BulkTagLinks(ctx context.Context, links map[store.Owner][]int64, add, remove []string) error
+	ListFolders(ctx context.Context, owner store.Owner) ([]store.Folder, error)
+	GetFolder(ctx context.Context, owner store.Owner, id int64) (store.Folder, error)
+	CreateFolder(ctx context.Context, owner store.Owner, name string) (store.Folder, error)
+	DeleteFolder(ctx context.Context, owner store.Owner, id int64) error
+	SetLinkFolder(ctx context.Context, linkID, folderID int64) error
+
+	CreateLinks(ctx context.Context, owner store.Owner, links []store.NewLink) ([]int64, error)
+	TakenAliases(ctx context.Context, aliases []string) (map[string]bool, error)
+	AddClicks(ctx context.Context, clicks map[int64]int64) error
 }
 
+// cacheCapacity — сколько ссылок держим в памяти для быстрых редиректов.
+const cacheCapacity = 10000
+
+// linkListLimit — сколько последних ссылок показываем в списке.
+const linkListLimit = 100
+
 type ShortenerService struct {
-	storage StoreUrl
+	storage        StoreUrl
+	cache          *urlCache
+	clicks         *clickCounter
+	audit          *AuditLog
+	trashRetention time.Duration // сколько удалённая ссылка лежит в корзине
+	urlPolicy      URLPolicy
+	now            func() time.Time
+}
+
+// NewShortenerService создаёт сервис ссылок. trashRetention = 0 — срок хранения в корзине по умолчанию.
+func NewShortenerService(s StoreUrl, audit *AuditLog, trashRetention time.Duration) *ShortenerService {
+	if trashRetention <= 0 {
+		trashRetention = defaultTrashRetention
+	}
+	return &ShortenerService{storage: s, cache: newURLCache(cacheCapacity), clicks: newClickCounter(), audit: audit,
+		trashRetention: trashRetention, now: time.Now}
 }
 
-func NewShortenerService(s StoreUrl) *ShortenerService {
-	return &ShortenerService{storage: s}
+// SetURLPolicy задаёт правила проверки и нормализации адресов назначения.
+func (s *ShortenerService) SetURLPolicy(p URLPolicy) {
+	s.urlPolicy = p
 }
 
-// CreateShortURL генерирует короткую ссылку, сохраняет ее и возвращает.
-func (s *ShortenerService) CreateShortURL(originalURL string) (string, error) {
+// CreateShortURL проверяет и нормализует originalURL, генерирует короткую ссылку для владельца owner,
+// сохраняет ее и возвращает вместе с сохранённым адресом.
+func (s *ShortenerService) CreateShortURL(ctx context.Context, owner store.Owner, originalURL string) (string, string, error) {
+	originalURL, err := s.urlPolicy.Normalize(ctx, originalURL)
+	if err != nil {
+		return "", "", err
+	}
 
-	alias, err := generateUniqueAlias(context.Background(), s.storage, 5, originalURL)
+	alias, err := generateUniqueAlias(ctx, s.storage, 5, owner, originalURL)
 
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
+	s.audit.Record(ctx, AuditEntry{Action: AuditLinkCreate, TargetType: AuditTargetLink, TargetID: alias,
+		After: linkState{URL: originalURL, WorkspaceID: owner.WorkspaceID}})
 
-	return alias, nil
+	return alias, originalURL, nil
 }
 
 // GetOriginalURL возвращает оригинальный URL по его псевдониму.
 // эта функция нужна здесь, для дальнейшей простоты и масштабируемости проекта
 // и некой инкапсуляции логики, эта функция не связана с DbManager.GetUrl()
-func (s *ShortenerService) GetOriginalURL(alias string) (string, error) {
-	return s.storage.GetUrl(context.Background(), alias)
+func (s *ShortenerService) GetOriginalURL(ctx context.Context, alias string) (string, error) {
+	r, err := s.Resolve(ctx, alias)
+	if err != nil {
+		return "", err
+	}
+	return r.URL, nil
+}
+
+// Resolve возвращает ссылку для редиректа по alias: сначала из кэша, потом из БД.
+// Прежний alias переименованной ссылки тоже ведёт на неё.
+func (s *ShortenerService) Resolve(ctx context.Context, alias string) (store.Redirect, error) {
+	if r, ok := s.cache.get(alias); ok {
+		return r, nil
+	}
+	r, err := s.storage.GetUrl(ctx, alias)
+	if err != nil {
+		return store.Redirect{}, err
+	}
+	s.cache.put(alias, r)
+	return r, nil
+}
+
+// linkState — то, что пишем о ссылке в журнал аудита.
+type linkState struct {
+	URL         string `json:"url"`
+	WorkspaceID int64  `json:"workspace_id,omitempty"`
+}
+
+// ListLinks возвращает последние ссылки владельца owner, подходящие под filter.
+func (s *ShortenerService) ListLinks(ctx context.Context, owner store.Owner, filter store.LinkFilter) ([]store.Link, error) {
+	filter.Tag = strings.TrimSpace(filter.Tag)
+	return s.storage.ListLinks(ctx, owner, filter, linkListLimit)
+}
+
+// LinkStats считает ссылки владельца owner, подходящие под filter, и переходы по ним.
+func (s *ShortenerService) LinkStats(ctx context.Context, owner store.Owner, filter store.LinkFilter) (store.LinkStats, error) {
+	filter.Tag = strings.TrimSpace(filter.Tag)
+	return s.storage.GetLinkStats(ctx, owner, filter)
+}
+
+// WarmCache загружает в кэш последние созданные ссылки.
+func (s *ShortenerService) WarmCache(ctx context.Context) error {
+	urls, err := s.storage.ListRecentUrls(ctx, cacheCapacity)
+	if err != nil {
+		return fmt.Errorf("failed to warm url cache: %w", err)
+	}
+	for alias, r := range urls {
+		s.cache.put(alias, r)
+	}
+	s.cache.warmed.Store(true)
+	slog.Info("url cache warmed", "count", len(urls))
+	return nil
+}
+
+// forget убирает ссылку из кэша (по всем её alias), когда она перестала вести туда, куда вела.
+func (s *ShortenerService) forget(linkID int64) {
+	s.cache.deleteLink(linkID)
+}
+
+// CacheReady возвращает ErrCacheNotWarmed, пока WarmCache не отработал успешно.
+// Сигнатура подходит для проверки готовности (readiness).
+func (s *ShortenerService) CacheReady(_ context.Context) error {
+	if !s.cache.warmed.Load() {
+		return ErrCacheNotWarmed
+	}
+	return nil
 }
 
 // generateUniqueAlias пытается сгенерировать alias длины length и сохранить в БД.
 // Если сгенерировался уже существующий alias, то функция попытается сгенерировать ещё один алиас и так же его сохранить.
 // это будет проделано maxAttempts раз
-func generateUniqueAlias(ctx context.Context, storage StoreUrl, length int, originalURL string) (string, error) {
+func generateUniqueAlias(ctx context.Context, storage StoreUrl, length int, owner store.Owner, originalURL string) (string, error) {
 	const maxAttempts = 5
-	slog.Info("Generating unique Alias")
+	log := logging.FromContext(ctx)
+	log.Info("Generating unique Alias")
 
 	for i := 0; i < maxAttempts; i++ {
 		alias := randomString(length)
 
 		// пробуем сохранить
-		_, err := storage.SaveUrl(ctx, alias, originalURL)
+		_, err := storage.SaveUrl(ctx, owner, alias, originalURL)
 		if err == nil {
 			return alias, nil
 		}
 		// если конфликт по уникальности — пробуем другой alias
 		if errors.Is(err, store.ErrShortURLExists) {
-			fmt.Println("сгенерировали не уникальный алиас")
+			log.Debug("сгенерировали не уникальный алиас", "alias", alias)
 			continue
 		}
-		fmt.Println("мы сюда не заходим...")
 		// любая другая ошибка — дальше не пытаемся
 		return "", err
 	}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token expired")
+)
+
+// signToken выпускает подписанный HMAC-SHA256 токен вида base64(payload).base64(подпись).
+// В payload лежат назначение токена (purpose), произвольные поля fields и время истечения.
+// purpose не даёт использовать токен одного вида (например, подтверждения почты) вместо другого.
+func signToken(secret []byte, purpose string, expires time.Time, fields ...string) string {
+	parts := append([]string{purpose, strconv.FormatInt(expires.Unix(), 10)}, fields...)
+	payload := []byte(strings.Join(parts, "\n"))
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(sign(secret, payload))
+}
+
+// verifyToken проверяет подпись, назначение и срок действия токена и возвращает его поля.
+func verifyToken(secret []byte, purpose, token string) ([]string, error) {
+	encPayload, encSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encPayload)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encSig)
+	if err != nil || !hmac.Equal(sig, sign(secret, payload)) {
+		return nil, ErrInvalidToken
+	}
+
+	parts := strings.Split(string(payload), "\n")
+	if len(parts) < 2 || parts[0] != purpose {
+		return nil, ErrInvalidToken
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() > expires {
+		return nil, ErrExpiredToken
+	}
+	return parts[2:], nil
+}
+
+// randomToken возвращает случайный токен из 32 байт в base64url.
+// Такие токены хранятся в БД только в виде hashToken.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken — SHA-256 в hex. Токены случайные и длинные, поэтому соль и bcrypt не нужны.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func sign(secret, payload []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/store"
+)
+
+const (
+	maxTagLength        = 50
+	maxTagsPerLink      = 20
+	maxFolderNameLength = 100
+	maxBulkTagLinks     = 500
+)
+
+var (
+	ErrInvalidTag        = errors.New("invalid tag")
+	ErrTooManyTags       = errors.New("too many tags on a link")
+	ErrInvalidFolderName = errors.New("invalid folder name")
+	ErrTooManyLinks      = errors.New("too many links in one request")
+)
+
+// linkTagsState и linkFolderState — то, что пишем о тегах и папке ссылки в журнал аудита.
+type linkTagsState struct {
+	Tags []string `json:"tags"`
+}
+
+type linkFolderState struct {
+	FolderID int64  `json:"folder_id,omitempty"`
+	Folder   string `json:"folder,omitempty"`
+}
+
+type folderState struct {
+	Name        string `json:"name"`
+	WorkspaceID int64  `json:"workspace_id,omitempty"`
+}
+
+// linkOwner — владелец ссылки: пространство или, для личной ссылки, её автор.
+func linkOwner(l store.Link) store.Owner {
+	return store.Owner{UserID: l.UserID, WorkspaceID: l.WorkspaceID}
+}
+
+// NormalizeTags убирает пробелы по краям, пустые теги и повторы без учёта регистра.
+// Тег — до maxTagLength символов без запятых (запятая разделяет теги в формах).
+func NormalizeTags(raw []string) ([]string, error) {
+	seen := make(map[string]bool, len(raw))
+	tags := make([]string, 0, len(raw))
+	for _, t := range raw {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if utf8.RuneCountInString(t) > maxTagLength || strings.ContainsRune(t, ',') {
+			return nil, ErrInvalidTag
+		}
+		key := strings.ToLower(t)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		tags = append(tags, t)
+	}
+	return tags, nil
+}
+
+// Tags возвращает теги владельца owner с числом ссылок.
+func (s *ShortenerService) Tags(ctx context.Context, owner store.Owner) ([]store.Tag, error) {
+	return s.storage.ListTags(ctx, owner)
+}
+
+// SetLinkTags заменяет теги ссылки alias.
+func (s *ShortenerService) SetLinkTags(ctx context.Context, userID int64, alias string, tags []string) (store.Link, error) {
+	link, err := s.editableLink(ctx, userID, alias)
+	if err != nil {
+		return store.Link{}, err
+	}
+	tags, err = NormalizeTags(tags)
+	if err != nil {
+		return store.Link{}, err
+	}
+	if len(tags) > maxTagsPerLink {
+		return store.Link{}, ErrTooManyTags
+	}
+	if err := s.storage.SetLinkTags(ctx, linkOwner(link), link.ID, tags); err != nil {
+		return store.Link{}, err
+	}
+	s.audit.Record(ctx, AuditEntry{Action: AuditLinkTags, TargetType: AuditTargetLink, TargetID: link.Alias,
+		Before: linkTagsState{Tags: link.Tags}, After: linkTagsState{Tags: tags}})
+	return s.storage.GetLink(ctx, link.Alias)
+}
+
+// BulkTagLinks добавляет теги add и снимает теги remove со ссылок aliases и возвращает число изменённых ссылок.
+// Если хоть одну ссылку менять нельзя, не меняется ни одна.
+func (s *ShortenerService) BulkTagLinks(ctx context.Context, userID int64, aliases, add, remove []string) (int, error) {
+	add, err := NormalizeTags(add)
+	if err != nil {
+		return 0, err
+	}
+	remove, err = NormalizeTags(remove)
+	if err != nil {
+		return 0, err
+	}
+	if len(aliases) > maxBulkTagLinks {
+		return 0, ErrTooManyLinks
+	}
+	if len(add) == 0 && len(remove) == 0 {
+		return 0, nil
+	}
+
+	byOwner := make(map[store.Owner][]store.Link)
+	seen := make(map[int64]bool, len(aliases))
+	for _, alias := range aliases {
+		link, err := s.editableLink(ctx, userID, alias)
+		if err != nil {
+			return 0, err
+		}
+		if seen[link.ID] {
+			continue
+		}
+		seen[link.ID] = true
+		if len(mergeTags(link.Tags, add, remove)) > maxTagsPerLink {
+			return 0, ErrTooManyTags
+		}
+		owner := linkOwner(link)
+		byOwner[owner] = append(byOwner[owner], link)
+	}
+
+	ids := make(map[store.Owner][]int64, len(byOwner))
+	for owner, links := range byOwner {
+		for _, l := range links {
+			ids[owner] = append(ids[owner], l.ID)
+		}
+	}
+	if err := s.storage.BulkTagLinks(ctx, ids, add, remove); err != nil {
+		return 0, err
+	}
+	for _, links := range byOwner {
+		for _, l := range links {
+			s.audit.Record(ctx, AuditEntry{Action: AuditLinkTags, TargetType: AuditTargetLink, TargetID: l.Alias,
+				Before: linkTagsState{Tags: l.Tags}, After: linkTagsState{Tags: mergeTags(l.Tags, add, remove)}})
+		}
+	}
+	logging.FromContext(ctx).Info("links tagged", "links", len(seen), "add", add, "remove", remove)
+	return len(seen), nil
+}
+
+// mergeTags возвращает теги ссылки после добавления add и снятия remove (сравнение без учёта регистра).
+func mergeTags(tags, add, remove []string) []string {
+	removed := make(map[string]bool, len(remove))
+	for _, t := range remove {
+		removed[strings.ToLower(t)] = true
+	}
+	seen := make(map[string]bool, len(tags)+len(add))
+	var out []string
+	for _, t := range append(append([]string(nil), tags...), add...) {
+		key := strings.ToLower(t)
+		if removed[key] || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, t)
+	}
+	return out
+}
+
+// Folders возвращает папки владельца owner с числом ссылок.
+func (s *ShortenerService) Folders(ctx context.Context, owner store.Owner) ([]store.Folder, error) {
+	return s.storage.ListFolders(ctx, owner)
+}
+
+// editableOwner возвращает владельца папок и тегов пространства workspaceID (0 — личные),
+// если userID может в нём менять ссылки.
+func (s *ShortenerService) editableOwner(ctx context.Context, userID, workspaceID int64) (store.Owner, error) {
+	owner := store.Owner{UserID: userID, WorkspaceID: workspaceID}
+	if workspaceID == 0 {
+		return owner, nil
+	}
+	member, err := s.storage.GetMembership(ctx, workspaceID, userID)
+	if err != nil {
+		return store.Owner{}, err
+	}
+	if !member.CanEdit() {
+		return store.Owner{}, ErrLinkForbidden
+	}
+	return owner, nil
+}
+
+// CreateFolder создаёт папку в пространстве workspaceID (0 — личную папку userID).
+func (s *ShortenerService) CreateFolder(ctx context.Context, userID, workspaceID int64, name string) (store.Folder, error) {
+	owner, err := s.editableOwner(ctx, userID, workspaceID)
+	if err != nil {
+		return store.Folder{}, err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxFolderNameLength {
+		return store.Folder{}, ErrInvalidFolderName
+	}
+	folder, err := s.storage.CreateFolder(ctx, owner, name)
+	if err != nil {
+		return store.Folder{}, err
+	}
+	s.audit.Record(ctx, AuditEntry{Action: AuditFolderCreate, TargetType: AuditTargetFolder, TargetID: auditID(folder.ID),
+		After: folderState{Name: name, WorkspaceID: workspaceID}})
+	return folder, nil
+}
+
+// DeleteFolder удаляет папку folderID из пространства workspaceID; ссылки из неё остаются вне папок.
+func (s *ShortenerService) DeleteFolder(ctx context.Context, userID, workspaceID, folderID int64) error {
+	owner, err := s.editableOwner(ctx, userID, workspaceID)
+	if err != nil {
+		return err
+	}
+	folder, err := s.storage.GetFolder(ctx, owner, folderID)
+	if err != nil {
+		return err
+	}
+	if err := s.storage.DeleteFolder(ctx, owner, folderID); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, AuditEntry{Action: AuditFolderDelete, TargetType: AuditTargetFolder, TargetID: auditID(folderID),
+		Before: folderState{Name: folder.Name, WorkspaceID: workspaceID}})
+	return nil
+}
+
+// MoveLink перекладывает ссылку alias в папку folderID её владельца (0 — вынуть из папки).
+func (s *ShortenerService) MoveLink(ctx context.Context, userID int64, alias string, folderID int64) (store.Link, error) {
+	link, err := s.editableLink(ctx, userID, alias)
+	if err != nil {
+		return store.Link{}, err
+	}
+	if folderID == link.FolderID {
+		return link, nil
+	}
+	var folder store.Folder
+	if folderID != 0 {
+		if folder, err = s.storage.GetFolder(ctx, linkOwner(link), folderID); err != nil {
+			return store.Link{}, err
+		}
+	}
+	if err := s.storage.SetLinkFolder(ctx, link.ID, folderID); err != nil {
+		return store.Link{}, err
+	}
+	s.audit.Record(ctx, AuditEntry{Action: AuditLinkMove, TargetType: AuditTargetLink, TargetID: link.Alias,
+		Before: linkFolderState{FolderID: link.FolderID, Folder: link.FolderName},
+		After:  linkFolderState{FolderID: folder.ID, Folder: folder.Name}})
+	link.FolderID, link.FolderName = folder.ID, folder.Name
+	return link, nil
+}
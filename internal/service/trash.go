@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/store"
+)
+
+// defaultTrashRetention — сколько удалённая ссылка лежит в корзине, если в конфиге не задано.
+const defaultTrashRetention = 30 * 24 * time.Hour
+
+var ErrTrashExpired = errors.New("link retention period in the trash has expired")
+
+// DeleteLink перемещает ссылку alias в корзину. Редирект по ней сразу начинает отвечать 410.
+func (s *ShortenerService) DeleteLink(ctx context.Context, userID int64, alias string) error {
+	link, err := s.editableLink(ctx, userID, alias)
+	if err != nil {
+		return err
+	}
+	if err := s.storage.DeleteLink(ctx, link.ID); err != nil {
+		return err
+	}
+	s.forget(link.ID)
+	logging.FromContext(ctx).Info("link deleted", "link_id", link.ID, "alias", link.Alias)
+	s.audit.Record(ctx, AuditEntry{Action: AuditLinkDelete, TargetType: AuditTargetLink, TargetID: link.Alias,
+		Before: linkState{URL: link.URL, WorkspaceID: link.WorkspaceID}})
+	return nil
+}
+
+// RestoreLink достаёт ссылку alias из корзины, пока не истёк срок хранения.
+func (s *ShortenerService) RestoreLink(ctx context.Context, userID int64, alias string) (store.Link, error) {
+	link, canEdit, err := s.accessibleLink(ctx, userID, alias)
+	if err != nil {
+		return store.Link{}, err
+	}
+	if !canEdit {
+		return store.Link{}, ErrLinkForbidden
+	}
+	if !link.Deleted() {
+		return link, nil
+	}
+	if !link.DeletedAt.After(s.trashCutoff()) {
+		return store.Link{}, ErrTrashExpired
+	}
+	if err := s.storage.UndeleteLink(ctx, link.ID, s.trashCutoff()); err != nil {
+		if errors.Is(err, store.ErrShortURLNotFound) {
+			return store.Link{}, ErrTrashExpired
+		}
+		return store.Link{}, err
+	}
+	s.forget(link.ID)
+	logging.FromContext(ctx).Info("link restored", "link_id", link.ID, "alias", link.Alias)
+	s.audit.Record(ctx, AuditEntry{Action: AuditLinkRestore, TargetType: AuditTargetLink, TargetID: link.Alias,
+		After: linkState{URL: link.URL, WorkspaceID: link.WorkspaceID}})
+	link.DeletedAt = time.Time{}
+	return link, nil
+}
+
+// Trash возвращает ссылки владельца owner из корзины, которые ещё можно восстановить.
+func (s *ShortenerService) Trash(ctx context.Context, owner store.Owner) ([]store.Link, error) {
+	return s.storage.ListDeletedLinks(ctx, owner, s.trashCutoff(), linkListLimit)
+}
+
+// PurgeAt — когда ссылку, удалённую в deletedAt, сотрут из корзины навсегда.
+func (s *ShortenerService) PurgeAt(deletedAt time.Time) time.Time {
+	return deletedAt.Add(s.trashRetention)
+}
+
+// PurgeTrash навсегда стирает ссылки, пролежавшие в корзине дольше срока хранения, и возвращает их число.
+// Их alias больше никому не выдаются. Вызывается периодически из main.
+func (s *ShortenerService) PurgeTrash(ctx context.Context) (int64, error) {
+	return s.storage.PurgeDeletedLinks(ctx, s.trashCutoff())
+}
+
+// trashCutoff — ссылки, удалённые раньше этого момента, восстановить уже нельзя.
+func (s *ShortenerService) trashCutoff() time.Time {
+	return s.now().Add(-s.trashRetention)
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/totp"
+)
+
+const (
+	totpIssuer        = "URL-Shortener"
+	totpSkew          = 1 // принимаем коды соседних шагов: ±30 секунд расхождения часов
+	recoveryCodeCount = 10
+	purposeLogin2FA   = "login-2fa"
+	loginChallengeTTL = 5 * time.Minute
+)
+
+var (
+	ErrInvalidTOTPCode = errors.New("invalid two-factor code")
+	ErrTOTPNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrTOTPNotStarted  = errors.New("two-factor enrollment was not started")
+)
+
+// TOTPEnrollment — данные для подключения приложения-аутентификатора.
+type TOTPEnrollment struct {
+	Secret string // base32, для ручного ввода
+	URI    string // otpauth://, кодируется в QR-код
+}
+
+// TwoFactorRequired сообщает, обязана ли 2FA для всех пользователей.
+func (us *UserService) TwoFactorRequired() bool {
+	return us.require2FA
+}
+
+// TwoFactorEnabled сообщает, включена ли у пользователя 2FA.
+func (us *UserService) TwoFactorEnabled(ctx context.Context, userID int64) (bool, error) {
+	t, err := us.storage.GetTOTP(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return t.Enabled(), nil
+}
+
+// BeginTOTPEnrollment выдаёт новый секрет. 2FA включится только после ConfirmTOTPEnrollment.
+func (us *UserService) BeginTOTPEnrollment(ctx context.Context, userID int64) (TOTPEnrollment, error) {
+	mailAddr, _, err := us.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return TOTPEnrollment{}, fmt.Errorf("failed to generate totp secret: %w", err)
+	}
+	encrypted, err := us.encryptSecret(secret)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	if err := us.storage.SetPendingTOTP(ctx, userID, encrypted); err != nil {
+		return TOTPEnrollment{}, err
+	}
+	return TOTPEnrollment{Secret: secret, URI: totp.ProvisioningURI(totpIssuer, mailAddr, secret)}, nil
+}
+
+// PendingTOTPEnrollment возвращает уже выданный, но не подтверждённый секрет
+// (чтобы показать тот же QR-код после неверно введённого кода).
+func (us *UserService) PendingTOTPEnrollment(ctx context.Context, userID int64) (TOTPEnrollment, error) {
+	mailAddr, _, err := us.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	t, err := us.storage.GetTOTP(ctx, userID)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	if t.Secret == "" || t.Enabled() {
+		return TOTPEnrollment{}, ErrTOTPNotStarted
+	}
+	secret, err := us.decryptSecret(t.Secret)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	return TOTPEnrollment{Secret: secret, URI: totp.ProvisioningURI(totpIssuer, mailAddr, secret)}, nil
+}
+
+// ConfirmTOTPEnrollment включает 2FA, если code подходит к выданному секрету,
+// и возвращает коды восстановления. Они показываются пользователю один раз, в БД хранятся только хеши.
+func (us *UserService) ConfirmTOTPEnrollment(ctx context.Context, userID int64, code string) ([]string, error) {
+	t, err := us.storage.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if t.Secret == "" || t.Enabled() {
+		return nil, ErrTOTPNotStarted
+	}
+	secret, err := us.decryptSecret(t.Secret)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := totp.Validate(secret, code, us.now(), totpSkew)
+	if !ok {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		c, err := randomRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		codes[i] = c
+		hashes[i] = hashToken(normalizeRecoveryCode(c))
+	}
+	if err := us.storage.EnableTOTP(ctx, userID, step, hashes); err != nil {
+		return nil, err
+	}
+	logging.FromContext(ctx).Info("two-factor authentication enabled", "user_id", userID)
+	return codes, nil
+}
+
+// DisableTOTP выключает 2FA. Нужен действующий код (или код восстановления).
+func (us *UserService) DisableTOTP(ctx context.Context, userID int64, code string) error {
+	if us.require2FA {
+		return errors.New("two-factor authentication is required for all users")
+	}
+	if err := us.VerifySecondFactor(ctx, userID, code); err != nil {
+		return err
+	}
+	if err := us.storage.DisableTOTP(ctx, userID); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("two-factor authentication disabled", "user_id", userID)
+	return nil
+}
+
+// VerifySecondFactor проверяет код из приложения или одноразовый код восстановления.
+// Один и тот же код из приложения дважды не принимается.
+func (us *UserService) VerifySecondFactor(ctx context.Context, userID int64, code string) error {
+	t, err := us.storage.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !t.Enabled() {
+		return ErrTOTPNotEnabled
+	}
+	secret, err := us.decryptSecret(t.Secret)
+	if err != nil {
+		return err
+	}
+
+	if step, ok := totp.Validate(secret, code, us.now(), totpSkew); ok && step > t.LastStep {
+		advanced, err := us.storage.AdvanceTOTPStep(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+		if advanced {
+			return nil
+		}
+	}
+
+	used, err := us.storage.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTOTPCode
+	}
+	left, err := us.storage.CountRecoveryCodes(ctx, userID)
+	if err == nil {
+		logging.FromContext(ctx).Warn("recovery code used", "user_id", userID, "codes_left", left)
+	}
+	return nil
+}
+
+// NewLoginChallenge выдаёт подписанный токен "пароль проверен, ждём второй фактор" для userID.
+// remember — отметил ли пользователь "запомнить меня", чтобы учесть это после второго шага.
+func (us *UserService) NewLoginChallenge(userID int64, remember bool) string {
+	return signToken(us.secret, purposeLogin2FA, us.now().Add(loginChallengeTTL), strconv.FormatInt(userID, 10), strconv.FormatBool(remember))
+}
+
+// ParseLoginChallenge проверяет токен из NewLoginChallenge и возвращает ID пользователя и флаг "запомнить меня".
+func (us *UserService) ParseLoginChallenge(token string) (int64, bool, error) {
+	fields, err := verifyToken(us.secret, purposeLogin2FA, token)
+	if err != nil {
+		return 0, false, err
+	}
+	if len(fields) != 2 {
+		return 0, false, ErrInvalidToken
+	}
+	userID, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, false, ErrInvalidToken
+	}
+	remember, err := strconv.ParseBool(fields[1])
+	if err != nil {
+		return 0, false, ErrInvalidToken
+	}
+	return userID, remember, nil
+}
+
+// randomRecoveryCode возвращает код вида "abcde-fghij" (50 бит случайности).
+func randomRecoveryCode() (string, error) {
+	const alphabet = "abcdefghijkmnpqrstuvwxyz23456789" // без похожих друг на друга l, o, 0, 1
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = alphabet[int(b[i])%len(alphabet)]
+	}
+	return string(b[:5]) + "-" + string(b[5:]), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// encryptSecret шифрует секрет TOTP (AES-GCM), чтобы дамп БД не давал возможности генерировать коды.
+func (us *UserService) encryptSecret(secret string) (string, error) {
+	gcm, err := us.totpCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func (us *UserService) decryptSecret(encrypted string) (string, error) {
+	gcm, err := us.totpCipher()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.RawStdEncoding.DecodeString(encrypted)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", errors.New("malformed totp secret")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt totp secret: %w", err)
+	}
+	return string(plain), nil
+}
+
+func (us *UserService) totpCipher() (cipher.AEAD, error) {
+	key := sha256.Sum256(append([]byte("totp-secret:"), us.secret...))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+const defaultMaxURLLength = 2048
+
+// resolveTimeout — сколько ждём ответа DNS при проверке одного имени.
+const resolveTimeout = 2 * time.Second
+
+var (
+	ErrURLTooLong          = fmt.Errorf("%w: url is too long", ErrInvalidLinkURL)
+	ErrURLSchemeNotAllowed = fmt.Errorf("%w: url scheme is not allowed", ErrInvalidLinkURL)
+	ErrURLPrivateHost      = fmt.Errorf("%w: url points to a private or loopback address", ErrInvalidLinkURL)
+	ErrURLHostNotResolved  = fmt.Errorf("%w: url host does not resolve", ErrInvalidLinkURL)
+	ErrURLHostCheckFailed  = fmt.Errorf("%w: could not check url host, try again later", ErrInvalidLinkURL)
+)
+
+// URLPolicy — правила проверки и нормализации адресов назначения. Нулевое значение: только http и https,
+// до 2048 символов, частные адреса запрещены, имена хостов не резолвятся. Конфиг по умолчанию включает
+// ещё и ResolveHosts (см. config.URLPolicy); импорт всегда проверяет без DNS.
+type URLPolicy struct {
+	AllowedSchemes    []string // пусто — http и https
+	MaxLength         int      // 0 — defaultMaxURLLength
+	StripTracking     bool     // убирать utm_* и идентификаторы кликов рекламных сетей
+	TrackingParams    []string // дополнительные параметры, которые считаются трекинговыми
+	AllowPrivateHosts bool     // разрешить localhost и частные сети (например, для локальной разработки)
+	ResolveHosts      bool     // проверять ещё и адреса, в которые резолвится имя хоста (без этого «10.0.0.1.nip.io» пройдёт)
+}
+
+var defaultSchemes = []string{"http", "https"}
+
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// trackingParams — параметры, которые только помечают источник перехода и не меняют страницу.
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "dclid": true, "gbraid": true, "wbraid": true, "msclkid": true,
+	"yclid": true, "ysclid": true, "igshid": true, "twclid": true, "ttclid": true,
+	"mc_cid": true, "mc_eid": true, "_openstat": true,
+}
+
+// localSuffixes — зоны, которые резолвятся только внутри локальной сети.
+var localSuffixes = []string{".localhost", ".local", ".internal", ".lan", ".home.arpa"}
+
+// nonPublicPrefixes — диапазоны, которых не покрывают методы netip.Addr: CGNAT, «эта сеть», бенчмарки.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("255.255.255.255/32"),
+}
+
+// Префиксы IPv6, в которые встроен адрес IPv4: NAT64 (последние 32 бита) и 6to4 (биты 16–48).
+var (
+	nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+	sixToFour   = netip.MustParsePrefix("2002::/16")
+)
+
+// Normalize проверяет адрес назначения и приводит его к каноническому виду: схема и хост в нижнем
+// регистре, IDN в punycode, без порта по умолчанию и (если включено) без трекинговых параметров.
+// Ошибки оборачивают ErrInvalidLinkURL.
+func (p URLPolicy) Normalize(ctx context.Context, raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if len(raw) > p.maxLength() {
+		return "", ErrURLTooLong
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" {
+		return "", ErrInvalidLinkURL
+	}
+	if !p.schemeAllowed(u.Scheme) {
+		return "", ErrURLSchemeNotAllowed
+	}
+	// «https://bank.com@evil.com» показывает одно, а ведёт на другое, поэтому userinfo не принимаем
+	if u.Opaque != "" || u.Host == "" || u.User != nil {
+		return "", ErrInvalidLinkURL
+	}
+
+	host, addr, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return "", ErrInvalidLinkURL
+	}
+	port := u.Port()
+	if port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", ErrInvalidLinkURL
+		}
+		if port == defaultPorts[u.Scheme] {
+			port = ""
+		}
+	}
+	if !p.AllowPrivateHosts {
+		if err := p.checkPublicHost(ctx, host, addr); err != nil {
+			return "", err
+		}
+	}
+
+	if addr.Is6() {
+		host = "[" + host + "]"
+	}
+	u.Host = host
+	if port != "" {
+		u.Host += ":" + port
+	}
+	if p.StripTracking && u.RawQuery != "" {
+		u.RawQuery = p.stripTracking(u.RawQuery)
+		u.ForceQuery = false
+	}
+
+	normalized := u.String()
+	if len(normalized) > p.maxLength() {
+		return "", ErrURLTooLong
+	}
+	return normalized, nil
+}
+
+func (p URLPolicy) maxLength() int {
+	if p.MaxLength > 0 {
+		return p.MaxLength
+	}
+	return defaultMaxURLLength
+}
+
+func (p URLPolicy) schemeAllowed(scheme string) bool {
+	allowed := p.AllowedSchemes
+	if len(allowed) == 0 {
+		allowed = defaultSchemes
+	}
+	for _, s := range allowed {
+		if strings.EqualFold(s, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeHost возвращает хост в нижнем регистре без точки в конце: IP-адрес — в канонической записи
+// (и сам адрес), имя — в punycode. Числовые записи вроде «2130706433» или «0x7f.1», которые браузер
+// понял бы как IPv4, не принимаются.
+func normalizeHost(host string) (string, netip.Addr, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if addr.Zone() != "" {
+			return "", netip.Addr{}, ErrInvalidLinkURL
+		}
+		return addr.String(), addr, nil
+	}
+	labels := strings.Split(host, ".")
+	if last := labels[len(labels)-1]; isNumericLabel(last) {
+		return "", netip.Addr{}, ErrInvalidLinkURL
+	}
+	name, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", netip.Addr{}, err
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return "", netip.Addr{}, ErrInvalidLinkURL
+		}
+	}
+	return name, netip.Addr{}, nil
+}
+
+// isNumericLabel — метка из цифр или шестнадцатеричное число «0x…»: так браузеры распознают IPv4.
+func isNumericLabel(label string) bool {
+	if label == "" {
+		return false
+	}
+	if strings.HasPrefix(label, "0x") {
+		return true
+	}
+	for _, c := range label {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPublicHost отклоняет loopback, частные и служебные адреса, localhost, локальные зоны и имена
+// из одной метки. Если включено ResolveHosts, то же проверяется для всех адресов имени: имени нет
+// в DNS — ErrURLHostNotResolved, DNS не ответил за resolveTimeout или вернул ошибку — ErrURLHostCheckFailed.
+func (p URLPolicy) checkPublicHost(ctx context.Context, host string, addr netip.Addr) error {
+	if addr.IsValid() {
+		if !isPublicAddr(addr) {
+			return ErrURLPrivateHost
+		}
+		return nil
+	}
+	if host == "localhost" || !strings.Contains(host, ".") {
+		return ErrURLPrivateHost
+	}
+	for _, suffix := range localSuffixes {
+		if strings.HasSuffix(host, suffix) {
+			return ErrURLPrivateHost
+		}
+	}
+	if !p.ResolveHosts {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	var dnsErr *net.DNSError
+	if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+		return ErrURLHostCheckFailed
+	}
+	if err != nil || len(addrs) == 0 {
+		return ErrURLHostNotResolved
+	}
+	for _, a := range addrs {
+		if !isPublicAddr(a) {
+			return ErrURLPrivateHost
+		}
+	}
+	return nil
+}
+
+// isPublicAddr сообщает, что адрес публичный. У адресов NAT64 и 6to4 проверяется встроенный IPv4:
+// через шлюз «64:ff9b::7f00:1» ведёт на 127.0.0.1.
+func isPublicAddr(addr netip.Addr) bool {
+	addr = embeddedIPv4(addr.Unmap())
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() || addr.IsMulticast() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// embeddedIPv4 возвращает IPv4, встроенный в адрес NAT64 или 6to4, а остальные адреса — как есть.
+func embeddedIPv4(addr netip.Addr) netip.Addr {
+	b := addr.As16()
+	switch {
+	case nat64Prefix.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[12:16]))
+	case sixToFour.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[2:6]))
+	}
+	return addr
+}
+
+// stripTracking убирает из query трекинговые параметры, сохраняя порядок и запись остальных.
+func (p URLPolicy) stripTracking(rawQuery string) string {
+	parts := strings.Split(rawQuery, "&")
+	kept := parts[:0]
+	for _, part := range parts {
+		key, _, _ := strings.Cut(part, "=")
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if !p.isTrackingParam(strings.ToLower(key)) {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+func (p URLPolicy) isTrackingParam(key string) bool {
+	if strings.HasPrefix(key, "utm_") || trackingParams[key] {
+		return true
+	}
+	for _, extra := range p.TrackingParams {
+		if strings.EqualFold(extra, key) {
+			return true
+		}
+	}
+	return false
+}
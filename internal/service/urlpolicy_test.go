@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestURLPolicyNormalize(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy URLPolicy
+		raw    string
+		want   string
+		err    error
+	}{
+		{name: "обычный адрес", raw: "https://example.com/path?q=1", want: "https://example.com/path?q=1"},
+		{name: "регистр и порт по умолчанию", raw: "  HTTPS://Example.COM:443/Path ", want: "https://example.com/Path"},
+		{name: "нестандартный порт", raw: "http://example.com:8080/", want: "http://example.com:8080/"},
+		{name: "точка в конце имени", raw: "http://example.com./", want: "http://example.com/"},
+		{name: "IDN", raw: "https://münchen.de/", want: "https://xn--mnchen-3ya.de/"},
+		{name: "IDN в верхнем регистре", raw: "https://MÜNCHEN.de/", want: "https://xn--mnchen-3ya.de/"},
+		{name: "IDNA2008 без переходной обработки", raw: "https://faß.de/", want: "https://xn--fa-hia.de/"},
+		{name: "некорректный punycode", raw: "https://xn--a.com/", err: ErrInvalidLinkURL},
+		{name: "символы, недопустимые в имени", raw: "https://exa mple.com/", err: ErrInvalidLinkURL},
+		{name: "javascript", raw: "javascript:alert(1)", err: ErrURLSchemeNotAllowed},
+		{name: "data", raw: "data:text/html,hi", err: ErrURLSchemeNotAllowed},
+		{name: "ftp", raw: "ftp://example.com/", err: ErrURLSchemeNotAllowed},
+		{name: "ftp разрешён политикой", policy: URLPolicy{AllowedSchemes: []string{"ftp"}}, raw: "ftp://example.com/f", want: "ftp://example.com/f"},
+		{name: "без схемы", raw: "example.com/path", err: ErrInvalidLinkURL},
+		{name: "userinfo", raw: "https://bank.com@evil.com/", err: ErrInvalidLinkURL},
+		{name: "слишком длинный", policy: URLPolicy{MaxLength: 20}, raw: "https://example.com/long", err: ErrURLTooLong},
+		{name: "неверный порт", raw: "http://example.com:70000/", err: ErrInvalidLinkURL},
+		{name: "localhost", raw: "http://localhost/", err: ErrURLPrivateHost},
+		{name: "имя без точки", raw: "http://intranet/", err: ErrURLPrivateHost},
+		{name: "локальная зона", raw: "http://printer.local/", err: ErrURLPrivateHost},
+		{name: "loopback", raw: "http://127.0.0.1/", err: ErrURLPrivateHost},
+		{name: "частная сеть", raw: "http://10.1.2.3/", err: ErrURLPrivateHost},
+		{name: "CGNAT", raw: "http://100.64.0.1/", err: ErrURLPrivateHost},
+		{name: "метаданные облака", raw: "http://169.254.169.254/", err: ErrURLPrivateHost},
+		{name: "IPv4 одним числом", raw: "http://2130706433/", err: ErrInvalidLinkURL},
+		{name: "IPv4 в шестнадцатеричной записи", raw: "http://0x7f.1/", err: ErrInvalidLinkURL},
+		{name: "IPv6 loopback", raw: "http://[::1]/", err: ErrURLPrivateHost},
+		{name: "IPv4-mapped", raw: "http://[::ffff:127.0.0.1]/", err: ErrURLPrivateHost},
+		{name: "NAT64 на loopback", raw: "http://[64:ff9b::7f00:1]/", err: ErrURLPrivateHost},
+		{name: "NAT64 на частную сеть", raw: "http://[64:ff9b::10.0.0.1]/", err: ErrURLPrivateHost},
+		{name: "6to4 на частную сеть", raw: "http://[2002:c0a8:101::1]/", err: ErrURLPrivateHost},
+		{name: "NAT64 на публичный адрес", raw: "http://[64:ff9b::808:808]/", want: "http://[64:ff9b::808:808]/"},
+		{name: "публичный IPv6", raw: "http://[2001:4860:4860::8888]:443/", want: "http://[2001:4860:4860::8888]:443/"},
+		{name: "частные адреса разрешены", policy: URLPolicy{AllowPrivateHosts: true}, raw: "http://localhost:8080/", want: "http://localhost:8080/"},
+		{name: "трекинг", policy: URLPolicy{StripTracking: true}, raw: "https://example.com/?utm_source=x&id=1&fbclid=y", want: "https://example.com/?id=1"},
+		{name: "только трекинг", policy: URLPolicy{StripTracking: true}, raw: "https://example.com/?utm_medium=x", want: "https://example.com/"},
+		{name: "свои трекинговые параметры", policy: URLPolicy{StripTracking: true, TrackingParams: []string{"ref"}}, raw: "https://example.com/?REF=a&b=2", want: "https://example.com/?b=2"},
+		{name: "трекинг оставлен", raw: "https://example.com/?utm_source=x", want: "https://example.com/?utm_source=x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.Normalize(context.Background(), tt.raw)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Normalize(%q): ошибка %v, ожидалась %v", tt.raw, err, tt.err)
+				}
+				if !errors.Is(err, ErrInvalidLinkURL) {
+					t.Errorf("Normalize(%q): ошибка %v не оборачивает ErrInvalidLinkURL", tt.raw, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Normalize(%q): неожиданная ошибка %v", tt.raw, err)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q) = %q, ожидалось %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"127.0.0.1", false},
+		{"192.168.1.1", false},
+		{"0.1.2.3", false},
+		{"198.18.0.1", false},
+		{"255.255.255.255", false},
+		{"2001:4860:4860::8888", true},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::7f00:1", false},
+		{"64:ff9b::a9fe:a9fe", false},
+		{"64:ff9b::808:808", true},
+		{"2002:7f00:1::", false},
+		{"2002:a00:1::1", false},
+		{"2002:808:808::1", true},
+	}
+	for _, tt := range tests {
+		if got := isPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("isPublicAddr(%s) = %v, ожидалось %v", tt.addr, got, tt.want)
+		}
+	}
+}
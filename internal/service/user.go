@@ -2,47 +2,194 @@ package service
 
 import (
 	"context"
+	"strings"
+	"time"
+	"url-shorter/internal/mail"
+	"url-shorter/internal/store"
 )
 
 // UserStorage определяет контракт для хранилища пользователей.
 type UserStorage interface {
-	SaveUser(ctx context.Context, mail, hash string) error
+	SaveUser(ctx context.Context, mail, hash string) (int64, error)
 	GetUserByEmail(ctx context.Context, mail string) (int64, string, error)
-	CreateSession(ctx context.Context, userID int64) (string, error)
+	GetUserByID(ctx context.Context, id int64) (string, string, error)
+	GetUser(ctx context.Context, id int64) (store.User, error)
+	SetUserRole(ctx context.Context, mail, role string) error
+	UpdatePassword(ctx context.Context, id int64, hash string) error
+	MarkEmailVerified(ctx context.Context, id int64) error
+	IsEmailVerified(ctx context.Context, id int64) (bool, error)
+	CreateSession(ctx context.Context, s store.Session) (string, error)
 	DeleteSession(ctx context.Context, token string) error
-	GetUserIDBySessionToken(ctx context.Context, token string) (int64, error)
+	GetSession(ctx context.Context, token string) (store.Session, error)
+	TouchSession(ctx context.Context, id int64, expiry time.Time) error
+	ListSessions(ctx context.Context, userID int64) ([]store.Session, error)
+	DeleteUserSession(ctx context.Context, userID, id int64) error
+	DeleteOtherSessions(ctx context.Context, userID, keepID int64) (int64, error)
+	DeleteExpiredSessions(ctx context.Context) (int64, error)
+
+	GetLoginThrottle(ctx context.Context, scope, key string) (store.LoginThrottle, error)
+	RecordLoginFailure(ctx context.Context, scope, key string, window time.Duration) (store.LoginThrottle, error)
+	LockLogin(ctx context.Context, scope, key string, until time.Time, notifyWindow time.Duration) (bool, error)
+	ResetLoginThrottle(ctx context.Context, scope, key string) error
+	SaveLoginEvent(ctx context.Context, e store.LoginEvent) error
+
+	SavePasswordReset(ctx context.Context, userID int64, tokenHash string, expires time.Time) error
+	GetPasswordResetUser(ctx context.Context, tokenHash string) (int64, error)
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int64, error)
+
+	GetTOTP(ctx context.Context, userID int64) (store.TOTP, error)
+	SetPendingTOTP(ctx context.Context, userID int64, secret string) error
+	EnableTOTP(ctx context.Context, userID, step int64, recoveryHashes []string) error
+	DisableTOTP(ctx context.Context, userID int64) error
+	AdvanceTOTPStep(ctx context.Context, userID, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userID int64) (int, error)
+
+	SaveAPIToken(ctx context.Context, t store.APIToken, tokenHash string) (int64, error)
+	ListAPITokens(ctx context.Context, userID int64) ([]store.APIToken, error)
+	DeleteAPIToken(ctx context.Context, userID, id int64) error
+	UseAPIToken(ctx context.Context, tokenHash string) (store.APIToken, error)
+
+	GetUserIDByOIDCIdentity(ctx context.Context, issuer, subject string) (int64, error)
+	LinkOIDCIdentity(ctx context.Context, userID int64, issuer, subject string) (bool, error)
+	CreateOIDCUser(ctx context.Context, mail, issuer, subject string) (int64, error)
 }
 
+// UserOptions — необязательные настройки UserService. Нулевые поля заменяются значениями по умолчанию.
+type UserOptions struct {
+	Lockout  LockoutPolicy
+	Password PasswordPolicy
+	Sessions SessionPolicy
+	Notifier Notifier
+	Mailer   mail.Mailer
+	// Secret — ключ для подписи токенов в письмах (подтверждение email и т.п.)
+	Secret          []byte
+	VerificationTTL time.Duration
+	ResetTTL        time.Duration // время жизни ссылки сброса пароля
+	Require2FA      bool          // 2FA обязательна для всех пользователей
+	OIDCSignup      bool          // создавать пользователя при первом входе через OIDC
+	Audit           *AuditLog     // журнал аудита; nil — не писать
+}
+
+const (
+	defaultVerificationTTL = 48 * time.Hour
+	defaultResetTTL        = time.Hour
+)
+
 // UserService реализует бизнес-логику для пользователей.
 type UserService struct {
-	storage UserStorage
+	storage         UserStorage
+	lockout         LockoutPolicy
+	passwords       PasswordPolicy
+	sessions        SessionPolicy
+	notifier        Notifier
+	mailer          mail.Mailer
+	secret          []byte
+	verificationTTL time.Duration
+	resetTTL        time.Duration
+	require2FA      bool
+	oidcSignup      bool
+	audit           *AuditLog
+	now             func() time.Time
+}
+
+func NewUserService(s UserStorage, opts UserOptions) *UserService {
+	us := &UserService{
+		storage:         s,
+		lockout:         opts.Lockout,
+		passwords:       opts.Password,
+		sessions:        opts.Sessions,
+		notifier:        opts.Notifier,
+		mailer:          opts.Mailer,
+		secret:          opts.Secret,
+		verificationTTL: opts.VerificationTTL,
+		resetTTL:        opts.ResetTTL,
+		require2FA:      opts.Require2FA,
+		oidcSignup:      opts.OIDCSignup,
+		audit:           opts.Audit,
+		now:             time.Now,
+	}
+	if us.lockout == (LockoutPolicy{}) {
+		us.lockout = DefaultLockoutPolicy
+	}
+	if us.passwords == (PasswordPolicy{}) {
+		us.passwords = DefaultPasswordPolicy
+	}
+	if us.sessions == (SessionPolicy{}) {
+		us.sessions = DefaultSessionPolicy
+	}
+	if us.mailer == nil {
+		us.mailer = mail.LogMailer{}
+	}
+	if us.notifier == nil {
+		us.notifier = MailNotifier{Mailer: us.mailer}
+	}
+	if us.verificationTTL == 0 {
+		us.verificationTTL = defaultVerificationTTL
+	}
+	if us.resetTTL == 0 {
+		us.resetTTL = defaultResetTTL
+	}
+	return us
 }
 
-func NewUserService(s UserStorage) *UserService {
-	return &UserService{storage: s}
+// NormalizeEmail приводит email к виду, в котором он хранится и по которому ищется: без пробелов
+// по краям и в нижнем регистре. Все методы сервиса, принимающие email, нормализуют его сами,
+// иначе «User@Example.com» и «user@example.com» стали бы разными аккаунтами и разными счётчиками
+// неудачных входов.
+func NormalizeEmail(mail string) string {
+	return strings.ToLower(strings.TrimSpace(mail))
 }
 
-// RegisterUser регистрирует нового пользователя.
-func (us *UserService) RegisterUser(ctx context.Context, mail, hash string) error {
-	return us.storage.SaveUser(ctx, mail, hash)
+// RegisterUser регистрирует нового пользователя с неподтверждённым email и возвращает его ID.
+func (us *UserService) RegisterUser(ctx context.Context, mail, hash string) (int64, error) {
+	mail = NormalizeEmail(mail)
+	id, err := us.storage.SaveUser(ctx, mail, hash)
+	if err != nil {
+		return 0, err
+	}
+	us.audit.Record(ctx, AuditEntry{Action: AuditUserRegister, ActorID: id, TargetType: AuditTargetUser, TargetID: auditID(id),
+		After: map[string]string{"mail": mail}})
+	return id, nil
 }
 
 // GetUserByEmail находит пользователя по email.
 func (us *UserService) GetUserByEmail(ctx context.Context, mail string) (int64, string, error) {
-	return us.storage.GetUserByEmail(ctx, mail)
+	return us.storage.GetUserByEmail(ctx, NormalizeEmail(mail))
+}
+
+// GetUser возвращает учётную запись пользователя с ролью и статусом.
+func (us *UserService) GetUser(ctx context.Context, id int64) (store.User, error) {
+	return us.storage.GetUser(ctx, id)
+}
+
+// GrantAdmin выдаёт роль администратора пользователю с email mail.
+func (us *UserService) GrantAdmin(ctx context.Context, mail string) error {
+	return us.storage.SetUserRole(ctx, NormalizeEmail(mail), store.RoleAdmin)
 }
 
-// CreateSession создает сессию для пользователя.
-func (us *UserService) CreateSession(ctx context.Context, userID int64) (string, error) {
-	return us.storage.CreateSession(ctx, userID)
+// ValidatePassword проверяет пароль по настроенной политике.
+// Возвращает *PasswordPolicyError со списком нарушений.
+func (us *UserService) ValidatePassword(mail, password string) error {
+	return us.passwords.ValidatePassword(mail, password)
+}
+
+// GetUserByID возвращает email и хеш пароля пользователя.
+func (us *UserService) GetUserByID(ctx context.Context, id int64) (string, string, error) {
+	return us.storage.GetUserByID(ctx, id)
+}
+
+// UpdatePassword сохраняет новый хеш пароля, завершает все сессии пользователя и отзывает его API-токены.
+// Пароль должен быть заранее проверен ValidatePassword.
+func (us *UserService) UpdatePassword(ctx context.Context, id int64, hash string) error {
+	if err := us.storage.UpdatePassword(ctx, id, hash); err != nil {
+		return err
+	}
+	us.audit.Record(ctx, AuditEntry{Action: AuditUserPasswordChange, TargetType: AuditTargetUser, TargetID: auditID(id)})
+	return nil
 }
 
 // DeleteSession удаляет сессию.
 func (us *UserService) DeleteSession(ctx context.Context, token string) error {
 	return us.storage.DeleteSession(ctx, token)
 }
-
-// GetUserIDBySessionToken получает ID пользователя по токену сессии.
-func (us *UserService) GetUserIDBySessionToken(ctx context.Context, token string) (int64, error) {
-	return us.storage.GetUserIDBySessionToken(ctx, token)
-}
\ No newline at end of file
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/mail"
+)
+
+const purposeVerifyEmail = "verify-email"
+
+var ErrEmailNotVerified = errors.New("email is not verified")
+
+// SendVerificationEmail отправляет на mail ссылку подтверждения.
+// verifyURL — абсолютный адрес страницы подтверждения, токен добавляется параметром token.
+func (us *UserService) SendVerificationEmail(ctx context.Context, userID int64, mailAddr, verifyURL string) error {
+	token := signToken(us.secret, purposeVerifyEmail, us.now().Add(us.verificationTTL),
+		strconv.FormatInt(userID, 10), mailAddr)
+	link := verifyURL + "?token=" + url.QueryEscape(token)
+
+	msg := mail.Message{
+		To:      mailAddr,
+		Subject: "Подтвердите email в URL-Shortener",
+		Body: fmt.Sprintf("Здравствуйте!\n\nЧтобы подтвердить адрес и начать создавать короткие ссылки, перейдите по ссылке:\n%s\n\n"+
+			"Ссылка действует %s. Если вы не регистрировались, просто проигнорируйте это письмо.\n", link, us.verificationTTL),
+	}
+	if err := us.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send verification email: %w", err)
+	}
+	logging.FromContext(ctx).Info("verification email sent", "user_id", userID)
+	return nil
+}
+
+// VerifyEmail проверяет токен из письма и помечает email пользователя подтверждённым.
+// Возвращает ID пользователя. Повторный переход по той же ссылке ошибкой не считается.
+func (us *UserService) VerifyEmail(ctx context.Context, token string) (int64, error) {
+	fields, err := verifyToken(us.secret, purposeVerifyEmail, token)
+	if err != nil {
+		return 0, err
+	}
+	if len(fields) != 2 {
+		return 0, ErrInvalidToken
+	}
+	userID, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+
+	// если email с тех пор сменился, ссылка подтверждала уже не тот адрес
+	mailAddr, _, err := us.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if mailAddr != fields[1] {
+		return 0, ErrInvalidToken
+	}
+
+	if err := us.storage.MarkEmailVerified(ctx, userID); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// IsEmailVerified сообщает, подтвердил ли пользователь email.
+func (us *UserService) IsEmailVerified(ctx context.Context, userID int64) (bool, error) {
+	return us.storage.IsEmailVerified(ctx, userID)
+}
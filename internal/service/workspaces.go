@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	netmail "net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"url-shorter/internal/logging"
+	"url-shorter/internal/mail"
+	"url-shorter/internal/store"
+)
+
+const (
+	defaultInviteTTL       = 7 * 24 * time.Hour
+	maxWorkspaceNameLength = 100
+)
+
+var (
+	ErrWorkspaceForbidden   = errors.New("not enough rights in the workspace")
+	ErrInvalidWorkspaceName = errors.New("invalid workspace name")
+	ErrInvalidWorkspaceRole = errors.New("invalid workspace role")
+	ErrLastWorkspaceOwner   = errors.New("workspace must keep at least one owner")
+	ErrInviteWrongUser      = errors.New("invitation was sent to another email")
+	ErrInvalidInviteEmail   = errors.New("invalid invitation email")
+)
+
+// WorkspaceStorage определяет контракт хранилища рабочих пространств.
+type WorkspaceStorage interface {
+	CreateWorkspace(ctx context.Context, name string, ownerID int64) (int64, error)
+	GetMembership(ctx context.Context, workspaceID, userID int64) (store.Membership, error)
+	ListWorkspaces(ctx context.Context, userID int64) ([]store.Membership, error)
+	ListMembers(ctx context.Context, workspaceID int64) ([]store.Member, error)
+	SetMemberRole(ctx context.Context, workspaceID, userID int64, role string) error
+	RemoveMember(ctx context.Context, workspaceID, userID int64) error
+	SaveWorkspaceInvite(ctx context.Context, inv store.WorkspaceInvite, tokenHash string) (int64, error)
+	GetWorkspaceInvite(ctx context.Context, tokenHash string) (store.WorkspaceInvite, error)
+	AcceptWorkspaceInvite(ctx context.Context, tokenHash string, userID int64, mail string) (store.WorkspaceInvite, error)
+	ListWorkspaceInvites(ctx context.Context, workspaceID int64) ([]store.WorkspaceInvite, error)
+	DeleteWorkspaceInvite(ctx context.Context, workspaceID, id int64) (string, error)
+	SetSessionWorkspace(ctx context.Context, sessionID, workspaceID int64) error
+	GetUserByID(ctx context.Context, id int64) (string, string, error)
+}
+
+// Invite — приглашение в рабочее пространство, найденное по токену из письма.
+type Invite struct {
+	WorkspaceID int64
+	Name        string
+	Mail        string
+	Role        string
+}
+
+// WorkspaceService — рабочие пространства команд: участники, роли и приглашения.
+// Приглашение — одноразовый случайный токен в письме; в БД хранится только его хеш,
+// поэтому приглашение можно отозвать, а принятое повторно не сработает.
+type WorkspaceService struct {
+	storage   WorkspaceStorage
+	mailer    mail.Mailer
+	inviteTTL time.Duration
+	audit     *AuditLog
+	now       func() time.Time
+}
+
+func NewWorkspaceService(s WorkspaceStorage, mailer mail.Mailer, audit *AuditLog) *WorkspaceService {
+	if mailer == nil {
+		mailer = mail.LogMailer{}
+	}
+	return &WorkspaceService{storage: s, mailer: mailer, inviteTTL: defaultInviteTTL, audit: audit, now: time.Now}
+}
+
+// Create создаёт пространство, владельцем становится userID.
+func (ws *WorkspaceService) Create(ctx context.Context, userID int64, name string) (int64, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxWorkspaceNameLength {
+		return 0, ErrInvalidWorkspaceName
+	}
+	id, err := ws.storage.CreateWorkspace(ctx, name, userID)
+	if err != nil {
+		return 0, err
+	}
+	logging.FromContext(ctx).Info("workspace created", "workspace_id", id)
+	ws.audit.Record(ctx, AuditEntry{Action: AuditWorkspaceCreate, TargetType: AuditTargetWorkspace, TargetID: auditID(id),
+		After: map[string]string{"name": name}})
+	return id, nil
+}
+
+// Membership возвращает участие пользователя в пространстве. workspaceID = 0 — личные ссылки, туда можно всегда.
+func (ws *WorkspaceService) Membership(ctx context.Context, workspaceID, userID int64) (store.Membership, error) {
+	if workspaceID == 0 {
+		return store.Membership{}, nil
+	}
+	return ws.storage.GetMembership(ctx, workspaceID, userID)
+}
+
+// List возвращает пространства пользователя.
+func (ws *WorkspaceService) List(ctx context.Context, userID int64) ([]store.Membership, error) {
+	return ws.storage.ListWorkspaces(ctx, userID)
+}
+
+// Members возвращает участников пространства; смотреть их может любой участник.
+func (ws *WorkspaceService) Members(ctx context.Context, workspaceID, userID int64) ([]store.Member, error) {
+	if _, err := ws.storage.GetMembership(ctx, workspaceID, userID); err != nil {
+		return nil, err
+	}
+	return ws.storage.ListMembers(ctx, workspaceID)
+}
+
+// Switch выбирает пространство для сессии браузера; 0 — вернуться к личным ссылкам.
+func (ws *WorkspaceService) Switch(ctx context.Context, sessionID, userID, workspaceID int64) error {
+	if _, err := ws.Membership(ctx, workspaceID, userID); err != nil {
+		return err
+	}
+	return ws.storage.SetSessionWorkspace(ctx, sessionID, workspaceID)
+}
+
+// Invite отправляет на mailAddr приглашение в пространство с ролью role.
+// Приглашать может только владелец. joinURL — абсолютный адрес страницы принятия приглашения.
+func (ws *WorkspaceService) Invite(ctx context.Context, actorID, workspaceID int64, mailAddr, role, joinURL string) error {
+	actor, err := ws.storage.GetMembership(ctx, workspaceID, actorID)
+	if err != nil {
+		return err
+	}
+	if !actor.CanManage() {
+		return ErrWorkspaceForbidden
+	}
+	if !validWorkspaceRole(role) {
+		return ErrInvalidWorkspaceRole
+	}
+	mailAddr = NormalizeEmail(mailAddr)
+	if addr, err := netmail.ParseAddress(mailAddr); err != nil || addr.Address != mailAddr {
+		return ErrInvalidInviteEmail
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	inviteID, err := ws.storage.SaveWorkspaceInvite(ctx, store.WorkspaceInvite{
+		WorkspaceID: workspaceID,
+		Mail:        mailAddr,
+		Role:        role,
+		InvitedBy:   actorID,
+		ExpiresAt:   ws.now().Add(ws.inviteTTL),
+	}, hashToken(token))
+	if err != nil {
+		return err
+	}
+	link := joinURL + "?token=" + url.QueryEscape(token)
+
+	msg := mail.Message{
+		To:      mailAddr,
+		Subject: "Приглашение в пространство «" + actor.Name + "» в URL-Shortener",
+		Body: fmt.Sprintf("Здравствуйте!\n\nВас пригласили в рабочее пространство «%s» с ролью %s. Чтобы присоединиться, "+
+			"войдите или зарегистрируйтесь с этим адресом и перейдите по ссылке:\n%s\n\n"+
+			"Ссылка одноразовая и действует %s. Если вы не ждали приглашения, просто проигнорируйте это письмо.\n", actor.Name, role, link, ws.inviteTTL),
+	}
+	if err := ws.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send workspace invite: %w", err)
+	}
+	logging.FromContext(ctx).Info("workspace invite sent", "workspace_id", workspaceID, "invite_id", inviteID, "role", role)
+	ws.audit.Record(ctx, AuditEntry{Action: AuditWorkspaceInvite, TargetType: AuditTargetWorkspace, TargetID: auditID(workspaceID),
+		After: map[string]string{"mail": mailAddr, "role": role, "invite_id": strconv.FormatInt(inviteID, 10)}})
+	return nil
+}
+
+// ParseInvite находит действующее приглашение по токену и возвращает, куда и с какой ролью зовут.
+func (ws *WorkspaceService) ParseInvite(ctx context.Context, token string) (Invite, error) {
+	if token == "" {
+		return Invite{}, store.ErrInviteNotFound
+	}
+	inv, err := ws.storage.GetWorkspaceInvite(ctx, hashToken(token))
+	if err != nil {
+		return Invite{}, err
+	}
+	return Invite{WorkspaceID: inv.WorkspaceID, Name: inv.WorkspaceName, Mail: inv.Mail, Role: inv.Role}, nil
+}
+
+// AcceptInvite добавляет userID в пространство из приглашения и возвращает ID пространства.
+// Принять приглашение может только владелец адреса, на который оно отправлено, и только один раз.
+// Если пользователь уже участник, его роль не меняется.
+func (ws *WorkspaceService) AcceptInvite(ctx context.Context, userID int64, token string) (int64, error) {
+	invite, err := ws.ParseInvite(ctx, token)
+	if err != nil {
+		return 0, err
+	}
+	mailAddr, _, err := ws.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	mailAddr = NormalizeEmail(mailAddr)
+	if mailAddr != invite.Mail {
+		return 0, ErrInviteWrongUser
+	}
+	// приглашение гасится вместе с добавлением участника: параллельное второе принятие получит ErrInviteNotFound
+	accepted, err := ws.storage.AcceptWorkspaceInvite(ctx, hashToken(token), userID, mailAddr)
+	if err != nil {
+		return 0, err
+	}
+	logging.FromContext(ctx).Info("workspace invite accepted", "workspace_id", accepted.WorkspaceID, "invite_id", accepted.ID, "role", accepted.Role)
+	ws.audit.Record(ctx, AuditEntry{Action: AuditWorkspaceJoin, TargetType: AuditTargetWorkspace, TargetID: auditID(accepted.WorkspaceID),
+		After: map[string]string{"role": accepted.Role, "invite_id": strconv.FormatInt(accepted.ID, 10)}})
+	return accepted.WorkspaceID, nil
+}
+
+// Invites возвращает неиспользованные приглашения пространства; смотреть их может только владелец.
+func (ws *WorkspaceService) Invites(ctx context.Context, actorID, workspaceID int64) ([]store.WorkspaceInvite, error) {
+	if err := ws.checkManage(ctx, actorID, workspaceID); err != nil {
+		return nil, err
+	}
+	return ws.storage.ListWorkspaceInvites(ctx, workspaceID)
+}
+
+// RevokeInvite отзывает неиспользованное приглашение: ссылка из письма перестаёт работать. Доступно владельцу.
+func (ws *WorkspaceService) RevokeInvite(ctx context.Context, actorID, workspaceID, inviteID int64) error {
+	if err := ws.checkManage(ctx, actorID, workspaceID); err != nil {
+		return err
+	}
+	mailAddr, err := ws.storage.DeleteWorkspaceInvite(ctx, workspaceID, inviteID)
+	if err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("workspace invite revoked", "workspace_id", workspaceID, "invite_id", inviteID)
+	ws.audit.Record(ctx, AuditEntry{Action: AuditWorkspaceInviteRevoke, TargetType: AuditTargetWorkspace, TargetID: auditID(workspaceID),
+		Before: map[string]string{"mail": mailAddr, "invite_id": strconv.FormatInt(inviteID, 10)}})
+	return nil
+}
+
+// SetRole меняет роль участника. Доступно владельцу; последнего владельца понизить нельзя.
+func (ws *WorkspaceService) SetRole(ctx context.Context, actorID, workspaceID, userID int64, role string) error {
+	if !validWorkspaceRole(role) {
+		return ErrInvalidWorkspaceRole
+	}
+	if err := ws.checkManage(ctx, actorID, workspaceID); err != nil {
+		return err
+	}
+	member, err := ws.storage.GetMembership(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if role != store.WorkspaceOwner {
+		if err := ws.checkNotLastOwner(ctx, workspaceID, userID); err != nil {
+			return err
+		}
+	}
+	if err := ws.storage.SetMemberRole(ctx, workspaceID, userID, role); err != nil {
+		return err
+	}
+	ws.audit.Record(ctx, AuditEntry{Action: AuditWorkspaceMemberRole, TargetType: AuditTargetWorkspace, TargetID: auditID(workspaceID),
+		Before: memberState{UserID: userID, Role: member.Role}, After: memberState{UserID: userID, Role: role}})
+	return nil
+}
+
+// RemoveMember исключает участника. Владелец может исключить любого, остальные — только выйти сами.
+func (ws *WorkspaceService) RemoveMember(ctx context.Context, actorID, workspaceID, userID int64) error {
+	if actorID != userID {
+		if err := ws.checkManage(ctx, actorID, workspaceID); err != nil {
+			return err
+		}
+	}
+	member, err := ws.storage.GetMembership(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if err := ws.checkNotLastOwner(ctx, workspaceID, userID); err != nil {
+		return err
+	}
+	if err := ws.storage.RemoveMember(ctx, workspaceID, userID); err != nil {
+		return err
+	}
+	ws.audit.Record(ctx, AuditEntry{Action: AuditWorkspaceMemberRemove, TargetType: AuditTargetWorkspace, TargetID: auditID(workspaceID),
+		Before: memberState{UserID: userID, Role: member.Role}})
+	return nil
+}
+
+// memberState — то, что пишем об участнике в журнал аудита.
+type memberState struct {
+	UserID int64  `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+func (ws *WorkspaceService) checkManage(ctx context.Context, actorID, workspaceID int64) error {
+	actor, err := ws.storage.GetMembership(ctx, workspaceID, actorID)
+	if err != nil {
+		return err
+	}
+	if !actor.CanManage() {
+		return ErrWorkspaceForbidden
+	}
+	return nil
+}
+
+// checkNotLastOwner не даёт оставить пространство без владельца.
+func (ws *WorkspaceService) checkNotLastOwner(ctx context.Context, workspaceID, userID int64) error {
+	members, err := ws.storage.ListMembers(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	owners, targetIsOwner := 0, false
+	for _, m := range members {
+		if m.Role == store.WorkspaceOwner {
+			owners++
+			targetIsOwner = targetIsOwner || m.UserID == userID
+		}
+	}
+	if targetIsOwner && owners == 1 {
+		return ErrLastWorkspaceOwner
+	}
+	return nil
+}
+
+func validWorkspaceRole(role string) bool {
+	switch role {
+	case store.WorkspaceOwner, store.WorkspaceEditor, store.WorkspaceViewer:
+		return true
+	}
+	return false
+}
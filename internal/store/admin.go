@@ -0,0 +1,270 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Роли пользователей.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var ErrShortURLTakenDown = errors.New("short URL was taken down")
+
+// User — учётная запись в том виде, в каком её видит администратор.
+type User struct {
+	ID         int64
+	Mail       string
+	Role       string
+	CreatedAt  time.Time
+	VerifiedAt time.Time // нулевое время — email не подтверждён
+	DisabledAt time.Time // нулевое время — аккаунт активен
+}
+
+func (u User) IsAdmin() bool  { return u.Role == RoleAdmin }
+func (u User) Disabled() bool { return !u.DisabledAt.IsZero() }
+
+// Link — короткая ссылка вместе с автором и статусом модерации.
+type Link struct {
+	ID             int64
+	Alias          string
+	URL            string
+	Title          string
+	Notes          string
+	UserID         int64  // 0 — автор неизвестен (ссылка создана до появления авторов)
+	OwnerMail      string // пусто, если автор неизвестен
+	WorkspaceID    int64  // 0 — личная ссылка автора
+	CreatedAt      time.Time
+	UpdatedAt      time.Time // нулевое время — ссылку не меняли
+	TakenDownAt    time.Time // нулевое время — ссылка работает
+	TakedownReason string
+	DeletedAt      time.Time // нулевое время — ссылка не в корзине
+	FolderID       int64     // 0 — ссылка вне папок
+	FolderName     string
+	Tags           []string  // по алфавиту
+	ExpiresAt      time.Time // нулевое время — бессрочная
+	Clicks         int64
+}
+
+func (l Link) TakenDown() bool { return !l.TakenDownAt.IsZero() }
+func (l Link) Deleted() bool   { return !l.DeletedAt.IsZero() }
+
+// Expired сообщает, истёк ли срок действия ссылки.
+func (l Link) Expired() bool { return !l.ExpiresAt.IsZero() && !l.ExpiresAt.After(time.Now()) }
+
+// Stats — сводка по всей системе для админки.
+type Stats struct {
+	Users          int64
+	VerifiedUsers  int64
+	DisabledUsers  int64
+	Admins         int64
+	Links          int64
+	LinksLastDay   int64
+	TakenDownLinks int64
+	ActiveSessions int64
+}
+
+const userColumns = `id, mail, role, created_at, COALESCE(verified_at, 'epoch'), COALESCE(disabled_at, 'epoch')`
+
+func scanUser(row pgx.Row) (User, error) {
+	var u User
+	if err := row.Scan(&u.ID, &u.Mail, &u.Role, &u.CreatedAt, &u.VerifiedAt, &u.DisabledAt); err != nil {
+		return User{}, err
+	}
+	u.VerifiedAt = zeroIfEpoch(u.VerifiedAt)
+	u.DisabledAt = zeroIfEpoch(u.DisabledAt)
+	return u, nil
+}
+
+// GetUser возвращает учётную запись пользователя.
+func (db *DbManager) GetUser(ctx context.Context, id int64) (User, error) {
+	u, err := scanUser(db.conn.QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, ErrUserNotFound
+		}
+		return User{}, fmt.Errorf("error while getting user: %w", err)
+	}
+	return u, nil
+}
+
+// SearchUsers ищет пользователей по части email. Пустой запрос — последние зарегистрированные.
+func (db *DbManager) SearchUsers(ctx context.Context, query string, limit int) ([]User, error) {
+	q := `SELECT ` + userColumns + ` FROM users
+        WHERE mail ILIKE '%' || $1 || '%'
+        ORDER BY created_at DESC
+        LIMIT $2`
+	rows, err := db.conn.Query(ctx, q, escapeLike(query), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error while searching users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning user: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while searching users: %w", err)
+	}
+	return users, nil
+}
+
+// SetUserDisabled блокирует или разблокирует аккаунт. При блокировке завершаются все сессии пользователя.
+func (db *DbManager) SetUserDisabled(ctx context.Context, id int64, disabled bool) error {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE users SET disabled_at = NULL WHERE id = $1`
+	if disabled {
+		query = `UPDATE users SET disabled_at = COALESCE(disabled_at, NOW()) WHERE id = $1`
+	}
+	tag, err := tx.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("error while updating user status: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	if disabled {
+		if _, err := tx.Exec(ctx, `DELETE FROM sessions WHERE user_id = $1`, id); err != nil {
+			return fmt.Errorf("error while deleting sessions: %w", err)
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// SetUserRole назначает роль пользователю с email mail.
+func (db *DbManager) SetUserRole(ctx context.Context, mail, role string) error {
+	tag, err := db.conn.Exec(ctx, `UPDATE users SET role = $2 WHERE mail = $1`, mail, role)
+	if err != nil {
+		return fmt.Errorf("error while setting user role: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+const linkColumns = `urls.id, urls.short_code, urls.original_url, urls.title, urls.notes, COALESCE(urls.user_id, 0), COALESCE(users.mail, ''),
+        urls.created_at, COALESCE(urls.updated_at, 'epoch'), COALESCE(urls.taken_down_at, 'epoch'), urls.takedown_reason, COALESCE(urls.workspace_id, 0),
+        COALESCE(urls.deleted_at, 'epoch'), COALESCE(urls.folder_id, 0),
+        COALESCE((SELECT f.name FROM folders f WHERE f.id = urls.folder_id), ''),
+        ARRAY(SELECT t.name FROM link_tags lt JOIN tags t ON t.id = lt.tag_id WHERE lt.url_id = urls.id ORDER BY lower(t.name)),
+        COALESCE(urls.expires_at, 'epoch'), urls.clicks`
+
+func scanLink(row pgx.Row) (Link, error) {
+	var l Link
+	if err := row.Scan(&l.ID, &l.Alias, &l.URL, &l.Title, &l.Notes, &l.UserID, &l.OwnerMail,
+		&l.CreatedAt, &l.UpdatedAt, &l.TakenDownAt, &l.TakedownReason, &l.WorkspaceID, &l.DeletedAt,
+		&l.FolderID, &l.FolderName, &l.Tags, &l.ExpiresAt, &l.Clicks); err != nil {
+		return Link{}, err
+	}
+	l.UpdatedAt = zeroIfEpoch(l.UpdatedAt)
+	l.DeletedAt = zeroIfEpoch(l.DeletedAt)
+	l.TakenDownAt = zeroIfEpoch(l.TakenDownAt)
+	l.ExpiresAt = zeroIfEpoch(l.ExpiresAt)
+	return l, nil
+}
+
+// SearchLinks ищет ссылки по точному alias, части исходного URL или email автора.
+// Пустой запрос — последние созданные.
+func (db *DbManager) SearchLinks(ctx context.Context, query string, limit int) ([]Link, error) {
+	q := `SELECT ` + linkColumns + `
+        FROM urls LEFT JOIN users ON users.id = urls.user_id
+        WHERE urls.short_code = $1
+           OR urls.original_url ILIKE '%' || $2 || '%'
+           OR users.mail ILIKE '%' || $2 || '%'
+        ORDER BY urls.created_at DESC
+        LIMIT $3`
+	rows, err := db.conn.Query(ctx, q, query, escapeLike(query), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error while searching links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []Link
+	for rows.Next() {
+		l, err := scanLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning link: %w", err)
+		}
+		links = append(links, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while searching links: %w", err)
+	}
+	return links, nil
+}
+
+// TakeDownLink снимает ссылку с причиной reason и возвращает её alias.
+func (db *DbManager) TakeDownLink(ctx context.Context, id int64, reason string) (string, error) {
+	const query = `
+        UPDATE urls SET taken_down_at = COALESCE(taken_down_at, NOW()), takedown_reason = $2
+        WHERE id = $1
+        RETURNING short_code
+    `
+	return db.updateLinkStatus(ctx, query, id, reason)
+}
+
+// RestoreLink возвращает снятую ссылку и возвращает её alias.
+func (db *DbManager) RestoreLink(ctx context.Context, id int64) (string, error) {
+	const query = `
+        UPDATE urls SET taken_down_at = NULL, takedown_reason = ''
+        WHERE id = $1
+        RETURNING short_code
+    `
+	return db.updateLinkStatus(ctx, query, id)
+}
+
+func (db *DbManager) updateLinkStatus(ctx context.Context, query string, args ...any) (string, error) {
+	var alias string
+	if err := db.conn.QueryRow(ctx, query, args...).Scan(&alias); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrShortURLNotFound
+		}
+		return "", fmt.Errorf("error while updating link status: %w", err)
+	}
+	return alias, nil
+}
+
+// GetStats считает сводку по пользователям, ссылкам и сессиям.
+func (db *DbManager) GetStats(ctx context.Context) (Stats, error) {
+	const query = `
+        SELECT
+            (SELECT COUNT(*) FROM users),
+            (SELECT COUNT(*) FROM users WHERE verified_at IS NOT NULL),
+            (SELECT COUNT(*) FROM users WHERE disabled_at IS NOT NULL),
+            (SELECT COUNT(*) FROM users WHERE role = 'admin'),
+            (SELECT COUNT(*) FROM urls),
+            (SELECT COUNT(*) FROM urls WHERE created_at > NOW() - INTERVAL '1 day'),
+            (SELECT COUNT(*) FROM urls WHERE taken_down_at IS NOT NULL),
+            (SELECT COUNT(*) FROM sessions WHERE expiry > NOW())
+    `
+	var s Stats
+	err := db.conn.QueryRow(ctx, query).Scan(&s.Users, &s.VerifiedUsers, &s.DisabledUsers, &s.Admins,
+		&s.Links, &s.LinksLastDay, &s.TakenDownLinks, &s.ActiveSessions)
+	if err != nil {
+		return Stats{}, fmt.Errorf("error while getting stats: %w", err)
+	}
+	return s, nil
+}
+
+// escapeLike экранирует спецсимволы LIKE, чтобы поиск шёл по буквальной подстроке.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrAPITokenNotFound = errors.New("api token not found or expired")
+
+// Области действия API-токенов.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// APIToken — персональный токен для программного доступа. Сам токен не хранится, только его хеш.
+type APIToken struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	Scope      string
+	ExpiresAt  time.Time // нулевое время — бессрочный
+	LastUsedAt time.Time // нулевое время — ещё не использовался
+	CreatedAt  time.Time
+}
+
+// SaveAPIToken сохраняет новый токен и возвращает его ID.
+func (db *DbManager) SaveAPIToken(ctx context.Context, t APIToken, tokenHash string) (int64, error) {
+	const query = `
+        INSERT INTO api_tokens (user_id, name, token_hash, scope, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, NOW())
+        RETURNING id
+    `
+	var id int64
+	var expires *time.Time // nil — бессрочный токен, в БД попадёт NULL
+	if !t.ExpiresAt.IsZero() {
+		expires = &t.ExpiresAt
+	}
+	if err := db.conn.QueryRow(ctx, query, t.UserID, t.Name, tokenHash, t.Scope, expires).Scan(&id); err != nil {
+		return 0, fmt.Errorf("error while saving api token: %w", err)
+	}
+	return id, nil
+}
+
+// ListAPITokens возвращает токены пользователя, новые сверху.
+func (db *DbManager) ListAPITokens(ctx context.Context, userID int64) ([]APIToken, error) {
+	const query = `
+        SELECT id, user_id, name, scope,
+               COALESCE(expires_at, 'epoch'), COALESCE(last_used_at, 'epoch'), created_at
+        FROM api_tokens
+        WHERE user_id = $1
+        ORDER BY created_at DESC
+    `
+	rows, err := db.conn.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing api tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var t APIToken
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Scope, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error while scanning api token: %w", err)
+		}
+		t.ExpiresAt = zeroIfEpoch(t.ExpiresAt)
+		t.LastUsedAt = zeroIfEpoch(t.LastUsedAt)
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while listing api tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// DeleteAPIToken отзывает токен. Удалить можно только свой токен.
+func (db *DbManager) DeleteAPIToken(ctx context.Context, userID, id int64) error {
+	const query = `DELETE FROM api_tokens WHERE id = $1 AND user_id = $2`
+	cmd, err := db.conn.Exec(ctx, query, id, userID)
+	if err != nil {
+		return fmt.Errorf("error while deleting api token: %w", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
+
+// lastUsedPrecision — как часто обновляется last_used_at. Точнее для списка токенов не нужно,
+// а скрипт, который шлёт много запросов, иначе писал бы в одну и ту же строку на каждый запрос.
+const lastUsedPrecision = time.Minute
+
+// UseAPIToken находит действующий токен по хешу и отмечает время использования
+// (не чаще раза в lastUsedPrecision).
+func (db *DbManager) UseAPIToken(ctx context.Context, tokenHash string) (APIToken, error) {
+	const query = `
+        WITH t AS (
+            SELECT id, user_id, name, scope, last_used_at
+            FROM api_tokens
+            WHERE token_hash = $1 AND (expires_at IS NULL OR expires_at > NOW())
+              AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = api_tokens.user_id AND users.disabled_at IS NOT NULL)
+        ), touched AS (
+            UPDATE api_tokens SET last_used_at = NOW()
+            FROM t
+            WHERE api_tokens.id = t.id
+              AND (t.last_used_at IS NULL OR t.last_used_at < NOW() - make_interval(secs => $2))
+        )
+        SELECT id, user_id, name, scope FROM t
+    `
+	var t APIToken
+	if err := db.conn.QueryRow(ctx, query, tokenHash, lastUsedPrecision.Seconds()).Scan(&t.ID, &t.UserID, &t.Name, &t.Scope); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return APIToken{}, ErrAPITokenNotFound
+		}
+		return APIToken{}, fmt.Errorf("error while using api token: %w", err)
+	}
+	return t, nil
+}
+
+// zeroIfEpoch переводит 'epoch', которым в запросах заменяется NULL, обратно в нулевое время Go.
+func zeroIfEpoch(t time.Time) time.Time {
+	if t.Equal(time.Unix(0, 0)) {
+		return time.Time{}
+	}
+	return t
+}
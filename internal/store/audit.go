@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuditEvent — запись журнала аудита.
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ActorID    int64           `json:"actor_id,omitempty"` // 0 — не вошедший пользователь или система
+	ActorMail  string          `json:"actor_mail,omitempty"`
+	IP         string          `json:"ip,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type,omitempty"`
+	TargetID   string          `json:"target_id,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"` // состояние до изменения, JSON
+	After      json.RawMessage `json:"after,omitempty"`  // состояние после изменения, JSON
+}
+
+// AuditFilter — условия выборки из журнала; пустые поля не ограничивают выборку.
+type AuditFilter struct {
+	ActorID    int64
+	Action     string // точное действие или префикс с точкой на конце, например "admin."
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+}
+
+// SaveAuditEvent добавляет запись в журнал. Менять и удалять записи нельзя — это запрещено на уровне БД.
+func (db *DbManager) SaveAuditEvent(ctx context.Context, e AuditEvent) error {
+	const query = `
+        INSERT INTO audit_log (actor_id, ip, request_id, action, target_type, target_id, before, after)
+        VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6, $7, $8)
+    `
+	_, err := db.conn.Exec(ctx, query, e.ActorID, e.IP, e.RequestID, e.Action, e.TargetType, e.TargetID,
+		nullJSON(e.Before), nullJSON(e.After))
+	if err != nil {
+		return fmt.Errorf("error while saving audit event: %w", err)
+	}
+	return nil
+}
+
+// ListAuditEvents возвращает записи журнала по фильтру, новые сверху.
+func (db *DbManager) ListAuditEvents(ctx context.Context, f AuditFilter) ([]AuditEvent, error) {
+	var where []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where = append(where, strings.ReplaceAll(cond, "?", "$"+strconv.Itoa(len(args))))
+	}
+	if f.ActorID != 0 {
+		add("a.actor_id = ?", f.ActorID)
+	}
+	if strings.HasSuffix(f.Action, ".") {
+		add("a.action LIKE ? || '%'", escapeLike(f.Action))
+	} else if f.Action != "" {
+		add("a.action = ?", f.Action)
+	}
+	if f.TargetType != "" {
+		add("a.target_type = ?", f.TargetType)
+	}
+	if f.TargetID != "" {
+		add("a.target_id = ?", f.TargetID)
+	}
+	if !f.Since.IsZero() {
+		add("a.created_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		add("a.created_at < ?", f.Until)
+	}
+
+	query := `SELECT a.id, a.created_at, COALESCE(a.actor_id, 0), COALESCE(u.mail, ''), a.ip, a.request_id,
+            a.action, a.target_type, a.target_id, a.before, a.after
+        FROM audit_log a LEFT JOIN users u ON u.id = a.actor_id`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	args = append(args, f.Limit)
+	query += ` ORDER BY a.id DESC LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := db.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []AuditEvent
+	for rows.Next() {
+		var e AuditEvent
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.ActorID, &e.ActorMail, &e.IP, &e.RequestID,
+			&e.Action, &e.TargetType, &e.TargetID, &e.Before, &e.After); err != nil {
+			return nil, fmt.Errorf("error while scanning audit event: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while listing audit events: %w", err)
+	}
+	return events, nil
+}
+
+// nullJSON превращает пустое значение в NULL, чтобы не писать в JSONB пустую строку.
+func nullJSON(v json.RawMessage) any {
+	if len(v) == 0 {
+		return nil
+	}
+	return string(v)
+}
@@ -0,0 +1,337 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrStorageNotEmpty — восстанавливать резервную копию можно только в пустое хранилище.
+var ErrStorageNotEmpty = errors.New("storage is not empty")
+
+// Snapshot — содержимое хранилища для резервной копии. ID сохраняются как в исходной БД.
+// Сессии, токены, история правок и журнал аудита в снимок не входят; 2FA входит только вместе с хешами паролей.
+type Snapshot struct {
+	Users          []SnapshotUser
+	Workspaces     []SnapshotWorkspace
+	Members        []SnapshotMember
+	Folders        []SnapshotFolder
+	Links          []SnapshotLink
+	RetiredAliases []RetiredAlias
+}
+
+type SnapshotUser struct {
+	ID           int64
+	Mail         string
+	PasswordHash string // пустой, если хеши не выгружались: такой пароль не подходит, нужен сброс
+	Role         string
+	CreatedAt    time.Time
+	VerifiedAt   time.Time // нулевое время — email не подтверждён
+	DisabledAt   time.Time
+
+	// 2FA выгружается вместе с хешами паролей, иначе по паролю из копии можно было бы войти в обход неё.
+	// Секрет зашифрован ключом сервера: после восстановления коды примет только сервер с тем же auth.secret.
+	TOTPSecret    string // пустой — 2FA не включена
+	TOTPEnabledAt time.Time
+	TOTPLastStep  int64
+	RecoveryCodes []string // хеши неиспользованных кодов восстановления
+
+	OIDCIdentities []SnapshotOIDCIdentity
+}
+
+// SnapshotOIDCIdentity — учётная запись провайдера OIDC, привязанная к пользователю.
+type SnapshotOIDCIdentity struct {
+	Issuer    string
+	Subject   string
+	CreatedAt time.Time
+}
+
+type SnapshotWorkspace struct {
+	ID        int64
+	Name      string
+	CreatedAt time.Time
+}
+
+type SnapshotMember struct {
+	WorkspaceID int64
+	UserID      int64
+	Role        string
+	CreatedAt   time.Time
+}
+
+// SnapshotFolder — папка; задан ровно один из UserID и WorkspaceID.
+type SnapshotFolder struct {
+	ID          int64
+	UserID      int64
+	WorkspaceID int64
+	Name        string
+	CreatedAt   time.Time
+}
+
+// SnapshotLink — ссылка вместе с тегами. Нулевые ID и время означают NULL.
+type SnapshotLink struct {
+	ID             int64
+	Alias          string
+	URL            string
+	Title          string
+	Notes          string
+	UserID         int64
+	WorkspaceID    int64
+	FolderID       int64
+	Tags           []string
+	Clicks         int64
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	ExpiresAt      time.Time
+	DeletedAt      time.Time
+	TakenDownAt    time.Time
+	TakedownReason string
+}
+
+type RetiredAlias struct {
+	Alias     string
+	LinkID    int64 // ссылка, на которую ведёт прежний alias; 0 — ссылку стёрли
+	RetiredAt time.Time
+}
+
+// ExportSnapshot читает всё содержимое хранилища в одной транзакции, чтобы снимок был согласованным.
+// Хеши паролей выгружаются, только если withPasswords.
+func (db *DbManager) ExportSnapshot(ctx context.Context, withPasswords bool) (Snapshot, error) {
+	tx, err := db.conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var s Snapshot
+	// 2FA берём только подтверждённую: секрет, который ещё не подтвердили первым кодом, не нужен
+	err = queryAll(ctx, tx, `
+        SELECT id, mail, CASE WHEN $1 THEN password ELSE '' END, role, created_at,
+               COALESCE(verified_at, 'epoch'), COALESCE(disabled_at, 'epoch'),
+               CASE WHEN $1 AND totp_enabled_at IS NOT NULL THEN totp_secret ELSE '' END,
+               CASE WHEN $1 THEN COALESCE(totp_enabled_at, 'epoch') ELSE 'epoch' END,
+               CASE WHEN $1 AND totp_enabled_at IS NOT NULL THEN totp_last_step ELSE 0 END,
+               CASE WHEN $1 AND totp_enabled_at IS NOT NULL THEN COALESCE((SELECT array_agg(code_hash ORDER BY id)
+                   FROM recovery_codes WHERE user_id = users.id AND used_at IS NULL), '{}') ELSE '{}' END
+        FROM users ORDER BY id`, []any{withPasswords}, func(rows pgx.Rows) error {
+		var u SnapshotUser
+		if err := rows.Scan(&u.ID, &u.Mail, &u.PasswordHash, &u.Role, &u.CreatedAt, &u.VerifiedAt, &u.DisabledAt,
+			&u.TOTPSecret, &u.TOTPEnabledAt, &u.TOTPLastStep, &u.RecoveryCodes); err != nil {
+			return err
+		}
+		u.VerifiedAt, u.DisabledAt = zeroIfEpoch(u.VerifiedAt), zeroIfEpoch(u.DisabledAt)
+		u.TOTPEnabledAt = zeroIfEpoch(u.TOTPEnabledAt)
+		if len(u.RecoveryCodes) == 0 {
+			u.RecoveryCodes = nil
+		}
+		s.Users = append(s.Users, u)
+		return nil
+	})
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("error while exporting users: %w", err)
+	}
+
+	userIndex := make(map[int64]int, len(s.Users))
+	for i, u := range s.Users {
+		userIndex[u.ID] = i
+	}
+	err = queryAll(ctx, tx, `SELECT user_id, issuer, subject, created_at FROM oidc_identities ORDER BY user_id, id`, nil, func(rows pgx.Rows) error {
+		var userID int64
+		var o SnapshotOIDCIdentity
+		if err := rows.Scan(&userID, &o.Issuer, &o.Subject, &o.CreatedAt); err != nil {
+			return err
+		}
+		u := &s.Users[userIndex[userID]]
+		u.OIDCIdentities = append(u.OIDCIdentities, o)
+		return nil
+	})
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("error while exporting oidc identities: %w", err)
+	}
+
+	err = queryAll(ctx, tx, `SELECT id, name, created_at FROM workspaces ORDER BY id`, nil, func(rows pgx.Rows) error {
+		var w SnapshotWorkspace
+		if err := rows.Scan(&w.ID, &w.Name, &w.CreatedAt); err != nil {
+			return err
+		}
+		s.Workspaces = append(s.Workspaces, w)
+		return nil
+	})
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("error while exporting workspaces: %w", err)
+	}
+
+	err = queryAll(ctx, tx, `
+        SELECT workspace_id, user_id, role, created_at
+        FROM workspace_members ORDER BY workspace_id, user_id`, nil, func(rows pgx.Rows) error {
+		var m SnapshotMember
+		if err := rows.Scan(&m.WorkspaceID, &m.UserID, &m.Role, &m.CreatedAt); err != nil {
+			return err
+		}
+		s.Members = append(s.Members, m)
+		return nil
+	})
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("error while exporting workspace members: %w", err)
+	}
+
+	err = queryAll(ctx, tx, `
+        SELECT id, COALESCE(user_id, 0), COALESCE(workspace_id, 0), name, created_at
+        FROM folders ORDER BY id`, nil, func(rows pgx.Rows) error {
+		var f SnapshotFolder
+		if err := rows.Scan(&f.ID, &f.UserID, &f.WorkspaceID, &f.Name, &f.CreatedAt); err != nil {
+			return err
+		}
+		s.Folders = append(s.Folders, f)
+		return nil
+	})
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("error while exporting folders: %w", err)
+	}
+
+	err = queryAll(ctx, tx, `
+        SELECT urls.id, urls.short_code, urls.original_url, urls.title, urls.notes,
+               COALESCE(urls.user_id, 0), COALESCE(urls.workspace_id, 0), COALESCE(urls.folder_id, 0),
+               COALESCE((SELECT array_agg(tags.name ORDER BY lower(tags.name))
+                         FROM link_tags lt JOIN tags ON tags.id = lt.tag_id WHERE lt.url_id = urls.id), '{}'),
+               urls.clicks, urls.created_at,
+               COALESCE(urls.updated_at, 'epoch'), COALESCE(urls.expires_at, 'epoch'),
+               COALESCE(urls.deleted_at, 'epoch'), COALESCE(urls.taken_down_at, 'epoch'), urls.takedown_reason
+        FROM urls ORDER BY urls.id`, nil, func(rows pgx.Rows) error {
+		var l SnapshotLink
+		if err := rows.Scan(&l.ID, &l.Alias, &l.URL, &l.Title, &l.Notes, &l.UserID, &l.WorkspaceID, &l.FolderID,
+			&l.Tags, &l.Clicks, &l.CreatedAt, &l.UpdatedAt, &l.ExpiresAt, &l.DeletedAt, &l.TakenDownAt, &l.TakedownReason); err != nil {
+			return err
+		}
+		l.UpdatedAt, l.ExpiresAt = zeroIfEpoch(l.UpdatedAt), zeroIfEpoch(l.ExpiresAt)
+		l.DeletedAt, l.TakenDownAt = zeroIfEpoch(l.DeletedAt), zeroIfEpoch(l.TakenDownAt)
+		s.Links = append(s.Links, l)
+		return nil
+	})
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("error while exporting links: %w", err)
+	}
+
+	err = queryAll(ctx, tx, `SELECT short_code, COALESCE(url_id, 0), retired_at FROM retired_aliases ORDER BY short_code`, nil, func(rows pgx.Rows) error {
+		var r RetiredAlias
+		if err := rows.Scan(&r.Alias, &r.LinkID, &r.RetiredAt); err != nil {
+			return err
+		}
+		s.RetiredAliases = append(s.RetiredAliases, r)
+		return nil
+	})
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("error while exporting retired aliases: %w", err)
+	}
+	return s, nil
+}
+
+// RestoreSnapshot записывает снимок в пустое хранилище в одной транзакции, сохраняя исходные ID,
+// и сдвигает последовательности за максимальные ID. Если в хранилище уже есть данные, возвращает ErrStorageNotEmpty.
+// Ссылочную целостность снимка проверяет вызывающий; нарушения, которые пропустила проверка, откатят транзакцию.
+func (db *DbManager) RestoreSnapshot(ctx context.Context, s Snapshot) error {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var used bool
+	const check = `SELECT EXISTS (SELECT 1 FROM users) OR EXISTS (SELECT 1 FROM workspaces) OR EXISTS (SELECT 1 FROM urls)`
+	if err := tx.QueryRow(ctx, check).Scan(&used); err != nil {
+		return fmt.Errorf("error while checking storage: %w", err)
+	}
+	if used {
+		return ErrStorageNotEmpty
+	}
+
+	for _, u := range s.Users {
+		const q = `INSERT INTO users (id, mail, password, role, created_at, verified_at, disabled_at,
+                totp_secret, totp_enabled_at, totp_last_step)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, $10)`
+		if _, err := tx.Exec(ctx, q, u.ID, u.Mail, u.PasswordHash, u.Role, u.CreatedAt,
+			nullTime(u.VerifiedAt), nullTime(u.DisabledAt), u.TOTPSecret, nullTime(u.TOTPEnabledAt), u.TOTPLastStep); err != nil {
+			return fmt.Errorf("error while restoring user %d: %w", u.ID, err)
+		}
+		for _, h := range u.RecoveryCodes {
+			if _, err := tx.Exec(ctx, `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`, u.ID, h); err != nil {
+				return fmt.Errorf("error while restoring recovery codes of user %d: %w", u.ID, err)
+			}
+		}
+		for _, o := range u.OIDCIdentities {
+			const q = `INSERT INTO oidc_identities (user_id, issuer, subject, created_at) VALUES ($1, $2, $3, $4)`
+			if _, err := tx.Exec(ctx, q, u.ID, o.Issuer, o.Subject, o.CreatedAt); err != nil {
+				return fmt.Errorf("error while restoring oidc identity of user %d: %w", u.ID, err)
+			}
+		}
+	}
+	for _, w := range s.Workspaces {
+		const q = `INSERT INTO workspaces (id, name, created_at) VALUES ($1, $2, $3)`
+		if _, err := tx.Exec(ctx, q, w.ID, w.Name, w.CreatedAt); err != nil {
+			return fmt.Errorf("error while restoring workspace %d: %w", w.ID, err)
+		}
+	}
+	for _, m := range s.Members {
+		const q = `INSERT INTO workspace_members (workspace_id, user_id, role, created_at) VALUES ($1, $2, $3, $4)`
+		if _, err := tx.Exec(ctx, q, m.WorkspaceID, m.UserID, m.Role, m.CreatedAt); err != nil {
+			return fmt.Errorf("error while restoring member %d of workspace %d: %w", m.UserID, m.WorkspaceID, err)
+		}
+	}
+	for _, f := range s.Folders {
+		const q = `INSERT INTO folders (id, user_id, workspace_id, name, created_at)
+            VALUES ($1, NULLIF($2, 0), NULLIF($3, 0), $4, $5)`
+		if _, err := tx.Exec(ctx, q, f.ID, f.UserID, f.WorkspaceID, f.Name, f.CreatedAt); err != nil {
+			return fmt.Errorf("error while restoring folder %d: %w", f.ID, err)
+		}
+	}
+	// alias из retired_aliases триггер не даёт занять, поэтому ссылки пишутся раньше
+	for _, l := range s.Links {
+		const q = `INSERT INTO urls (id, short_code, original_url, title, notes, user_id, workspace_id, folder_id,
+                clicks, created_at, updated_at, expires_at, deleted_at, taken_down_at, takedown_reason)
+            VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), NULLIF($7, 0), NULLIF($8, 0),
+                $9, $10, $11, $12, $13, $14, $15)`
+		if _, err := tx.Exec(ctx, q, l.ID, l.Alias, l.URL, l.Title, l.Notes, l.UserID, l.WorkspaceID, l.FolderID,
+			l.Clicks, l.CreatedAt, nullTime(l.UpdatedAt), nullTime(l.ExpiresAt), nullTime(l.DeletedAt),
+			nullTime(l.TakenDownAt), l.TakedownReason); err != nil {
+			return fmt.Errorf("error while restoring link %q: %w", l.Alias, err)
+		}
+		if l.UserID == 0 && l.WorkspaceID == 0 {
+			continue // у ссылки без владельца тегов быть не может
+		}
+		if err := addLinkTags(ctx, tx, Owner{UserID: l.UserID, WorkspaceID: l.WorkspaceID}, []int64{l.ID}, l.Tags); err != nil {
+			return fmt.Errorf("error while restoring tags of link %q: %w", l.Alias, err)
+		}
+	}
+	for _, r := range s.RetiredAliases {
+		const q = `INSERT INTO retired_aliases (short_code, url_id, retired_at) VALUES ($1, NULLIF($2, 0), $3)`
+		if _, err := tx.Exec(ctx, q, r.Alias, r.LinkID, r.RetiredAt); err != nil {
+			return fmt.Errorf("error while restoring retired alias %q: %w", r.Alias, err)
+		}
+	}
+
+	for _, table := range []string{"users", "workspaces", "folders", "urls"} {
+		q := `SELECT setval(pg_get_serial_sequence('` + table + `', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM ` + table
+		if _, err := tx.Exec(ctx, q); err != nil {
+			return fmt.Errorf("error while resetting %s sequence: %w", table, err)
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// queryAll выполняет запрос и вызывает scan для каждой строки.
+func queryAll(ctx context.Context, tx pgx.Tx, q string, args []any, scan func(rows pgx.Rows) error) error {
+	rows, err := tx.Query(ctx, q, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
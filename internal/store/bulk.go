@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	pgerr "github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// NewLink — ссылка для пакетного создания или импорта.
+type NewLink struct {
+	Alias     string
+	URL       string
+	Title     string
+	Tags      []string
+	ExpiresAt time.Time // нулевое время — бессрочная
+	CreatedAt time.Time // нулевое время — сейчас; задаётся при импорте
+	Clicks    int64     // переходы, накопленные до импорта
+}
+
+// LinkBatchError — ошибка на строке Index пакета: из-за неё не создана ни одна ссылка пакета.
+type LinkBatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *LinkBatchError) Error() string {
+	return fmt.Sprintf("link %d: %v", e.Index, e.Err)
+}
+
+func (e *LinkBatchError) Unwrap() error { return e.Err }
+
+// CreateLinks создаёт ссылки владельца owner вместе с тегами в одной транзакции: либо все, либо ни одной.
+// Если alias занят, возвращает *LinkBatchError с ErrShortURLExists.
+func (db *DbManager) CreateLinks(ctx context.Context, owner Owner, links []NewLink) ([]int64, error) {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const q = `
+        INSERT INTO urls (short_code, original_url, created_at, user_id, workspace_id, expires_at, title, clicks)
+        VALUES ($1, $2, COALESCE($6, NOW()), $3, NULLIF($4, 0), $5, $7, $8)
+        RETURNING id
+    `
+	ids := make([]int64, len(links))
+	for i, l := range links {
+		if err := tx.QueryRow(ctx, q, l.Alias, l.URL, owner.UserID, owner.WorkspaceID,
+			nullTime(l.ExpiresAt), nullTime(l.CreatedAt), l.Title, l.Clicks).Scan(&ids[i]); err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == pgerr.UniqueViolation {
+				return nil, &LinkBatchError{Index: i, Err: ErrShortURLExists}
+			}
+			return nil, &LinkBatchError{Index: i, Err: fmt.Errorf("error while adding URL: %w", err)}
+		}
+		if err := addLinkTags(ctx, tx, owner, []int64{ids[i]}, l.Tags); err != nil {
+			return nil, &LinkBatchError{Index: i, Err: err}
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error while committing links: %w", err)
+	}
+	return ids, nil
+}
+
+// TakenAliases возвращает те из aliases, что заняты ссылками (в том числе из корзины) или выведены из оборота.
+func (db *DbManager) TakenAliases(ctx context.Context, aliases []string) (map[string]bool, error) {
+	const q = `
+        SELECT short_code FROM urls WHERE short_code = ANY($1)
+        UNION
+        SELECT short_code FROM retired_aliases WHERE short_code = ANY($1)
+    `
+	rows, err := db.conn.Query(ctx, q, aliases)
+	if err != nil {
+		return nil, fmt.Errorf("error while checking aliases: %w", err)
+	}
+	defer rows.Close()
+
+	taken := make(map[string]bool)
+	for rows.Next() {
+		var alias string
+		if err := rows.Scan(&alias); err != nil {
+			return nil, fmt.Errorf("error while scanning alias: %w", err)
+		}
+		taken[alias] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while checking aliases: %w", err)
+	}
+	return taken, nil
+}
+
+// AddClicks прибавляет к счётчикам переходов накопленные значения ID ссылки -> число переходов.
+// Счётчики ведутся по ID, а не по alias, чтобы переходы не терялись, если ссылку переименовали до сброса.
+func (db *DbManager) AddClicks(ctx context.Context, clicks map[int64]int64) error {
+	ids := make([]int64, 0, len(clicks))
+	counts := make([]int64, 0, len(clicks))
+	for id, n := range clicks {
+		ids = append(ids, id)
+		counts = append(counts, n)
+	}
+	const q = `
+        UPDATE urls SET clicks = urls.clicks + c.n
+        FROM unnest($1::bigint[], $2::bigint[]) AS c(id, n)
+        WHERE urls.id = c.id
+    `
+	if _, err := db.conn.Exec(ctx, q, ids, counts); err != nil {
+		return fmt.Errorf("error while adding clicks: %w", err)
+	}
+	return nil
+}
+
+// nullTime переводит нулевое время в NULL.
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
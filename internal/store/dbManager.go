@@ -4,19 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log/slog"
 	"time"
 	"url-shorter/internal/config"
+	"url-shorter/internal/logging"
 
 	"github.com/google/uuid"
 
 	pgerr "github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type DbManager struct {
-	conn *pgx.Conn
+	conn *pgxpool.Pool // пул соединений: хендлеры, проверки готовности и фоновые задачи ходят в БД параллельно
 }
 
 func NewDBConnection(cfg *config.Storage) (*DbManager, error) {
@@ -29,35 +30,42 @@ func NewDBConnection(cfg *config.Storage) (*DbManager, error) {
 		cfg.DBName,
 	)
 
-	conn, err := pgx.Connect(context.Background(), connStr)
+	conn, err := pgxpool.New(context.Background(), connStr)
 
 	if err != nil {
 		return nil, fmt.Errorf("unable to connect to database: %w", err)
 	}
 
+	if err := conn.Ping(context.Background()); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to connect to database: %w", err)
+	}
+
 	return &DbManager{conn: conn}, nil
 }
 
 func (db *DbManager) Close() error {
 	if db.conn != nil {
-		return db.conn.Close(context.Background())
+		db.conn.Close()
 	}
 	return nil
 }
 
-func (db *DbManager) SaveUser(ctx context.Context, mail, password string) error {
+func (db *DbManager) SaveUser(ctx context.Context, mail, password string) (int64, error) {
 	query := `
         INSERT INTO users (mail, password, created_at)
         VALUES ($1, $2, NOW())
+        RETURNING id
     `
-	if _, err := db.conn.Exec(ctx, query, mail, password); err != nil {
+	var id int64
+	if err := db.conn.QueryRow(ctx, query, mail, password).Scan(&id); err != nil {
 		var curErr *pgconn.PgError
 		if errors.As(err, &curErr) && curErr.Code == pgerr.UniqueViolation {
-			return ErrUserExists
+			return 0, ErrUserExists
 		}
-		return fmt.Errorf("error while adding user: %w", err)
+		return 0, fmt.Errorf("error while adding user: %w", err)
 	}
-	return nil
+	return id, nil
 }
 
 func (db *DbManager) GetUserByEmail(ctx context.Context, mail string) (int64, string, error) {
@@ -74,27 +82,81 @@ func (db *DbManager) GetUserByEmail(ctx context.Context, mail string) (int64, st
     return id, passwordHash, nil
 }
 
-func (db *DbManager) GetUserIDBySessionToken(ctx context.Context, token string) (int64, error) {
-	var userID int64
-	query := `SELECT user_id FROM sessions WHERE token = $1 AND expiry > NOW()`
-	err := db.conn.QueryRow(ctx, query, token).Scan(&userID)
+// GetUserByID возвращает email и хеш пароля пользователя.
+func (db *DbManager) GetUserByID(ctx context.Context, id int64) (string, string, error) {
+	var mail, passwordHash string
+	query := `SELECT mail, password FROM users WHERE id = $1`
+	err := db.conn.QueryRow(ctx, query, id).Scan(&mail, &passwordHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", ErrUserNotFound
+		}
+		return "", "", fmt.Errorf("error while getting user: %w", err)
+	}
+	return mail, passwordHash, nil
+}
+
+// UpdatePassword заменяет хеш пароля пользователя, завершает его сессии и отзывает API-токены.
+func (db *DbManager) UpdatePassword(ctx context.Context, id int64, hash string) error {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE users SET password = $2 WHERE id = $1`
+	cmd, err := tx.Exec(ctx, query, id, hash)
+	if err != nil {
+		return fmt.Errorf("error while updating password: %w", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	if err := revokeCredentials(ctx, tx, id); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error while committing password update: %w", err)
+	}
+	return nil
+}
+
+// MarkEmailVerified помечает email пользователя подтверждённым (если он ещё не был подтверждён).
+func (db *DbManager) MarkEmailVerified(ctx context.Context, id int64) error {
+	query := `UPDATE users SET verified_at = COALESCE(verified_at, NOW()) WHERE id = $1`
+	cmd, err := db.conn.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("error while verifying email: %w", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// IsEmailVerified сообщает, подтверждён ли email пользователя.
+func (db *DbManager) IsEmailVerified(ctx context.Context, id int64) (bool, error) {
+	var verified bool
+	query := `SELECT verified_at IS NOT NULL FROM users WHERE id = $1`
+	err := db.conn.QueryRow(ctx, query, id).Scan(&verified)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return 0, ErrSessionNotFound
+			return false, ErrUserNotFound
 		}
-		return 0, err
+		return false, fmt.Errorf("error while checking email verification: %w", err)
 	}
-	return userID, nil
+	return verified, nil
 }
 
-func (db *DbManager) SaveUrl(ctx context.Context, shortCode, longUrl string) (int64, error) {
+// SaveUrl сохраняет ссылку владельца owner.
+func (db *DbManager) SaveUrl(ctx context.Context, owner Owner, shortCode, longUrl string) (int64, error) {
 	query := `
-      INSERT INTO urls (short_code, original_url, created_at)
-      VALUES ($1, $2, NOW())
+      INSERT INTO urls (short_code, original_url, created_at, user_id, workspace_id)
+      VALUES ($1, $2, NOW(), $3, NULLIF($4, 0))
       RETURNING id
     `
 	var id int64
-	err := db.conn.QueryRow(ctx, query, shortCode, longUrl).Scan(&id)
+	err := db.conn.QueryRow(ctx, query, shortCode, longUrl, owner.UserID, owner.WorkspaceID).Scan(&id)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == pgerr.UniqueViolation {
@@ -102,60 +164,88 @@ func (db *DbManager) SaveUrl(ctx context.Context, shortCode, longUrl string) (in
 		}
 		return -1, fmt.Errorf("error while adding URL: %w", err)
 	}
-	slog.Info("url was saved", "url", longUrl, "alias", shortCode)
+	logging.FromContext(ctx).Info("url was saved", "url", longUrl, "alias", shortCode)
 	return id, nil
 }
 
-// GetURL возвращает original_url из таблицы urls по переданному short_code.
-// Если записи с таким alias нет — возвращает ErrShortURLNotFound.
-func (db *DbManager) GetUrl(ctx context.Context, alias string) (string, error) {
+// Redirect — то, что нужно для редиректа по alias.
+type Redirect struct {
+	LinkID    int64
+	URL       string
+	ExpiresAt time.Time // нулевое время — бессрочная
+}
+
+// GetURL возвращает ссылку из таблицы urls по переданному short_code (или прежнему alias переименованной ссылки).
+// Если записи с таким alias нет — возвращает ErrShortURLNotFound, если ссылка снята администратором — ErrShortURLTakenDown,
+// если удалена (в корзине или навсегда) — ErrShortURLDeleted, если срок действия истёк — ErrShortURLExpired.
+func (db *DbManager) GetUrl(ctx context.Context, alias string) (Redirect, error) {
 	const query = `
-        SELECT original_url
+        SELECT id, original_url, taken_down_at IS NOT NULL, deleted_at IS NOT NULL, COALESCE(expires_at, 'epoch'), expires_at <= NOW()
         FROM urls
-        WHERE short_code = $1
+        WHERE short_code = $1 OR id = (SELECT url_id FROM retired_aliases WHERE short_code = $1)
+        LIMIT 1
     `
-	var longURL string
-	err := db.conn.QueryRow(ctx, query, alias).Scan(&longURL)
+	var r Redirect
+	var takenDown, deleted bool
+	var expired *bool
+	err := db.conn.QueryRow(ctx, query, alias).Scan(&r.LinkID, &r.URL, &takenDown, &deleted, &r.ExpiresAt, &expired)
 	if err != nil {
-		// Если в БД нет строки с таким short_code
+		// Если в БД нет строки с таким short_code — возможно, её уже стёрли из корзины
 		if errors.Is(err, pgx.ErrNoRows) {
-			return "", ErrShortURLNotFound
+			retired, err := db.isRetiredAlias(ctx, alias)
+			if err != nil {
+				return Redirect{}, err
+			}
+			if retired {
+				return Redirect{}, ErrShortURLDeleted
+			}
+			return Redirect{}, ErrShortURLNotFound
 		}
 		// Все прочие ошибки отдаем дальше
-		return "", fmt.Errorf("error while getting original URL: %w", err)
+		return Redirect{}, fmt.Errorf("error while getting original URL: %w", err)
+	}
+	if deleted {
+		return Redirect{}, ErrShortURLDeleted
+	}
+	if takenDown {
+		return Redirect{}, ErrShortURLTakenDown
+	}
+	if expired != nil && *expired {
+		return Redirect{}, ErrShortURLExpired
 	}
-	return longURL, nil
+	r.ExpiresAt = zeroIfEpoch(r.ExpiresAt)
+	return r, nil
 }
 
-// SaveAlias обновляет короткий код (short_code) для уже существующего original_url.
-// Если такого original_url нет — возвращает ErrShortURLNotFound.
-// Если новый alias уже занят — возвращает ErrShortURLExists.
-func (db *DbManager) SaveAlias(ctx context.Context, alias, longURL string) error {
+// ListRecentUrls возвращает не больше limit последних созданных ссылок в виде short_code -> Redirect.
+// Используется для прогрева кэша при старте; ссылки со сроком действия не берём — их кэш хранит до истечения срока.
+func (db *DbManager) ListRecentUrls(ctx context.Context, limit int) (map[string]Redirect, error) {
 	const query = `
-        UPDATE urls
-           SET short_code = $1
-         WHERE original_url = $2
+        SELECT id, short_code, original_url
+        FROM urls
+        WHERE taken_down_at IS NULL AND deleted_at IS NULL AND expires_at IS NULL
+        ORDER BY created_at DESC
+        LIMIT $1
     `
-
-	// Выполняем UPDATE
-	cmd, err := db.conn.Exec(ctx, query, alias, longURL)
+	rows, err := db.conn.Query(ctx, query, limit)
 	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) {
-			switch pgErr.Code {
-			case pgerr.UniqueViolation:
-				return ErrShortURLExists
-			}
-		}
-		return fmt.Errorf("error while updating alias: %w", err)
+		return nil, fmt.Errorf("error while listing urls: %w", err)
 	}
+	defer rows.Close()
 
-	// Если не затронулось ни одной строки — такого longURL нет
-	if cmd.RowsAffected() == 0 {
-		return ErrShortURLNotFound
+	urls := make(map[string]Redirect, limit)
+	for rows.Next() {
+		var alias string
+		var r Redirect
+		if err := rows.Scan(&r.LinkID, &alias, &r.URL); err != nil {
+			return nil, fmt.Errorf("error while scanning url: %w", err)
+		}
+		urls[alias] = r
 	}
-
-	return nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while listing urls: %w", err)
+	}
+	return urls, nil
 }
 
 func (db *DbManager) GetAlias(ctx context.Context, longUrl string) (string, error) {
@@ -175,14 +265,17 @@ func (db *DbManager) GetAlias(ctx context.Context, longUrl string) (string, erro
 	return shortUrl, nil
 }
 
-func (db *DbManager) CreateSession(ctx context.Context, userID int64) (string, error) {
-	token := uuid.New().String()             // Генерируем случайный токен (uuid)
-	expiry := time.Now().Add(24 * time.Hour) // Сессия на 24 часа
+// CreateSession создаёт сессию s (ID и время создания проставляет БД) и возвращает её токен.
+func (db *DbManager) CreateSession(ctx context.Context, s Session) (string, error) {
+	token := uuid.New().String() // Генерируем случайный токен (uuid)
 
-	query := `INSERT INTO sessions (token, user_id, expiry) VALUES ($1, $2, $3)`
-	_, err := db.conn.Exec(ctx, query, token, userID, expiry)
+	const query = `
+        INSERT INTO sessions (token, user_id, expiry, absolute_expiry, remember, created_at, last_seen_at, ip, user_agent)
+        VALUES ($1, $2, $3, $4, $5, NOW(), NOW(), $6, $7)
+    `
+	_, err := db.conn.Exec(ctx, query, token, s.UserID, s.ExpiresAt, s.AbsoluteExpiresAt, s.Remember, s.IP, s.UserAgent)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("error while creating session: %w", err)
 	}
 	return token, nil
 }
@@ -193,3 +286,12 @@ func (db *DbManager) DeleteSession(ctx context.Context, token string) error {
 	return err
 }
 
+// DeleteUserSessions удаляет все сессии пользователя (например, после смены пароля).
+func (db *DbManager) DeleteUserSessions(ctx context.Context, userID int64) error {
+	query := `DELETE FROM sessions WHERE user_id = $1`
+	if _, err := db.conn.Exec(ctx, query, userID); err != nil {
+		return fmt.Errorf("error while deleting user sessions: %w", err)
+	}
+	return nil
+}
+
@@ -7,6 +7,7 @@ var (
 	ErrShortURLExists   = errors.New("short URL already exists")
 	ErrUserNotFound     = errors.New("user not found")
 	ErrShortURLNotFound = errors.New("short URL not found")
+	ErrShortURLExpired  = errors.New("short URL has expired")
 	ErrInvalidData      = errors.New("invalid data")
 	ErrDatabase         = errors.New("database error")
 	ErrNotFound         = errors.New("not found")
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	pgerr "github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrFolderExists   = errors.New("folder with this name already exists")
+	ErrFolderNotFound = errors.New("folder not found")
+)
+
+// Folder — папка владельца и число ссылок в ней (без удалённых).
+type Folder struct {
+	ID    int64
+	Name  string
+	Links int64
+}
+
+// ListFolders возвращает папки владельца по алфавиту.
+func (db *DbManager) ListFolders(ctx context.Context, owner Owner) ([]Folder, error) {
+	scope, id := ownerScope(owner)
+	q := `SELECT folders.id, folders.name,
+            (SELECT COUNT(*) FROM urls WHERE urls.folder_id = folders.id AND urls.deleted_at IS NULL)
+        FROM folders
+        WHERE ` + scope + `
+        ORDER BY lower(folders.name)`
+	rows, err := db.conn.Query(ctx, q, id)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing folders: %w", err)
+	}
+	defer rows.Close()
+
+	var folders []Folder
+	for rows.Next() {
+		var f Folder
+		if err := rows.Scan(&f.ID, &f.Name, &f.Links); err != nil {
+			return nil, fmt.Errorf("error while scanning folder: %w", err)
+		}
+		folders = append(folders, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while listing folders: %w", err)
+	}
+	return folders, nil
+}
+
+// CreateFolder создаёт папку владельца. Имена папок одного владельца уникальны без учёта регистра.
+func (db *DbManager) CreateFolder(ctx context.Context, owner Owner, name string) (Folder, error) {
+	userID, workspaceID := ownerColumns(owner)
+	const q = `INSERT INTO folders (user_id, workspace_id, name) VALUES (NULLIF($1, 0), NULLIF($2, 0), $3) RETURNING id`
+	f := Folder{Name: name}
+	if err := db.conn.QueryRow(ctx, q, userID, workspaceID, name).Scan(&f.ID); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerr.UniqueViolation {
+			return Folder{}, ErrFolderExists
+		}
+		return Folder{}, fmt.Errorf("error while creating folder: %w", err)
+	}
+	return f, nil
+}
+
+// GetFolder возвращает папку владельца по id.
+func (db *DbManager) GetFolder(ctx context.Context, owner Owner, id int64) (Folder, error) {
+	scope, ownerID := ownerScope(owner)
+	q := `SELECT folders.id, folders.name,
+            (SELECT COUNT(*) FROM urls WHERE urls.folder_id = folders.id AND urls.deleted_at IS NULL)
+        FROM folders
+        WHERE ` + scope + ` AND folders.id = $2`
+	var f Folder
+	if err := db.conn.QueryRow(ctx, q, ownerID, id).Scan(&f.ID, &f.Name, &f.Links); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Folder{}, ErrFolderNotFound
+		}
+		return Folder{}, fmt.Errorf("error while getting folder: %w", err)
+	}
+	return f, nil
+}
+
+// DeleteFolder удаляет папку владельца; ссылки из неё остаются вне папок.
+func (db *DbManager) DeleteFolder(ctx context.Context, owner Owner, id int64) error {
+	scope, ownerID := ownerScope(owner)
+	tag, err := db.conn.Exec(ctx, `DELETE FROM folders WHERE `+scope+` AND id = $2`, ownerID, id)
+	if err != nil {
+		return fmt.Errorf("error while deleting folder: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrFolderNotFound
+	}
+	return nil
+}
+
+// SetLinkFolder перекладывает ссылку linkID в папку folderID (0 — вынуть из папки).
+// Папку проверяет вызывающий: она должна принадлежать владельцу ссылки.
+func (db *DbManager) SetLinkFolder(ctx context.Context, linkID, folderID int64) error {
+	const q = `UPDATE urls SET folder_id = NULLIF($2, 0) WHERE id = $1`
+	tag, err := db.conn.Exec(ctx, q, linkID, folderID)
+	if err != nil {
+		return fmt.Errorf("error while moving link: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrShortURLNotFound
+	}
+	return nil
+}
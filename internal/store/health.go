@@ -0,0 +1,53 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+// requiredTables — таблицы, которые должен создать db/init_db.sql.
+// Если какой-то из них нет, значит схема не накатана и принимать трафик рано.
+var requiredTables = []string{
+	"users",
+	"urls",
+	"url_history",
+	"retired_aliases",
+	"folders",
+	"tags",
+	"link_tags",
+	"sessions",
+	"rate_limits",
+	"login_throttle",
+	"login_events",
+	"password_resets",
+	"recovery_codes",
+	"api_tokens",
+	"oidc_identities",
+	"workspaces",
+	"workspace_members",
+	"workspace_invites",
+	"audit_log",
+}
+
+// Ping проверяет, что БД доступна.
+func (db *DbManager) Ping(ctx context.Context) error {
+	if err := db.conn.Ping(ctx); err != nil {
+		return fmt.Errorf("database is unreachable: %w", err)
+	}
+	return nil
+}
+
+// CheckSchema проверяет, что все нужные таблицы существуют.
+func (db *DbManager) CheckSchema(ctx context.Context) error {
+	const query = `SELECT to_regclass($1) IS NOT NULL`
+	for _, table := range requiredTables {
+		var exists bool
+		if err := db.conn.QueryRow(ctx, query, table).Scan(&exists); err != nil {
+			return fmt.Errorf("error while checking table %s: %w", table, err)
+		}
+		if !exists {
+			return fmt.Errorf("table %s does not exist, apply db/init_db.sql", table)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	pgerr "github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var ErrLinkVersionNotFound = errors.New("link version not found")
+
+// LinkEdit — редактируемые поля ссылки.
+type LinkEdit struct {
+	Alias string
+	URL   string
+	Title string
+	Notes string
+}
+
+// LinkVersion — прежняя версия ссылки из истории изменений.
+type LinkVersion struct {
+	ID            int64
+	Alias         string
+	URL           string
+	Title         string
+	Notes         string
+	ChangedBy     int64 // кто заменил эту версию; 0 — пользователь удалён
+	ChangedByMail string
+	ChangedAt     time.Time // когда версия перестала быть текущей
+}
+
+// GetLink возвращает ссылку по alias вместе с автором.
+func (db *DbManager) GetLink(ctx context.Context, alias string) (Link, error) {
+	q := `SELECT ` + linkColumns + `
+        FROM urls LEFT JOIN users ON users.id = urls.user_id
+        WHERE urls.short_code = $1`
+	l, err := scanLink(db.conn.QueryRow(ctx, q, alias))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Link{}, ErrShortURLNotFound
+		}
+		return Link{}, fmt.Errorf("error while getting link: %w", err)
+	}
+	return l, nil
+}
+
+// UpdateLink заменяет поля ссылки id на edit, предыдущую версию сохраняет в историю.
+// При смене alias прежний переносится в retired_aliases: он продолжает вести на эту ссылку и никому больше не достанется.
+// Если новый alias уже занят — возвращает ErrShortURLExists.
+func (db *DbManager) UpdateLink(ctx context.Context, id int64, edit LinkEdit, changedBy int64) error {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// строку блокируем, чтобы при одновременных правках в историю попала именно заменённая версия
+	const history = `
+        INSERT INTO url_history (url_id, short_code, original_url, title, notes, changed_by)
+        SELECT id, short_code, original_url, title, notes, NULLIF($2, 0)
+        FROM urls WHERE id = $1
+        FOR UPDATE
+        RETURNING short_code
+    `
+	var oldAlias string
+	if err := tx.QueryRow(ctx, history, id, changedBy).Scan(&oldAlias); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrShortURLNotFound
+		}
+		return fmt.Errorf("error while saving link history: %w", err)
+	}
+
+	const query = `
+        UPDATE urls SET short_code = $2, original_url = $3, title = $4, notes = $5, updated_at = NOW()
+        WHERE id = $1
+    `
+	if _, err := tx.Exec(ctx, query, id, edit.Alias, edit.URL, edit.Title, edit.Notes); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerr.UniqueViolation {
+			return ErrShortURLExists
+		}
+		return fmt.Errorf("error while updating link: %w", err)
+	}
+	if oldAlias != edit.Alias {
+		const retire = `INSERT INTO retired_aliases (short_code, url_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+		if _, err := tx.Exec(ctx, retire, oldAlias, id); err != nil {
+			return fmt.Errorf("error while retiring old alias: %w", err)
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+const linkVersionColumns = `h.id, h.short_code, h.original_url, h.title, h.notes, COALESCE(h.changed_by, 0), COALESCE(u.mail, ''), h.changed_at`
+
+func scanLinkVersion(row pgx.Row) (LinkVersion, error) {
+	var v LinkVersion
+	err := row.Scan(&v.ID, &v.Alias, &v.URL, &v.Title, &v.Notes, &v.ChangedBy, &v.ChangedByMail, &v.ChangedAt)
+	return v, err
+}
+
+// ListLinkHistory возвращает прежние версии ссылки, начиная с последней.
+func (db *DbManager) ListLinkHistory(ctx context.Context, linkID int64, limit int) ([]LinkVersion, error) {
+	q := `SELECT ` + linkVersionColumns + `
+        FROM url_history h LEFT JOIN users u ON u.id = h.changed_by
+        WHERE h.url_id = $1
+        ORDER BY h.changed_at DESC, h.id DESC
+        LIMIT $2`
+	rows, err := db.conn.Query(ctx, q, linkID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing link history: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []LinkVersion
+	for rows.Next() {
+		v, err := scanLinkVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning link version: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while listing link history: %w", err)
+	}
+	return versions, nil
+}
+
+// GetLinkVersion возвращает версию versionID из истории ссылки linkID.
+func (db *DbManager) GetLinkVersion(ctx context.Context, linkID, versionID int64) (LinkVersion, error) {
+	q := `SELECT ` + linkVersionColumns + `
+        FROM url_history h LEFT JOIN users u ON u.id = h.changed_by
+        WHERE h.url_id = $1 AND h.id = $2`
+	v, err := scanLinkVersion(db.conn.QueryRow(ctx, q, linkID, versionID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return LinkVersion{}, ErrLinkVersionNotFound
+		}
+		return LinkVersion{}, fmt.Errorf("error while getting link version: %w", err)
+	}
+	return v, nil
+}
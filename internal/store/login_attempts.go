@@ -0,0 +1,224 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Области, в которых считаются неудачные попытки входа.
+const (
+	ThrottleScopeAccount = "account" // ключ — email
+	ThrottleScopeIP      = "ip"      // ключ — IP клиента
+)
+
+// Типы событий входа, которые пишутся в login_events.
+const (
+	LoginEventSuccess = "success"
+	LoginEventFailure = "failure"
+	LoginEventBlocked = "blocked" // попытка во время задержки или блокировки, пароль не проверялся
+	LoginEventLocked  = "locked"  // аккаунт или IP заблокирован после превышения порога
+)
+
+// LoginThrottle — счётчик неудачных попыток входа для аккаунта или IP.
+type LoginThrottle struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time // нулевое время — блокировки нет
+}
+
+// LoginEvent — запись о попытке входа.
+type LoginEvent struct {
+	ID        int64
+	UserID    int64 // 0, если пользователь с таким email не найден
+	Mail      string
+	IP        string
+	Event     string
+	CreatedAt time.Time
+}
+
+// LoginEventFilter — фильтр журнала попыток входа для админки. Пустые поля не фильтруют.
+type LoginEventFilter struct {
+	Mail   string
+	IP     string
+	Events []string // типы событий; пусто — все
+	Since  time.Time
+	Limit  int
+}
+
+// LoginLock — действующая блокировка входа для аккаунта или IP.
+type LoginLock struct {
+	Scope       string
+	Key         string
+	LockedUntil time.Time
+	NotifiedAt  time.Time // нулевое время — владельца не уведомляли
+}
+
+// GetLoginThrottle возвращает счётчик для scope/key. Если попыток не было — нулевое значение.
+func (db *DbManager) GetLoginThrottle(ctx context.Context, scope, key string) (LoginThrottle, error) {
+	const query = `
+        SELECT failures, last_failure, COALESCE(locked_until, 'epoch')
+        FROM login_throttle
+        WHERE scope = $1 AND key = $2
+    `
+	var t LoginThrottle
+	err := db.conn.QueryRow(ctx, query, scope, key).Scan(&t.Failures, &t.LastFailure, &t.LockedUntil)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return LoginThrottle{}, nil
+		}
+		return LoginThrottle{}, fmt.Errorf("error while getting login throttle: %w", err)
+	}
+	return t, nil
+}
+
+// RecordLoginFailure атомарно увеличивает счётчик неудач и возвращает его новое значение.
+// Если последняя неудача была раньше, чем window назад, счёт начинается заново.
+func (db *DbManager) RecordLoginFailure(ctx context.Context, scope, key string, window time.Duration) (LoginThrottle, error) {
+	const query = `
+        INSERT INTO login_throttle (scope, key, failures, last_failure)
+        VALUES ($1, $2, 1, NOW())
+        ON CONFLICT (scope, key) DO UPDATE SET
+            failures = CASE
+                WHEN login_throttle.last_failure < NOW() - make_interval(secs => $3) THEN 1
+                ELSE login_throttle.failures + 1
+            END,
+            last_failure = NOW()
+        RETURNING failures, last_failure, COALESCE(locked_until, 'epoch')
+    `
+	var t LoginThrottle
+	err := db.conn.QueryRow(ctx, query, scope, key, window.Seconds()).Scan(&t.Failures, &t.LastFailure, &t.LockedUntil)
+	if err != nil {
+		return LoginThrottle{}, fmt.Errorf("error while recording login failure: %w", err)
+	}
+	return t, nil
+}
+
+// LockLogin блокирует вход для scope/key до until и обнуляет счётчик: после блокировки порог
+// отсчитывается заново. Возвращает true, если владельца нужно уведомить — то есть если за
+// последние notifyWindow уведомления о блокировке ещё не было. Решение принимается в том же
+// UPDATE, поэтому две одновременные блокировки не отправят два письма.
+func (db *DbManager) LockLogin(ctx context.Context, scope, key string, until time.Time, notifyWindow time.Duration) (bool, error) {
+	const query = `
+        UPDATE login_throttle SET
+            locked_until = $3,
+            failures = 0,
+            notified_at = CASE
+                WHEN notified_at IS NULL OR notified_at < NOW() - make_interval(secs => $4) THEN NOW()
+                ELSE notified_at
+            END
+        WHERE scope = $1 AND key = $2
+        RETURNING notified_at = NOW()
+    `
+	var notify bool
+	if err := db.conn.QueryRow(ctx, query, scope, key, until, notifyWindow.Seconds()).Scan(&notify); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error while locking login: %w", err)
+	}
+	return notify, nil
+}
+
+// ResetLoginThrottle сбрасывает счётчик (после успешного входа).
+func (db *DbManager) ResetLoginThrottle(ctx context.Context, scope, key string) error {
+	const query = `DELETE FROM login_throttle WHERE scope = $1 AND key = $2`
+	if _, err := db.conn.Exec(ctx, query, scope, key); err != nil {
+		return fmt.Errorf("error while resetting login throttle: %w", err)
+	}
+	return nil
+}
+
+// SaveLoginEvent записывает событие входа для последующего разбора администраторами.
+func (db *DbManager) SaveLoginEvent(ctx context.Context, e LoginEvent) error {
+	const query = `
+        INSERT INTO login_events (user_id, mail, ip, event, created_at)
+        VALUES (NULLIF($1, 0), $2, $3, $4, NOW())
+    `
+	if _, err := db.conn.Exec(ctx, query, e.UserID, e.Mail, e.IP, e.Event); err != nil {
+		return fmt.Errorf("error while saving login event: %w", err)
+	}
+	return nil
+}
+
+// ListLoginEvents возвращает попытки входа по фильтру, новые сверху.
+func (db *DbManager) ListLoginEvents(ctx context.Context, f LoginEventFilter) ([]LoginEvent, error) {
+	var where []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where = append(where, strings.ReplaceAll(cond, "?", "$"+strconv.Itoa(len(args))))
+	}
+	if f.Mail != "" {
+		add("mail = ?", f.Mail)
+	}
+	if f.IP != "" {
+		add("ip = ?", f.IP)
+	}
+	if len(f.Events) > 0 {
+		add("event = ANY(?)", f.Events)
+	}
+	if !f.Since.IsZero() {
+		add("created_at >= ?", f.Since)
+	}
+
+	query := `SELECT id, COALESCE(user_id, 0), mail, ip, event, created_at FROM login_events`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	args = append(args, f.Limit)
+	query += ` ORDER BY id DESC LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := db.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing login events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []LoginEvent
+	for rows.Next() {
+		var e LoginEvent
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Mail, &e.IP, &e.Event, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error while scanning login event: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while listing login events: %w", err)
+	}
+	return events, nil
+}
+
+// ListLoginLocks возвращает действующие блокировки входа, дольше всех длящиеся сверху.
+func (db *DbManager) ListLoginLocks(ctx context.Context) ([]LoginLock, error) {
+	const query = `
+        SELECT scope, key, locked_until, COALESCE(notified_at, 'epoch')
+        FROM login_throttle
+        WHERE locked_until > NOW()
+        ORDER BY locked_until DESC
+    `
+	rows, err := db.conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing login locks: %w", err)
+	}
+	defer rows.Close()
+
+	var locks []LoginLock
+	for rows.Next() {
+		var l LoginLock
+		if err := rows.Scan(&l.Scope, &l.Key, &l.LockedUntil, &l.NotifiedAt); err != nil {
+			return nil, fmt.Errorf("error while scanning login lock: %w", err)
+		}
+		l.NotifiedAt = zeroIfEpoch(l.NotifiedAt)
+		locks = append(locks, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while listing login locks: %w", err)
+	}
+	return locks, nil
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	pgerr "github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var ErrOIDCIdentityNotFound = errors.New("oidc identity not found")
+
+// GetUserIDByOIDCIdentity находит пользователя, привязанного к учётной записи провайдера (issuer, subject).
+func (db *DbManager) GetUserIDByOIDCIdentity(ctx context.Context, issuer, subject string) (int64, error) {
+	const query = `SELECT user_id FROM oidc_identities WHERE issuer = $1 AND subject = $2`
+	var userID int64
+	if err := db.conn.QueryRow(ctx, query, issuer, subject).Scan(&userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrOIDCIdentityNotFound
+		}
+		return 0, fmt.Errorf("error while getting oidc identity: %w", err)
+	}
+	return userID, nil
+}
+
+// LinkOIDCIdentity привязывает учётную запись провайдера к существующему пользователю
+// и отмечает его email подтверждённым (провайдер подтвердил владение адресом).
+//
+// Если email ещё не был подтверждён, аккаунт мог зарегистрировать кто угодно, указав чужой адрес.
+// Такой аккаунт переходит к владельцу адреса: пароль, сессии, API-токены и 2FA прежнего
+// регистранта удаляются в той же транзакции. В этом случае возвращается claimed = true.
+func (db *DbManager) LinkOIDCIdentity(ctx context.Context, userID int64, issuer, subject string) (claimed bool, err error) {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := insertOIDCIdentity(ctx, tx, userID, issuer, subject); err != nil {
+		return false, err
+	}
+	// условие на verified_at проверяется в самом UPDATE: если владелец одновременно подтвердил
+	// адрес по письму, его пароль не тронем
+	const claimQuery = `
+        UPDATE users SET verified_at = NOW(), password = '',
+            totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0
+        WHERE id = $1 AND verified_at IS NULL
+    `
+	tag, err := tx.Exec(ctx, claimQuery, userID)
+	if err != nil {
+		return false, fmt.Errorf("error while claiming unverified user: %w", err)
+	}
+	if claimed = tag.RowsAffected() > 0; claimed {
+		if err := revokeCredentials(ctx, tx, userID); err != nil {
+			return false, err
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return false, fmt.Errorf("error while deleting recovery codes: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("error while committing oidc link: %w", err)
+	}
+	return claimed, nil
+}
+
+// CreateOIDCUser создаёт пользователя с подтверждённым email и без пароля (пустой хеш не подходит
+// ни к одному паролю) и сразу привязывает к нему учётную запись провайдера.
+func (db *DbManager) CreateOIDCUser(ctx context.Context, mail, issuer, subject string) (int64, error) {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const query = `
+        INSERT INTO users (mail, password, created_at, verified_at)
+        VALUES ($1, '', NOW(), NOW())
+        RETURNING id
+    `
+	var id int64
+	if err := tx.QueryRow(ctx, query, mail).Scan(&id); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerr.UniqueViolation {
+			return 0, ErrUserExists
+		}
+		return 0, fmt.Errorf("error while adding user: %w", err)
+	}
+	if err := insertOIDCIdentity(ctx, tx, id, issuer, subject); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("error while committing oidc user: %w", err)
+	}
+	return id, nil
+}
+
+func insertOIDCIdentity(ctx context.Context, tx pgx.Tx, userID int64, issuer, subject string) error {
+	const query = `
+        INSERT INTO oidc_identities (user_id, issuer, subject, created_at)
+        VALUES ($1, $2, $3, NOW())
+    `
+	if _, err := tx.Exec(ctx, query, userID, issuer, subject); err != nil {
+		return fmt.Errorf("error while saving oidc identity: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrResetTokenNotFound = errors.New("password reset token not found, expired or already used")
+
+// SavePasswordReset сохраняет хеш токена сброса пароля. Прежние неиспользованные токены пользователя удаляются:
+// действует только ссылка из последнего письма.
+func (db *DbManager) SavePasswordReset(ctx context.Context, userID int64, tokenHash string, expires time.Time) error {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM password_resets WHERE user_id = $1 AND used_at IS NULL`, userID); err != nil {
+		return fmt.Errorf("error while deleting old password resets: %w", err)
+	}
+	const query = `
+        INSERT INTO password_resets (user_id, token_hash, expires_at, created_at)
+        VALUES ($1, $2, $3, NOW())
+    `
+	if _, err := tx.Exec(ctx, query, userID, tokenHash, expires); err != nil {
+		return fmt.Errorf("error while saving password reset: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// GetPasswordResetUser возвращает ID пользователя по действующему (неиспользованному и неистёкшему) токену.
+func (db *DbManager) GetPasswordResetUser(ctx context.Context, tokenHash string) (int64, error) {
+	const query = `
+        SELECT user_id FROM password_resets
+        WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+    `
+	var userID int64
+	if err := db.conn.QueryRow(ctx, query, tokenHash).Scan(&userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrResetTokenNotFound
+		}
+		return 0, fmt.Errorf("error while getting password reset: %w", err)
+	}
+	return userID, nil
+}
+
+// ResetPassword в одной транзакции гасит токен, меняет хеш пароля и удаляет все сессии пользователя.
+// Токен гасится условным UPDATE, поэтому одну ссылку нельзя использовать дважды даже параллельно.
+func (db *DbManager) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int64, error) {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const consumeQuery = `
+        UPDATE password_resets SET used_at = NOW()
+        WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+        RETURNING user_id
+    `
+	var userID int64
+	if err := tx.QueryRow(ctx, consumeQuery, tokenHash).Scan(&userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrResetTokenNotFound
+		}
+		return 0, fmt.Errorf("error while consuming password reset: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `UPDATE users SET password = $2 WHERE id = $1`, userID, passwordHash); err != nil {
+		return 0, fmt.Errorf("error while updating password: %w", err)
+	}
+	if err := revokeCredentials(ctx, tx, userID); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("error while committing password reset: %w", err)
+	}
+	return userID, nil
+}
+
+// revokeCredentials завершает все сессии пользователя и отзывает его API-токены. Вызывается при
+// смене и сбросе пароля: если пароль утёк, выданные с ним токены тоже надо считать скомпрометированными.
+func revokeCredentials(ctx context.Context, tx pgx.Tx, userID int64) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM sessions WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("error while deleting sessions: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM api_tokens WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("error while deleting api tokens: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// TakeToken пополняет ведро key с учётом прошедшего времени и забирает из него токен.
+// Строка блокируется (FOR UPDATE), поэтому параллельные запросы с разных инстансов
+// не могут потратить один и тот же токен.
+// Возвращает, удалось ли забрать токен, и сколько токенов осталось.
+func (db *DbManager) TakeToken(ctx context.Context, key string, ratePerSec float64, burst int) (bool, float64, error) {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return false, 0, fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const insertQuery = `
+        INSERT INTO rate_limits (key, tokens, updated_at)
+        VALUES ($1, $2, NOW())
+        ON CONFLICT (key) DO NOTHING
+    `
+	if _, err := tx.Exec(ctx, insertQuery, key, float64(burst)); err != nil {
+		return false, 0, fmt.Errorf("error while creating rate limit bucket: %w", err)
+	}
+
+	const selectQuery = `
+        SELECT tokens, EXTRACT(EPOCH FROM (NOW() - updated_at))::float8
+        FROM rate_limits
+        WHERE key = $1
+        FOR UPDATE
+    `
+	var tokens, elapsed float64
+	if err := tx.QueryRow(ctx, selectQuery, key).Scan(&tokens, &elapsed); err != nil {
+		return false, 0, fmt.Errorf("error while reading rate limit bucket: %w", err)
+	}
+
+	tokens = math.Min(float64(burst), tokens+elapsed*ratePerSec)
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+
+	const updateQuery = `UPDATE rate_limits SET tokens = $2, updated_at = NOW() WHERE key = $1`
+	if _, err := tx.Exec(ctx, updateQuery, key, tokens); err != nil {
+		return false, 0, fmt.Errorf("error while updating rate limit bucket: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, 0, fmt.Errorf("error while committing rate limit bucket: %w", err)
+	}
+	return allowed, tokens, nil
+}
+
+// DeleteStaleBuckets удаляет вёдра, которые не обновлялись с olderThan.
+func (db *DbManager) DeleteStaleBuckets(ctx context.Context, olderThan time.Time) error {
+	const query = `DELETE FROM rate_limits WHERE updated_at < $1`
+	if _, err := db.conn.Exec(ctx, query, olderThan); err != nil {
+		return fmt.Errorf("error while deleting stale rate limit buckets: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Session — активная сессия пользователя (вход в браузере).
+type Session struct {
+	ID                int64
+	UserID            int64
+	CreatedAt         time.Time
+	LastSeenAt        time.Time
+	ExpiresAt         time.Time // истекает при бездействии, продлевается TouchSession
+	AbsoluteExpiresAt time.Time // дальше этого момента сессия не продлевается
+	Remember          bool
+	IP                string
+	UserAgent         string
+	WorkspaceID       int64 // выбранное рабочее пространство; 0 — личные ссылки
+}
+
+const sessionColumns = `id, user_id, created_at, last_seen_at, expiry, absolute_expiry, remember, ip, user_agent, COALESCE(workspace_id, 0)`
+
+func scanSession(row pgx.Row) (Session, error) {
+	var s Session
+	err := row.Scan(&s.ID, &s.UserID, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &s.AbsoluteExpiresAt, &s.Remember, &s.IP, &s.UserAgent, &s.WorkspaceID)
+	return s, err
+}
+
+// GetSession возвращает действующую (неистёкшую) сессию по токену.
+func (db *DbManager) GetSession(ctx context.Context, token string) (Session, error) {
+	// сессии заблокированных пользователей не действуют
+	query := `SELECT ` + sessionColumns + ` FROM sessions
+        WHERE token = $1 AND expiry > NOW()
+          AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = sessions.user_id AND users.disabled_at IS NOT NULL)`
+	s, err := scanSession(db.conn.QueryRow(ctx, query, token))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Session{}, ErrSessionNotFound
+		}
+		return Session{}, fmt.Errorf("error while getting session: %w", err)
+	}
+	return s, nil
+}
+
+// TouchSession отмечает, что сессией только что пользовались, и продлевает её до expiry
+// (но не дальше absolute_expiry).
+func (db *DbManager) TouchSession(ctx context.Context, id int64, expiry time.Time) error {
+	const query = `UPDATE sessions SET last_seen_at = NOW(), expiry = LEAST($2, absolute_expiry) WHERE id = $1`
+	if _, err := db.conn.Exec(ctx, query, id, expiry); err != nil {
+		return fmt.Errorf("error while touching session: %w", err)
+	}
+	return nil
+}
+
+// ListSessions возвращает действующие сессии пользователя, недавно использованные сверху.
+func (db *DbManager) ListSessions(ctx context.Context, userID int64) ([]Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE user_id = $1 AND expiry > NOW() ORDER BY last_seen_at DESC`
+	rows, err := db.conn.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning session: %w", err)
+		}
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while listing sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// DeleteUserSession завершает одну сессию. Завершить можно только свою сессию.
+func (db *DbManager) DeleteUserSession(ctx context.Context, userID, id int64) error {
+	tag, err := db.conn.Exec(ctx, `DELETE FROM sessions WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("error while deleting session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// DeleteOtherSessions завершает все сессии пользователя, кроме keepID, и возвращает их число.
+func (db *DbManager) DeleteOtherSessions(ctx context.Context, userID, keepID int64) (int64, error) {
+	tag, err := db.conn.Exec(ctx, `DELETE FROM sessions WHERE user_id = $1 AND id <> $2`, userID, keepID)
+	if err != nil {
+		return 0, fmt.Errorf("error while deleting other sessions: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// DeleteExpiredSessions удаляет истёкшие сессии и возвращает их число.
+func (db *DbManager) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	tag, err := db.conn.Exec(ctx, `DELETE FROM sessions WHERE expiry <= NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("error while deleting expired sessions: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
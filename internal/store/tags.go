@@ -0,0 +1,156 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Tag — тег владельца, число ссылок с ним и переходов по ним (без удалённых ссылок).
+type Tag struct {
+	ID     int64
+	Name   string
+	Links  int64
+	Clicks int64
+}
+
+// ownerScope возвращает условие на владельца тега или папки (параметр $1) и значение параметра.
+// У личных тегов и папок владелец — пользователь, у тегов пространства — пространство.
+func ownerScope(owner Owner) (string, int64) {
+	if owner.WorkspaceID != 0 {
+		return `workspace_id = $1`, owner.WorkspaceID
+	}
+	return `user_id = $1 AND workspace_id IS NULL`, owner.UserID
+}
+
+// ownerColumns возвращает значения user_id и workspace_id для новой строки владельца (0 — NULL).
+func ownerColumns(owner Owner) (int64, int64) {
+	if owner.WorkspaceID != 0 {
+		return 0, owner.WorkspaceID
+	}
+	return owner.UserID, 0
+}
+
+// ListTags возвращает теги владельца по алфавиту.
+func (db *DbManager) ListTags(ctx context.Context, owner Owner) ([]Tag, error) {
+	scope, id := ownerScope(owner)
+	q := `SELECT tags.id, tags.name, s.links, s.clicks
+        FROM tags, LATERAL (
+            SELECT COUNT(*), COALESCE(SUM(urls.clicks), 0) FROM link_tags lt JOIN urls ON urls.id = lt.url_id
+            WHERE lt.tag_id = tags.id AND urls.deleted_at IS NULL
+        ) AS s(links, clicks)
+        WHERE ` + scope + `
+        ORDER BY lower(tags.name)`
+	rows, err := db.conn.Query(ctx, q, id)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []Tag
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.ID, &t.Name, &t.Links, &t.Clicks); err != nil {
+			return nil, fmt.Errorf("error while scanning tag: %w", err)
+		}
+		tags = append(tags, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while listing tags: %w", err)
+	}
+	return tags, nil
+}
+
+// SetLinkTags заменяет теги ссылки linkID на names. Недостающие теги владельца создаются,
+// теги, на которых не осталось ссылок, удаляются.
+func (db *DbManager) SetLinkTags(ctx context.Context, owner Owner, linkID int64, names []string) error {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM link_tags WHERE url_id = $1`, linkID); err != nil {
+		return fmt.Errorf("error while clearing link tags: %w", err)
+	}
+	if err := addLinkTags(ctx, tx, owner, []int64{linkID}, names); err != nil {
+		return err
+	}
+	if err := deleteUnusedTags(ctx, tx, owner); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// BulkTagLinks добавляет теги add и снимает теги remove у ссылок links, сгруппированных по владельцу.
+// Всё выполняется в одной транзакции: при ошибке не меняется ни одна ссылка.
+func (db *DbManager) BulkTagLinks(ctx context.Context, links map[Owner][]int64, add, remove []string) error {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for owner, ids := range links {
+		if err := addLinkTags(ctx, tx, owner, ids, add); err != nil {
+			return err
+		}
+		if len(remove) == 0 {
+			continue
+		}
+		scope, id := ownerScope(owner)
+		q := `DELETE FROM link_tags
+            WHERE url_id = ANY($2)
+              AND tag_id IN (SELECT tags.id FROM tags WHERE ` + scope + ` AND lower(tags.name) = ANY($3))`
+		if _, err := tx.Exec(ctx, q, id, ids, lowerAll(remove)); err != nil {
+			return fmt.Errorf("error while removing link tags: %w", err)
+		}
+		if err := deleteUnusedTags(ctx, tx, owner); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func addLinkTags(ctx context.Context, tx pgx.Tx, owner Owner, linkIDs []int64, names []string) error {
+	if len(names) == 0 || len(linkIDs) == 0 {
+		return nil
+	}
+	userID, workspaceID := ownerColumns(owner)
+	const create = `
+        INSERT INTO tags (user_id, workspace_id, name)
+        SELECT NULLIF($1, 0), NULLIF($2, 0), name FROM unnest($3::text[]) AS name
+        ON CONFLICT DO NOTHING
+    `
+	if _, err := tx.Exec(ctx, create, userID, workspaceID, names); err != nil {
+		return fmt.Errorf("error while creating tags: %w", err)
+	}
+	scope, id := ownerScope(owner)
+	q := `INSERT INTO link_tags (url_id, tag_id)
+        SELECT url_id, tags.id FROM unnest($2::int[]) AS url_id, tags
+        WHERE ` + scope + ` AND lower(tags.name) = ANY($3)
+        ON CONFLICT DO NOTHING`
+	if _, err := tx.Exec(ctx, q, id, linkIDs, lowerAll(names)); err != nil {
+		return fmt.Errorf("error while tagging links: %w", err)
+	}
+	return nil
+}
+
+func deleteUnusedTags(ctx context.Context, tx pgx.Tx, owner Owner) error {
+	scope, id := ownerScope(owner)
+	q := `DELETE FROM tags WHERE ` + scope + ` AND NOT EXISTS (SELECT 1 FROM link_tags lt WHERE lt.tag_id = tags.id)`
+	if _, err := tx.Exec(ctx, q, id); err != nil {
+		return fmt.Errorf("error while deleting unused tags: %w", err)
+	}
+	return nil
+}
+
+func lowerAll(names []string) []string {
+	out := make([]string, len(names))
+	for i, n := range names {
+		out[i] = strings.ToLower(n)
+	}
+	return out
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrShortURLDeleted — ссылку удалили: она в корзине или уже стёрта навсегда. Alias повторно не выдаётся.
+var ErrShortURLDeleted = errors.New("short URL was deleted")
+
+// DeleteLink перемещает ссылку в корзину.
+func (db *DbManager) DeleteLink(ctx context.Context, id int64) error {
+	const query = `UPDATE urls SET deleted_at = COALESCE(deleted_at, NOW()) WHERE id = $1`
+	tag, err := db.conn.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("error while deleting link: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrShortURLNotFound
+	}
+	return nil
+}
+
+// UndeleteLink достаёт ссылку из корзины, если она удалена не раньше since.
+// Если ссылки нет в корзине или она удалена раньше — ErrShortURLNotFound.
+func (db *DbManager) UndeleteLink(ctx context.Context, id int64, since time.Time) error {
+	const query = `UPDATE urls SET deleted_at = NULL WHERE id = $1 AND deleted_at >= $2`
+	tag, err := db.conn.Exec(ctx, query, id, since)
+	if err != nil {
+		return fmt.Errorf("error while restoring link: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrShortURLNotFound
+	}
+	return nil
+}
+
+// ListDeletedLinks возвращает ссылки владельца из корзины, удалённые не раньше since, начиная с последних.
+func (db *DbManager) ListDeletedLinks(ctx context.Context, owner Owner, since time.Time, limit int) ([]Link, error) {
+	q := `SELECT ` + linkColumns + `
+        FROM urls LEFT JOIN users ON users.id = urls.user_id
+        WHERE urls.user_id = $1 AND urls.workspace_id IS NULL AND urls.deleted_at >= $2
+        ORDER BY urls.deleted_at DESC
+        LIMIT $3`
+	args := []any{owner.UserID, since, limit}
+	if owner.WorkspaceID != 0 {
+		q = `SELECT ` + linkColumns + `
+        FROM urls LEFT JOIN users ON users.id = urls.user_id
+        WHERE urls.workspace_id = $1 AND urls.deleted_at >= $2
+        ORDER BY urls.deleted_at DESC
+        LIMIT $3`
+		args = []any{owner.WorkspaceID, since, limit}
+	}
+	rows, err := db.conn.Query(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing deleted links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []Link
+	for rows.Next() {
+		l, err := scanLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning link: %w", err)
+		}
+		links = append(links, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while listing deleted links: %w", err)
+	}
+	return links, nil
+}
+
+// PurgeDeletedLinks навсегда стирает ссылки, удалённые раньше before, и возвращает их число.
+// Их alias переносятся в retired_aliases, чтобы больше никому не достались.
+func (db *DbManager) PurgeDeletedLinks(ctx context.Context, before time.Time) (int64, error) {
+	const query = `
+        WITH purged AS (
+            DELETE FROM urls WHERE deleted_at < $1 RETURNING short_code
+        )
+        INSERT INTO retired_aliases (short_code)
+        SELECT short_code FROM purged
+        ON CONFLICT DO NOTHING
+    `
+	tag, err := db.conn.Exec(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("error while purging deleted links: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// isRetiredAlias сообщает, что ссылку с этим alias уже стёрли навсегда.
+func (db *DbManager) isRetiredAlias(ctx context.Context, alias string) (bool, error) {
+	var retired bool
+	err := db.conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM retired_aliases WHERE short_code = $1)`, alias).Scan(&retired)
+	if err != nil {
+		return false, fmt.Errorf("error while checking retired alias: %w", err)
+	}
+	return retired, nil
+}
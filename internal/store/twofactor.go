@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+
+// TOTP — состояние двухфакторной аутентификации пользователя.
+type TOTP struct {
+	Secret    string    // зашифрованный секрет; пусто — 2FA не настраивалась
+	EnabledAt time.Time // нулевое время — секрет выдан, но ещё не подтверждён кодом
+	LastStep  int64     // последний принятый шаг TOTP, защита от повторного использования кода
+}
+
+// Enabled сообщает, включена ли 2FA.
+func (t TOTP) Enabled() bool {
+	return !t.EnabledAt.IsZero()
+}
+
+// GetTOTP возвращает состояние 2FA пользователя.
+func (db *DbManager) GetTOTP(ctx context.Context, userID int64) (TOTP, error) {
+	const query = `
+        SELECT COALESCE(totp_secret, ''), COALESCE(totp_enabled_at, 'epoch'), totp_last_step
+        FROM users WHERE id = $1
+    `
+	var t TOTP
+	if err := db.conn.QueryRow(ctx, query, userID).Scan(&t.Secret, &t.EnabledAt, &t.LastStep); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return TOTP{}, ErrUserNotFound
+		}
+		return TOTP{}, fmt.Errorf("error while getting totp: %w", err)
+	}
+	t.EnabledAt = zeroIfEpoch(t.EnabledAt)
+	return t, nil
+}
+
+// SetPendingTOTP сохраняет новый, ещё не подтверждённый секрет. Уже включённую 2FA не трогает.
+func (db *DbManager) SetPendingTOTP(ctx context.Context, userID int64, secret string) error {
+	const query = `
+        UPDATE users SET totp_secret = $2, totp_last_step = 0
+        WHERE id = $1 AND totp_enabled_at IS NULL
+    `
+	cmd, err := db.conn.Exec(ctx, query, userID, secret)
+	if err != nil {
+		return fmt.Errorf("error while saving totp secret: %w", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+	return nil
+}
+
+// EnableTOTP включает 2FA и заменяет коды восстановления на новые (хранятся только хеши).
+func (db *DbManager) EnableTOTP(ctx context.Context, userID, step int64, recoveryHashes []string) error {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const enableQuery = `
+        UPDATE users SET totp_enabled_at = NOW(), totp_last_step = $2
+        WHERE id = $1 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL
+    `
+	cmd, err := tx.Exec(ctx, enableQuery, userID, step)
+	if err != nil {
+		return fmt.Errorf("error while enabling totp: %w", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("error while deleting recovery codes: %w", err)
+	}
+	for _, h := range recoveryHashes {
+		if _, err := tx.Exec(ctx, `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, h); err != nil {
+			return fmt.Errorf("error while saving recovery code: %w", err)
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// DisableTOTP выключает 2FA и удаляет коды восстановления.
+func (db *DbManager) DisableTOTP(ctx context.Context, userID int64) error {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const query = `UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0 WHERE id = $1`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return fmt.Errorf("error while disabling totp: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("error while deleting recovery codes: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// AdvanceTOTPStep запоминает принятый шаг, если он больше предыдущего.
+// Возвращает false, если код с этим шагом уже использовали.
+func (db *DbManager) AdvanceTOTPStep(ctx context.Context, userID, step int64) (bool, error) {
+	const query = `UPDATE users SET totp_last_step = $2 WHERE id = $1 AND totp_last_step < $2`
+	cmd, err := db.conn.Exec(ctx, query, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("error while updating totp step: %w", err)
+	}
+	return cmd.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode гасит код восстановления. Возвращает false, если такого неиспользованного кода нет.
+func (db *DbManager) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	const query = `
+        UPDATE recovery_codes SET used_at = NOW()
+        WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+    `
+	cmd, err := db.conn.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("error while using recovery code: %w", err)
+	}
+	return cmd.RowsAffected() == 1, nil
+}
+
+// CountRecoveryCodes возвращает число неиспользованных кодов восстановления.
+func (db *DbManager) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	var n int
+	query := `SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+	if err := db.conn.QueryRow(ctx, query, userID).Scan(&n); err != nil {
+		return 0, fmt.Errorf("error while counting recovery codes: %w", err)
+	}
+	return n, nil
+}
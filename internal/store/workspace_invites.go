@@ -0,0 +1,147 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrInviteNotFound = errors.New("workspace invite not found, revoked, expired or already used")
+
+// WorkspaceInvite — приглашение в рабочее пространство. Сам токен не хранится, только его хеш.
+type WorkspaceInvite struct {
+	ID            int64
+	WorkspaceID   int64
+	WorkspaceName string
+	Mail          string
+	Role          string
+	InvitedBy     int64
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+}
+
+// SaveWorkspaceInvite сохраняет приглашение и возвращает его ID. Прежнее неиспользованное приглашение
+// того же адреса в это пространство удаляется: действует только ссылка из последнего письма.
+func (db *DbManager) SaveWorkspaceInvite(ctx context.Context, inv WorkspaceInvite, tokenHash string) (int64, error) {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const deleteQuery = `DELETE FROM workspace_invites WHERE workspace_id = $1 AND mail = $2 AND used_at IS NULL`
+	if _, err := tx.Exec(ctx, deleteQuery, inv.WorkspaceID, inv.Mail); err != nil {
+		return 0, fmt.Errorf("error while deleting old workspace invites: %w", err)
+	}
+	const query = `
+        INSERT INTO workspace_invites (workspace_id, mail, role, token_hash, invited_by, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6, NOW())
+        RETURNING id
+    `
+	var id int64
+	if err := tx.QueryRow(ctx, query, inv.WorkspaceID, inv.Mail, inv.Role, tokenHash, inv.InvitedBy, inv.ExpiresAt).Scan(&id); err != nil {
+		return 0, fmt.Errorf("error while saving workspace invite: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("error while committing workspace invite: %w", err)
+	}
+	return id, nil
+}
+
+// GetWorkspaceInvite возвращает действующее (неиспользованное, неотозванное и неистёкшее) приглашение по хешу токена.
+func (db *DbManager) GetWorkspaceInvite(ctx context.Context, tokenHash string) (WorkspaceInvite, error) {
+	const query = `
+        SELECT i.id, i.workspace_id, w.name, i.mail, i.role, COALESCE(i.invited_by, 0), i.expires_at, i.created_at
+        FROM workspace_invites i JOIN workspaces w ON w.id = i.workspace_id
+        WHERE i.token_hash = $1 AND i.used_at IS NULL AND i.expires_at > NOW()
+    `
+	var inv WorkspaceInvite
+	err := db.conn.QueryRow(ctx, query, tokenHash).Scan(&inv.ID, &inv.WorkspaceID, &inv.WorkspaceName, &inv.Mail,
+		&inv.Role, &inv.InvitedBy, &inv.ExpiresAt, &inv.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return WorkspaceInvite{}, ErrInviteNotFound
+		}
+		return WorkspaceInvite{}, fmt.Errorf("error while getting workspace invite: %w", err)
+	}
+	return inv, nil
+}
+
+// AcceptWorkspaceInvite в одной транзакции гасит приглашение, отправленное на mail, и добавляет userID
+// в пространство с ролью из приглашения. Если пользователь уже участник, его роль не меняется.
+// Возвращает погашенное приглашение.
+func (db *DbManager) AcceptWorkspaceInvite(ctx context.Context, tokenHash string, userID int64, mail string) (WorkspaceInvite, error) {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return WorkspaceInvite{}, fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const consumeQuery = `
+        UPDATE workspace_invites SET used_at = NOW()
+        WHERE token_hash = $1 AND mail = $2 AND used_at IS NULL AND expires_at > NOW()
+        RETURNING id, workspace_id, role
+    `
+	inv := WorkspaceInvite{Mail: mail}
+	if err := tx.QueryRow(ctx, consumeQuery, tokenHash, mail).Scan(&inv.ID, &inv.WorkspaceID, &inv.Role); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return WorkspaceInvite{}, ErrInviteNotFound
+		}
+		return WorkspaceInvite{}, fmt.Errorf("error while consuming workspace invite: %w", err)
+	}
+	const memberQuery = `
+        INSERT INTO workspace_members (workspace_id, user_id, role) VALUES ($1, $2, $3)
+        ON CONFLICT (workspace_id, user_id) DO NOTHING
+    `
+	if _, err := tx.Exec(ctx, memberQuery, inv.WorkspaceID, userID, inv.Role); err != nil {
+		return WorkspaceInvite{}, fmt.Errorf("error while adding workspace member: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return WorkspaceInvite{}, fmt.Errorf("error while committing workspace invite: %w", err)
+	}
+	return inv, nil
+}
+
+// ListWorkspaceInvites возвращает действующие приглашения пространства, новые сверху.
+func (db *DbManager) ListWorkspaceInvites(ctx context.Context, workspaceID int64) ([]WorkspaceInvite, error) {
+	const query = `
+        SELECT id, workspace_id, mail, role, COALESCE(invited_by, 0), expires_at, created_at
+        FROM workspace_invites
+        WHERE workspace_id = $1 AND used_at IS NULL AND expires_at > NOW()
+        ORDER BY created_at DESC
+    `
+	rows, err := db.conn.Query(ctx, query, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing workspace invites: %w", err)
+	}
+	defer rows.Close()
+
+	var invites []WorkspaceInvite
+	for rows.Next() {
+		var inv WorkspaceInvite
+		if err := rows.Scan(&inv.ID, &inv.WorkspaceID, &inv.Mail, &inv.Role, &inv.InvitedBy, &inv.ExpiresAt, &inv.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error while scanning workspace invite: %w", err)
+		}
+		invites = append(invites, inv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while listing workspace invites: %w", err)
+	}
+	return invites, nil
+}
+
+// DeleteWorkspaceInvite отзывает неиспользованное приглашение пространства и возвращает адрес, на который оно было отправлено.
+func (db *DbManager) DeleteWorkspaceInvite(ctx context.Context, workspaceID, id int64) (string, error) {
+	const query = `DELETE FROM workspace_invites WHERE id = $1 AND workspace_id = $2 AND used_at IS NULL RETURNING mail`
+	var mail string
+	if err := db.conn.QueryRow(ctx, query, id, workspaceID).Scan(&mail); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrInviteNotFound
+		}
+		return "", fmt.Errorf("error while deleting workspace invite: %w", err)
+	}
+	return mail, nil
+}
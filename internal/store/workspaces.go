@@ -0,0 +1,301 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	pgerr "github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Роли участников рабочего пространства.
+const (
+	WorkspaceOwner  = "owner"  // управляет участниками и ссылками
+	WorkspaceEditor = "editor" // создаёт ссылки
+	WorkspaceViewer = "viewer" // только смотрит
+)
+
+var (
+	ErrWorkspaceNotFound  = errors.New("workspace not found")
+	ErrNotWorkspaceMember = errors.New("user is not a member of the workspace")
+	ErrAlreadyMember      = errors.New("user is already a member of the workspace")
+)
+
+// Owner — кому принадлежит ссылка: автору лично или рабочему пространству.
+type Owner struct {
+	UserID      int64 // автор
+	WorkspaceID int64 // 0 — личная ссылка автора
+}
+
+// Membership — участие пользователя в рабочем пространстве.
+// Нулевое значение — личное пространство пользователя, где он сам себе владелец.
+type Membership struct {
+	WorkspaceID int64
+	Name        string
+	Role        string
+}
+
+// Personal сообщает, что выбраны личные ссылки, а не рабочее пространство.
+func (m Membership) Personal() bool { return m.WorkspaceID == 0 }
+
+// CanEdit — можно ли создавать и менять ссылки.
+func (m Membership) CanEdit() bool {
+	return m.Personal() || m.Role == WorkspaceOwner || m.Role == WorkspaceEditor
+}
+
+// CanManage — можно ли приглашать и удалять участников.
+func (m Membership) CanManage() bool { return !m.Personal() && m.Role == WorkspaceOwner }
+
+// Member — участник рабочего пространства.
+type Member struct {
+	UserID   int64
+	Mail     string
+	Role     string
+	JoinedAt time.Time
+}
+
+// CreateWorkspace создаёт пространство, делает ownerID его владельцем и возвращает ID пространства.
+func (db *DbManager) CreateWorkspace(ctx context.Context, name string, ownerID int64) (int64, error) {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var id int64
+	if err := tx.QueryRow(ctx, `INSERT INTO workspaces (name) VALUES ($1) RETURNING id`, name).Scan(&id); err != nil {
+		return 0, fmt.Errorf("error while creating workspace: %w", err)
+	}
+	const query = `INSERT INTO workspace_members (workspace_id, user_id, role) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(ctx, query, id, ownerID, WorkspaceOwner); err != nil {
+		return 0, fmt.Errorf("error while adding workspace owner: %w", err)
+	}
+	return id, tx.Commit(ctx)
+}
+
+// GetWorkspaceName возвращает название пространства.
+func (db *DbManager) GetWorkspaceName(ctx context.Context, id int64) (string, error) {
+	var name string
+	if err := db.conn.QueryRow(ctx, `SELECT name FROM workspaces WHERE id = $1`, id).Scan(&name); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrWorkspaceNotFound
+		}
+		return "", fmt.Errorf("error while getting workspace: %w", err)
+	}
+	return name, nil
+}
+
+// GetMembership возвращает участие пользователя в пространстве или ErrNotWorkspaceMember.
+func (db *DbManager) GetMembership(ctx context.Context, workspaceID, userID int64) (Membership, error) {
+	const query = `
+        SELECT w.id, w.name, m.role
+        FROM workspace_members m JOIN workspaces w ON w.id = m.workspace_id
+        WHERE m.workspace_id = $1 AND m.user_id = $2
+    `
+	var m Membership
+	if err := db.conn.QueryRow(ctx, query, workspaceID, userID).Scan(&m.WorkspaceID, &m.Name, &m.Role); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Membership{}, ErrNotWorkspaceMember
+		}
+		return Membership{}, fmt.Errorf("error while getting workspace membership: %w", err)
+	}
+	return m, nil
+}
+
+// ListWorkspaces возвращает пространства, в которых состоит пользователь, по названию.
+func (db *DbManager) ListWorkspaces(ctx context.Context, userID int64) ([]Membership, error) {
+	const query = `
+        SELECT w.id, w.name, m.role
+        FROM workspace_members m JOIN workspaces w ON w.id = m.workspace_id
+        WHERE m.user_id = $1
+        ORDER BY w.name, w.id
+    `
+	rows, err := db.conn.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing workspaces: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Membership
+	for rows.Next() {
+		var m Membership
+		if err := rows.Scan(&m.WorkspaceID, &m.Name, &m.Role); err != nil {
+			return nil, fmt.Errorf("error while scanning workspace: %w", err)
+		}
+		list = append(list, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while listing workspaces: %w", err)
+	}
+	return list, nil
+}
+
+// ListMembers возвращает участников пространства в порядке вступления.
+func (db *DbManager) ListMembers(ctx context.Context, workspaceID int64) ([]Member, error) {
+	const query = `
+        SELECT m.user_id, u.mail, m.role, m.created_at
+        FROM workspace_members m JOIN users u ON u.id = m.user_id
+        WHERE m.workspace_id = $1
+        ORDER BY m.created_at, m.user_id
+    `
+	rows, err := db.conn.Query(ctx, query, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing workspace members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []Member
+	for rows.Next() {
+		var m Member
+		if err := rows.Scan(&m.UserID, &m.Mail, &m.Role, &m.JoinedAt); err != nil {
+			return nil, fmt.Errorf("error while scanning workspace member: %w", err)
+		}
+		members = append(members, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while listing workspace members: %w", err)
+	}
+	return members, nil
+}
+
+// AddMember добавляет пользователя в пространство. Если он уже участник — ErrAlreadyMember.
+func (db *DbManager) AddMember(ctx context.Context, workspaceID, userID int64, role string) error {
+	const query = `INSERT INTO workspace_members (workspace_id, user_id, role) VALUES ($1, $2, $3)`
+	if _, err := db.conn.Exec(ctx, query, workspaceID, userID, role); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.Code {
+			case pgerr.UniqueViolation:
+				return ErrAlreadyMember
+			case pgerr.ForeignKeyViolation:
+				return ErrWorkspaceNotFound
+			}
+		}
+		return fmt.Errorf("error while adding workspace member: %w", err)
+	}
+	return nil
+}
+
+// SetMemberRole меняет роль участника.
+func (db *DbManager) SetMemberRole(ctx context.Context, workspaceID, userID int64, role string) error {
+	const query = `UPDATE workspace_members SET role = $3 WHERE workspace_id = $1 AND user_id = $2`
+	tag, err := db.conn.Exec(ctx, query, workspaceID, userID, role)
+	if err != nil {
+		return fmt.Errorf("error while setting workspace member role: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotWorkspaceMember
+	}
+	return nil
+}
+
+// RemoveMember исключает пользователя из пространства и отзывает неиспользованные приглашения
+// на его адрес, чтобы исключённый не вернулся по старому письму.
+func (db *DbManager) RemoveMember(ctx context.Context, workspaceID, userID int64) error {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const query = `DELETE FROM workspace_members WHERE workspace_id = $1 AND user_id = $2`
+	tag, err := tx.Exec(ctx, query, workspaceID, userID)
+	if err != nil {
+		return fmt.Errorf("error while removing workspace member: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotWorkspaceMember
+	}
+	const invitesQuery = `
+        DELETE FROM workspace_invites
+        WHERE workspace_id = $1 AND used_at IS NULL AND mail = (SELECT mail FROM users WHERE id = $2)
+    `
+	if _, err := tx.Exec(ctx, invitesQuery, workspaceID, userID); err != nil {
+		return fmt.Errorf("error while revoking workspace invites: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error while committing workspace member removal: %w", err)
+	}
+	return nil
+}
+
+// SetSessionWorkspace запоминает выбранное в сессии пространство; 0 — личные ссылки.
+func (db *DbManager) SetSessionWorkspace(ctx context.Context, sessionID, workspaceID int64) error {
+	const query = `UPDATE sessions SET workspace_id = NULLIF($2, 0) WHERE id = $1`
+	if _, err := db.conn.Exec(ctx, query, sessionID, workspaceID); err != nil {
+		return fmt.Errorf("error while switching session workspace: %w", err)
+	}
+	return nil
+}
+
+// LinkFilter — отбор ссылок в списке. Пустые поля не ограничивают.
+type LinkFilter struct {
+	Tag      string // без учёта регистра
+	FolderID int64
+}
+
+// linkFilterCond — условие LinkFilter на urls: тег в $2, папка в $3.
+const linkFilterCond = `
+          AND ($2 = '' OR EXISTS (
+              SELECT 1 FROM link_tags lt JOIN tags t ON t.id = lt.tag_id
+              WHERE lt.url_id = urls.id AND lower(t.name) = lower($2)))
+          AND ($3 = 0 OR urls.folder_id = $3)`
+
+// ownerLinksCond — условие на владельца ссылок ($1): пространство, если оно задано, иначе личные ссылки автора.
+func ownerLinksCond(owner Owner) (string, int64) {
+	if owner.WorkspaceID != 0 {
+		return `urls.workspace_id = $1`, owner.WorkspaceID
+	}
+	return `urls.user_id = $1 AND urls.workspace_id IS NULL`, owner.UserID
+}
+
+// ListLinks возвращает последние ссылки владельца, подходящие под filter:
+// пространства, если оно задано, иначе личные ссылки автора.
+func (db *DbManager) ListLinks(ctx context.Context, owner Owner, filter LinkFilter, limit int) ([]Link, error) {
+	scope, id := ownerLinksCond(owner)
+	q := `SELECT ` + linkColumns + `
+        FROM urls LEFT JOIN users ON users.id = urls.user_id
+        WHERE ` + scope + ` AND urls.deleted_at IS NULL` + linkFilterCond + `
+        ORDER BY urls.created_at DESC
+        LIMIT $4`
+	rows, err := db.conn.Query(ctx, q, id, filter.Tag, filter.FolderID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []Link
+	for rows.Next() {
+		l, err := scanLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning link: %w", err)
+		}
+		links = append(links, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while listing links: %w", err)
+	}
+	return links, nil
+}
+
+// LinkStats — сводка по ссылкам: сколько их и сколько по ним переходов.
+type LinkStats struct {
+	Links  int64
+	Clicks int64
+}
+
+// GetLinkStats считает ссылки владельца, подходящие под filter (без удалённых), и переходы по ним.
+func (db *DbManager) GetLinkStats(ctx context.Context, owner Owner, filter LinkFilter) (LinkStats, error) {
+	scope, id := ownerLinksCond(owner)
+	q := `SELECT COUNT(*), COALESCE(SUM(urls.clicks), 0)
+        FROM urls
+        WHERE ` + scope + ` AND urls.deleted_at IS NULL` + linkFilterCond
+	var s LinkStats
+	if err := db.conn.QueryRow(ctx, q, id, filter.Tag, filter.FolderID).Scan(&s.Links, &s.Clicks); err != nil {
+		return LinkStats{}, fmt.Errorf("error while counting link stats: %w", err)
+	}
+	return s, nil
+}